@@ -0,0 +1,118 @@
+package main
+
+import (
+	"codesprint/database"
+	"codesprint/rating"
+	"codesprint/standings"
+	"codesprint/storage"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// runCommand runs a maintenance command instead of starting the server
+func runCommand(args []string) error {
+	switch args[0] {
+	case "rebuild-standings":
+		// rebuild-standings [contest_id...] - all contests when no ID is given
+		if len(args) == 1 {
+			return standings.RebuildAll()
+		}
+		for _, arg := range args[1:] {
+			contestID, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid contest ID %q", arg)
+			}
+			if err := standings.Rebuild(contestID); err != nil {
+				return fmt.Errorf("contest %d: %w", contestID, err)
+			}
+			log.Printf("Rebuilt standings for contest %d", contestID)
+		}
+		return nil
+	case "recompute-ratings":
+		// recompute-ratings - replay all finalized rated contests from scratch
+		if err := rating.RecomputeAll(); err != nil {
+			return err
+		}
+		log.Printf("Recomputed ratings")
+		return nil
+	case "grant-admin":
+		// grant-admin <email> - give a user the admin role
+		if len(args) != 2 {
+			return fmt.Errorf("usage: grant-admin <email>")
+		}
+		res, err := database.DB.Exec("UPDATE users SET is_admin = TRUE WHERE email = $1", args[1])
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("no user with email %q", args[1])
+		}
+		log.Printf("Granted admin role to %s", args[1])
+		return nil
+	case "migrate-testcases":
+		// migrate-testcases - move testcase data stored inline into blob storage
+		n, err := migrateTestcases()
+		if err != nil {
+			return err
+		}
+		log.Printf("Moved %d testcases to blob storage", n)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// migrateTestcases moves inline testcase data into blob storage in batches and
+// returns how many testcases were moved
+func migrateTestcases() (int, error) {
+	moved := 0
+	for {
+		rows, err := database.DB.Query(
+			"SELECT id, input, expected_output FROM testcases WHERE input_hash IS NULL ORDER BY id LIMIT 50",
+		)
+		if err != nil {
+			return moved, err
+		}
+		type inline struct {
+			id            int
+			input, output string
+		}
+		var batch []inline
+		for rows.Next() {
+			var tc inline
+			var input, output sql.NullString
+			if err := rows.Scan(&tc.id, &input, &output); err != nil {
+				rows.Close()
+				return moved, err
+			}
+			tc.input, tc.output = input.String, output.String
+			batch = append(batch, tc)
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			return moved, nil
+		}
+
+		for _, tc := range batch {
+			input, err := storage.PutString(tc.input)
+			if err != nil {
+				return moved, fmt.Errorf("testcase %d: %w", tc.id, err)
+			}
+			output, err := storage.PutString(tc.output)
+			if err != nil {
+				return moved, fmt.Errorf("testcase %d: %w", tc.id, err)
+			}
+			_, err = database.DB.Exec(`
+				UPDATE testcases SET input_hash = $1, input_size = $2, output_hash = $3, output_size = $4,
+					input = NULL, expected_output = NULL
+				WHERE id = $5
+			`, input.Hash, input.Size, output.Hash, output.Size, tc.id)
+			if err != nil {
+				return moved, fmt.Errorf("testcase %d: %w", tc.id, err)
+			}
+			moved++
+		}
+	}
+}
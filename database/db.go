@@ -10,8 +10,8 @@ import (
 
 var DB *sql.DB
 
-// InitDB initializes the database connection
-func InitDB() error {
+// ConnString builds the PostgreSQL connection string from the environment
+func ConnString() string {
 	host := os.Getenv("DB_HOST")
 	if host == "" {
 		host = "localhost"
@@ -33,8 +33,13 @@ func InitDB() error {
 		dbname = "codesprint"
 	}
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
+}
+
+// InitDB initializes the database connection
+func InitDB() error {
+	connStr := ConnString()
 
 	var err error
 	DB, err = sql.Open("postgres", connStr)
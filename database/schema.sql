@@ -19,14 +19,15 @@ CREATE TABLE IF NOT EXISTS contests (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
--- Problems table
+-- Problems table (the problem library; contests use problems through contest_problems)
 CREATE TABLE IF NOT EXISTS problems (
     id SERIAL PRIMARY KEY,
-    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
     title VARCHAR(255) NOT NULL,
     statement TEXT NOT NULL,
     time_limit INTEGER DEFAULT 1000, -- milliseconds
     memory_limit INTEGER DEFAULT 256, -- MB
+    is_public BOOLEAN DEFAULT FALSE, -- listed in the practice archive
+    created_by INTEGER REFERENCES users(id),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -40,6 +41,17 @@ CREATE TABLE IF NOT EXISTS testcases (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Problems used in each contest
+CREATE TABLE IF NOT EXISTS contest_problems (
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    label VARCHAR(10) NOT NULL, -- A, B, C, ...
+    points INTEGER DEFAULT 100,
+    position INTEGER NOT NULL DEFAULT 0, -- display order
+    PRIMARY KEY (contest_id, problem_id),
+    UNIQUE (contest_id, label)
+);
+
 -- Submissions table
 CREATE TABLE IF NOT EXISTS submissions (
     id SERIAL PRIMARY KEY,
@@ -48,14 +60,14 @@ CREATE TABLE IF NOT EXISTS submissions (
     contest_id INTEGER REFERENCES contests(id),
     language VARCHAR(50) NOT NULL,
     code TEXT NOT NULL,
-    status VARCHAR(50) DEFAULT 'pending', -- pending, running, accepted, wrong_answer, time_limit_exceeded, runtime_error, compilation_error
+    status VARCHAR(50) DEFAULT 'pending', -- pending, running, accepted, wrong_answer, presentation_error, time_limit_exceeded, memory_limit_exceeded, output_limit_exceeded, runtime_error, compilation_error, judge_error
     score INTEGER DEFAULT 0,
     runtime INTEGER DEFAULT 0, -- milliseconds
     judge0_token VARCHAR(255), -- Judge0 submission token
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
--- Leaderboard cache table (optional, for performance)
+-- Leaderboard totals per user, maintained incrementally from leaderboard_cells
 CREATE TABLE IF NOT EXISTS leaderboard_cache (
     contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
     user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
@@ -65,10 +77,283 @@ CREATE TABLE IF NOT EXISTS leaderboard_cache (
     PRIMARY KEY (contest_id, user_id)
 );
 
+-- Columns added after the initial release
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS is_public BOOLEAN DEFAULT FALSE;
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS created_by INTEGER REFERENCES users(id);
+
+-- Problems used to belong to a single contest through problems.contest_id;
+-- move those links into contest_problems
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'problems' AND column_name = 'contest_id') THEN
+        INSERT INTO contest_problems (contest_id, problem_id, label, position)
+        SELECT contest_id, id,
+            CASE WHEN n <= 26 THEN chr(64 + n) ELSE 'P' || n END,
+            n - 1
+        FROM (
+            SELECT contest_id, id, ROW_NUMBER() OVER (PARTITION BY contest_id ORDER BY id)::int AS n
+            FROM problems WHERE contest_id IS NOT NULL
+        ) numbered
+        ON CONFLICT DO NOTHING;
+
+        UPDATE problems p SET created_by = c.created_by
+        FROM contests c
+        WHERE c.id = p.contest_id AND p.created_by IS NULL;
+
+        ALTER TABLE problems DROP COLUMN contest_id;
+    END IF;
+END $$;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN DEFAULT FALSE;
+ALTER TABLE contests ADD COLUMN IF NOT EXISTS is_draft BOOLEAN DEFAULT FALSE; -- drafts are hidden from the contest list
+ALTER TABLE contests ADD COLUMN IF NOT EXISTS is_rated BOOLEAN DEFAULT FALSE;
+ALTER TABLE contests ADD COLUMN IF NOT EXISTS finalized_at TIMESTAMP; -- set once results are final and ratings applied
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating INTEGER; -- NULL until the first rated contest
+
+-- Users taking an ended contest "as if live" on their own timer
+CREATE TABLE IF NOT EXISTS virtual_participations (
+    id SERIAL PRIMARY KEY,
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (contest_id, user_id)
+);
+
+-- Set for submissions made during a virtual participation
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS virtual_participation_id INTEGER REFERENCES virtual_participations(id) ON DELETE CASCADE;
+
+-- Set for submissions made after the contest ended outside a virtual participation (upsolving);
+-- they do not count in the official standings
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS is_practice BOOLEAN DEFAULT FALSE;
+UPDATE submissions s SET is_practice = TRUE
+FROM contests c
+WHERE c.id = s.contest_id AND s.created_at > c.end_time
+    AND s.virtual_participation_id IS NULL AND NOT s.is_practice;
+
+-- Per-problem leaderboard cells, maintained incrementally as verdicts land
+CREATE TABLE IF NOT EXISTS leaderboard_cells (
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    attempts INTEGER DEFAULT 0, -- submissions up to and including the first accepted one
+    solved BOOLEAN DEFAULT FALSE,
+    solved_at TIMESTAMP,
+    solve_minute INTEGER DEFAULT 0,
+    pending BOOLEAN DEFAULT FALSE,
+    first_to_solve BOOLEAN DEFAULT FALSE,
+    accepted_submission_id INTEGER,
+    PRIMARY KEY (contest_id, user_id, problem_id)
+);
+
+-- Version of each contest's stored standings, bumped on every change (used as ETag)
+CREATE TABLE IF NOT EXISTS leaderboard_versions (
+    contest_id INTEGER PRIMARY KEY REFERENCES contests(id) ON DELETE CASCADE,
+    version BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Clarification requests: a participant asks, a judge answers privately or to everyone
+CREATE TABLE IF NOT EXISTS clarifications (
+    id SERIAL PRIMARY KEY,
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE SET NULL, -- NULL for general questions
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    question TEXT NOT NULL,
+    answer TEXT,
+    answered_by INTEGER REFERENCES users(id),
+    is_public BOOLEAN DEFAULT FALSE, -- broadcast to all participants
+    answered_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Contest announcements from the contest owner or admins
+CREATE TABLE IF NOT EXISTS announcements (
+    id SERIAL PRIMARY KEY,
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE SET NULL,
+    message TEXT NOT NULL,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- When each user last read a contest's announcements and clarifications
+CREATE TABLE IF NOT EXISTS contest_message_reads (
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (contest_id, user_id)
+);
+
+-- Rating change of each user in each finalized rated contest
+CREATE TABLE IF NOT EXISTS rating_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    rank DOUBLE PRECISION NOT NULL, -- tied users share the average of their places
+    old_rating INTEGER NOT NULL,
+    new_rating INTEGER NOT NULL,
+    delta INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, contest_id)
+);
+
+-- Current version of each problem. Editing the statement, limits or testcases
+-- of a version that submissions were judged against starts a new version.
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- Statement and limits of every problem version
+CREATE TABLE IF NOT EXISTS problem_versions (
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    statement TEXT NOT NULL,
+    time_limit INTEGER NOT NULL,
+    memory_limit INTEGER NOT NULL,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (problem_id, version)
+);
+INSERT INTO problem_versions (problem_id, version, title, statement, time_limit, memory_limit, created_by)
+SELECT id, version, title, statement, time_limit, memory_limit, created_by FROM problems
+ON CONFLICT DO NOTHING;
+
+-- A testcase belongs to the problem versions from added_in_version up to,
+-- but not including, removed_in_version
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS added_in_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS removed_in_version INTEGER;
+
+-- Testcase data lives in blob storage under its SHA-256 hash. Rows created
+-- before that keep input/expected_output inline until `./main migrate-testcases`.
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS input_hash CHAR(64);
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS output_hash CHAR(64);
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS input_size BIGINT;
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS output_size BIGINT;
+ALTER TABLE testcases ALTER COLUMN input DROP NOT NULL;
+ALTER TABLE testcases ALTER COLUMN expected_output DROP NOT NULL;
+
+-- Programs that come with a problem, such as its checker and the support
+-- files it needs. Sources live in blob storage; like testcases they belong to
+-- the problem versions from added_in_version up to removed_in_version.
+CREATE TABLE IF NOT EXISTS problem_programs (
+    id SERIAL PRIMARY KEY,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    language VARCHAR(50),
+    kind VARCHAR(20),
+    source_hash CHAR(64) NOT NULL,
+    source_size BIGINT NOT NULL,
+    added_in_version INTEGER NOT NULL DEFAULT 1,
+    removed_in_version INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Reference solutions are tagged with the verdict they are expected to get
+ALTER TABLE problem_programs ADD COLUMN IF NOT EXISTS expected_verdict VARCHAR(50);
+
+-- Runs of the validator and reference solutions over a problem version
+CREATE TABLE IF NOT EXISTS problem_verifications (
+    id SERIAL PRIMARY KEY,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    problem_version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    report TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- Generated testcases record the generator invocation that produced them
+ALTER TABLE testcases ADD COLUMN IF NOT EXISTS generated_by TEXT;
+
+-- Runs of a problem's generation script
+CREATE TABLE IF NOT EXISTS problem_generations (
+    id SERIAL PRIMARY KEY,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    message TEXT,
+    problem_version INTEGER,
+    added INTEGER NOT NULL DEFAULT 0,
+    removed INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+-- How many testcases a submission runs on: stop_at_first_failure (ICPC) or run_all (IOI)
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS judging_policy VARCHAR(30) NOT NULL DEFAULT 'stop_at_first_failure';
+ALTER TABLE problem_versions ADD COLUMN IF NOT EXISTS judging_policy VARCHAR(30);
+UPDATE problem_versions v SET judging_policy = p.judging_policy FROM problems p WHERE p.id = v.problem_id AND v.judging_policy IS NULL;
+
+-- Languages a contest accepts submissions in; NULL allows every language
+ALTER TABLE contests ADD COLUMN IF NOT EXISTS allowed_languages TEXT[];
+
+-- Rejudges admins started, over one submission, a problem or a contest
+CREATE TABLE IF NOT EXISTS rejudges (
+    id SERIAL PRIMARY KEY,
+    submission_id INTEGER REFERENCES submissions(id) ON DELETE CASCADE,
+    problem_id INTEGER REFERENCES problems(id) ON DELETE CASCADE,
+    contest_id INTEGER REFERENCES contests(id) ON DELETE CASCADE,
+    statuses TEXT[], -- verdicts rejudged; NULL rejudges every verdict
+    submission_count INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Verdicts submissions had before they were rejudged
+CREATE TABLE IF NOT EXISTS submission_verdicts (
+    id SERIAL PRIMARY KEY,
+    submission_id INTEGER REFERENCES submissions(id) ON DELETE CASCADE,
+    rejudge_id INTEGER REFERENCES rejudges(id) ON DELETE SET NULL,
+    status VARCHAR(50) NOT NULL,
+    score INTEGER DEFAULT 0,
+    runtime INTEGER DEFAULT 0,
+    problem_version INTEGER,
+    replaced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- What went wrong behind a verdict: the signal or exit code of a runtime error, or the judge's failure
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS status_detail TEXT;
+ALTER TABLE submission_verdicts ADD COLUMN IF NOT EXISTS status_detail TEXT;
+
+-- Peak memory of each submission over its testcases, in kilobytes
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS memory INTEGER DEFAULT 0;
+ALTER TABLE submission_verdicts ADD COLUMN IF NOT EXISTS memory INTEGER DEFAULT 0;
+
+-- Verdict of a submission on each testcase it ran on
+CREATE TABLE IF NOT EXISTS submission_results (
+    submission_id INTEGER REFERENCES submissions(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL, -- 1-based, in testcase order
+    testcase_id INTEGER REFERENCES testcases(id) ON DELETE SET NULL,
+    status VARCHAR(50) NOT NULL,
+    status_detail TEXT,
+    runtime INTEGER DEFAULT 0, -- milliseconds
+    memory INTEGER DEFAULT 0, -- kilobytes
+    PRIMARY KEY (submission_id, position)
+);
+
+-- Until when a server's claim on a queued submission it is judging lasts
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS judge_lease_until TIMESTAMP;
+
+-- Problem version each submission was judged against
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS problem_version INTEGER;
+UPDATE submissions SET problem_version = 1 WHERE problem_version IS NULL;
+
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_submissions_user_contest ON submissions(user_id, contest_id);
 CREATE INDEX IF NOT EXISTS idx_submissions_problem ON submissions(problem_id);
 CREATE INDEX IF NOT EXISTS idx_submissions_status ON submissions(status);
 CREATE INDEX IF NOT EXISTS idx_leaderboard_contest ON leaderboard_cache(contest_id);
-CREATE INDEX IF NOT EXISTS idx_problems_contest ON problems(contest_id);
-
+CREATE INDEX IF NOT EXISTS idx_leaderboard_cells_problem ON leaderboard_cells(contest_id, problem_id);
+CREATE INDEX IF NOT EXISTS idx_submissions_contest_user_problem ON submissions(contest_id, user_id, problem_id);
+CREATE INDEX IF NOT EXISTS idx_contest_problems_problem ON contest_problems(problem_id);
+CREATE INDEX IF NOT EXISTS idx_problems_public ON problems(is_public) WHERE is_public;
+CREATE INDEX IF NOT EXISTS idx_clarifications_contest ON clarifications(contest_id);
+CREATE INDEX IF NOT EXISTS idx_announcements_contest ON announcements(contest_id);
+CREATE INDEX IF NOT EXISTS idx_users_rating ON users(rating DESC) WHERE rating IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_testcases_problem ON testcases(problem_id);
+CREATE INDEX IF NOT EXISTS idx_submissions_problem_version ON submissions(problem_id, problem_version);
+CREATE INDEX IF NOT EXISTS idx_problem_programs_problem ON problem_programs(problem_id);
+CREATE INDEX IF NOT EXISTS idx_problem_verifications_problem ON problem_verifications(problem_id);
+CREATE INDEX IF NOT EXISTS idx_problem_generations_problem ON problem_generations(problem_id);
+CREATE INDEX IF NOT EXISTS idx_submission_verdicts_submission ON submission_verdicts(submission_id);
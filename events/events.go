@@ -0,0 +1,163 @@
+package events
+
+import (
+	"codesprint/database"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres channel events are relayed on between instances
+const notifyChannel = "codesprint_events"
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it
+const subscriberBuffer = 16
+
+// Event is a message published on a topic
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Broker fans out published events to in-process subscribers
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[string]map[chan Event]struct{}{}}
+}
+
+// Subscribe registers for events on a topic. The returned function must be
+// called to unsubscribe.
+func (b *Broker) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = map[chan Event]struct{}{}
+	}
+	b.subscribers[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers[topic], ch)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Deliver hands an event to the local subscribers of its topic without blocking
+func (b *Broker) Deliver(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[ev.Topic] {
+		select {
+		case ch <- ev:
+		default:
+			// Subscriber is not keeping up; it will resync on its next fetch
+		}
+	}
+}
+
+var (
+	defaultBroker = NewBroker()
+
+	// relayMu guards relayViaPostgres
+	relayMu          sync.RWMutex
+	relayViaPostgres bool
+)
+
+// UserTopic is the topic carrying a user's submission updates
+func UserTopic(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// ContestTopic is the topic carrying a contest's standings updates
+func ContestTopic(contestID int) string {
+	return fmt.Sprintf("contest:%d", contestID)
+}
+
+// Subscribe registers for events on a topic of the default broker
+func Subscribe(topic string) (<-chan Event, func()) {
+	return defaultBroker.Subscribe(topic)
+}
+
+// Publish sends an event to every subscriber of a topic. When the Postgres
+// relay is running the event goes through NOTIFY, so subscribers on every
+// backend instance (including this one) receive it.
+func Publish(topic, eventType string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("events: failed to marshal %s event: %v", eventType, err)
+		return
+	}
+	ev := Event{Topic: topic, Type: eventType, Data: data}
+
+	relayMu.RLock()
+	relay := relayViaPostgres
+	relayMu.RUnlock()
+
+	if !relay {
+		defaultBroker.Deliver(ev)
+		return
+	}
+
+	message, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("events: failed to marshal %s event: %v", eventType, err)
+		return
+	}
+	if _, err := database.DB.Exec("SELECT pg_notify($1, $2)", notifyChannel, string(message)); err != nil {
+		// Fall back to at least reaching this instance's subscribers
+		log.Printf("events: NOTIFY failed, delivering locally: %v", err)
+		defaultBroker.Deliver(ev)
+	}
+}
+
+// ListenPostgres relays events between backend instances through Postgres
+// LISTEN/NOTIFY. After it returns successfully, Publish goes through NOTIFY.
+func ListenPostgres(connStr string) error {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("events: listener: %v", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen on %s: %w", notifyChannel, err)
+	}
+
+	go func() {
+		for n := range listener.Notify {
+			if n == nil {
+				// Reconnected; events sent while disconnected are lost and
+				// clients resync on their next fetch
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(n.Extra), &ev); err != nil {
+				log.Printf("events: invalid notification: %v", err)
+				continue
+			}
+			defaultBroker.Deliver(ev)
+		}
+	}()
+
+	relayMu.Lock()
+	relayViaPostgres = true
+	relayMu.Unlock()
+	return nil
+}
@@ -4,6 +4,9 @@ let authToken = localStorage.getItem('authToken');
 let currentUser = null;
 let currentContestId = null;
 let leaderboardInterval = null;
+let leaderboardStream = null;
+let submissionStream = null;
+const watchedSubmissions = new Set();
 
 // Initialize app
 document.addEventListener('DOMContentLoaded', () => {
@@ -123,9 +126,56 @@ function logout() {
     document.getElementById('admin-btn').style.display = 'none';
     document.getElementById('user-info').style.display = 'none';
     showView('home');
+    stopLeaderboardUpdates();
+    if (submissionStream) {
+        submissionStream.close();
+        submissionStream = null;
+    }
+}
+
+// Live updates: Server-Sent Events, with polling where unsupported
+function stopLeaderboardUpdates() {
     if (leaderboardInterval) {
         clearInterval(leaderboardInterval);
+        leaderboardInterval = null;
+    }
+    if (leaderboardStream) {
+        leaderboardStream.close();
+        leaderboardStream = null;
+    }
+}
+
+function watchLeaderboard(contestId) {
+    stopLeaderboardUpdates();
+    if (!window.EventSource) {
+        // Auto-refresh leaderboard every 10 seconds
+        leaderboardInterval = setInterval(() => loadLeaderboard(contestId), 10000);
+        return;
+    }
+    leaderboardStream = new EventSource(`${API_BASE}/events/contest/${contestId}`);
+    leaderboardStream.addEventListener('standings', () => loadLeaderboard(contestId));
+    leaderboardStream.addEventListener('announcement', (e) => {
+        const container = document.getElementById('announcements');
+        container.insertBefore(renderAnnouncement(JSON.parse(e.data)), container.firstChild);
+    });
+}
+
+function ensureSubmissionStream() {
+    if (!window.EventSource || submissionStream) {
+        return submissionStream !== null;
     }
+    submissionStream = new EventSource(`${API_BASE}/events/submissions?token=${encodeURIComponent(authToken)}`);
+    submissionStream.addEventListener('submission', (e) => {
+        const submission = JSON.parse(e.data);
+        if (!watchedSubmissions.has(submission.submission_id)) {
+            return;
+        }
+        if (submission.status !== 'pending' && submission.status !== 'running') {
+            watchedSubmissions.delete(submission.submission_id);
+            showSubmissionResult(submission.submission_id, submission);
+        }
+    });
+    return true;
 }
 
 // Contests
@@ -174,6 +224,7 @@ async function openContest(contestId) {
 
     currentContestId = contestId;
     showView('contest');
+    ensureSubmissionStream();
     
     try {
         const [contest, problems] = await Promise.all([
@@ -184,19 +235,29 @@ async function openContest(contestId) {
         ]);
 
         document.getElementById('contest-title').textContent = contest.title;
+        displayAnnouncements(contest.announcements || []);
         displayProblems(problems);
         loadLeaderboard(contestId);
         
-        // Auto-refresh leaderboard every 10 seconds
-        if (leaderboardInterval) {
-            clearInterval(leaderboardInterval);
-        }
-        leaderboardInterval = setInterval(() => loadLeaderboard(contestId), 10000);
+        watchLeaderboard(contestId);
     } catch (error) {
         console.error('Error loading contest:', error);
     }
 }
 
+function displayAnnouncements(announcements) {
+    const container = document.getElementById('announcements');
+    container.innerHTML = '';
+    announcements.forEach(announcement => container.appendChild(renderAnnouncement(announcement)));
+}
+
+function renderAnnouncement(announcement) {
+    const div = document.createElement('div');
+    div.className = 'alert alert-info';
+    div.textContent = `${new Date(announcement.created_at).toLocaleString()}: ${announcement.message}`;
+    return div;
+}
+
 function displayProblems(problems) {
     const container = document.getElementById('problems-list');
     container.innerHTML = '<h4>Problems</h4>';
@@ -206,7 +267,7 @@ function displayProblems(problems) {
         card.className = 'card problem-card';
         card.innerHTML = `
             <div class="card-body">
-                <h5 class="card-title">${problem.title}</h5>
+                <h5 class="card-title">${problem.label ? problem.label + '. ' : ''}${problem.title}</h5>
                 <p class="card-text">Time Limit: ${problem.time_limit}ms | Memory Limit: ${problem.memory_limit}MB</p>
                 <button class="btn btn-primary" onclick="viewProblem(${problem.id})">View Problem</button>
             </div>
@@ -223,6 +284,7 @@ async function viewProblem(problemId) {
         const detailDiv = document.getElementById('problem-detail');
         detailDiv.innerHTML = `
             <h4>${problem.title}</h4>
+            ${problem.interactive ? '<p class="text-muted">Interactive problem: flush your output after every line.</p>' : ''}
             <div class="problem-statement">${problem.statement}</div>
             <button class="btn btn-success" onclick="showSubmissionForm(${problem.id})">Submit Solution</button>
         `;
@@ -252,18 +314,14 @@ async function viewProblem(problemId) {
     }
 }
 
-function showSubmissionForm(problemId) {
+async function showSubmissionForm(problemId) {
     const formDiv = document.getElementById('submission-form');
     formDiv.innerHTML = `
         <h4>Submit Solution</h4>
         <form id="code-submission-form">
             <div class="mb-3">
                 <label for="language" class="form-label">Language</label>
-                <select class="form-select" id="language" required>
-                    <option value="c">C</option>
-                    <option value="cpp">C++</option>
-                    <option value="python3">Python 3</option>
-                </select>
+                <select class="form-select" id="language" required></select>
             </div>
             <div class="mb-3">
                 <label for="code" class="form-label">Code</label>
@@ -273,6 +331,39 @@ function showSubmissionForm(problemId) {
         </form>
     `;
     formDiv.style.display = 'block';
+
+    // Contests may allow only some languages, function-style problems take
+    // only the languages they have graders for and start the code from the
+    // signature template
+    try {
+        const languagesURL = currentContestId
+            ? `${API_BASE}/languages?contest_id=${currentContestId}`
+            : `${API_BASE}/languages`;
+        const [languages, problem] = await Promise.all([
+            fetch(languagesURL).then(response => response.json()),
+            fetch(`${API_BASE}/problem/${problemId}`).then(response => response.json()),
+        ]);
+        const select = document.getElementById('language');
+        const code = document.getElementById('code');
+        languages
+            .filter(language => !problem.languages || problem.languages.includes(language.name))
+            .forEach(language => {
+                const option = document.createElement('option');
+                option.value = language.name;
+                option.textContent = language.display_name;
+                select.appendChild(option);
+            });
+        const templates = problem.templates || {};
+        const fillTemplate = () => {
+            if (templates[select.value] && (code.value === '' || Object.values(templates).includes(code.value))) {
+                code.value = templates[select.value];
+            }
+        };
+        select.addEventListener('change', fillTemplate);
+        fillTemplate();
+    } catch (error) {
+        console.error('Error loading templates:', error);
+    }
     
     document.getElementById('code-submission-form').addEventListener('submit', (e) => {
         e.preventDefault();
@@ -302,8 +393,12 @@ async function submitCode(problemId) {
         const data = await response.json();
         if (response.ok) {
             alert(`Submission received! ID: ${data.submission_id}. Status: ${data.status}`);
-            // Poll for result
-            pollSubmissionResult(data.submission_id);
+            if (ensureSubmissionStream()) {
+                watchedSubmissions.add(data.submission_id);
+            } else {
+                // Poll for result
+                pollSubmissionResult(data.submission_id);
+            }
         } else {
             alert(data.error || 'Submission failed');
         }
@@ -322,10 +417,7 @@ async function pollSubmissionResult(submissionId) {
             const submission = await response.json();
             
             if (submission.status !== 'pending' && submission.status !== 'running') {
-                alert(`Submission ${submissionId}: ${submission.status.toUpperCase()}\nScore: ${submission.score}\nRuntime: ${submission.runtime}ms`);
-                if (currentContestId) {
-                    loadLeaderboard(currentContestId);
-                }
+                showSubmissionResult(submissionId, submission);
                 return;
             }
             
@@ -343,6 +435,14 @@ async function pollSubmissionResult(submissionId) {
     poll();
 }
 
+function showSubmissionResult(submissionId, submission) {
+    const detail = submission.status_detail ? ` (${submission.status_detail})` : '';
+    alert(`Submission ${submissionId}: ${submission.status.toUpperCase()}${detail}\nScore: ${submission.score}\nRuntime: ${submission.runtime}ms${submission.memory ? `\nMemory: ${submission.memory} KB` : ''}`);
+    if (currentContestId) {
+        loadLeaderboard(currentContestId);
+    }
+}
+
 async function loadLeaderboard(contestId) {
     try {
         const response = await fetch(`${API_BASE}/leaderboard/${contestId}`);
@@ -355,24 +455,50 @@ async function loadLeaderboard(contestId) {
 
 function displayLeaderboard(leaderboard) {
     const container = document.getElementById('leaderboard');
-    container.innerHTML = '<h4>Leaderboard</h4><div class="leaderboard">';
-    
-    if (leaderboard.length === 0) {
-        container.innerHTML += '<p>No submissions yet</p></div>';
+    container.innerHTML = '<h4>Leaderboard</h4>';
+
+    const entries = leaderboard.entries || [];
+    if (entries.length === 0) {
+        container.innerHTML += '<p>No submissions yet</p>';
         return;
     }
 
-    leaderboard.forEach((entry, index) => {
-        const entryDiv = document.createElement('div');
-        entryDiv.className = 'leaderboard-entry';
-        entryDiv.innerHTML = `
-            <strong>#${index + 1}</strong> ${entry.user_name}<br>
-            Solved: ${entry.solved_count} | Penalty: ${entry.penalty} minutes
-        `;
-        container.querySelector('.leaderboard').appendChild(entryDiv);
+    const problems = leaderboard.problems || [];
+    let html = '<table class="table table-sm leaderboard"><thead><tr><th>#</th><th>Name</th><th>Solved</th><th>Penalty</th>';
+    problems.forEach((problem, idx) => {
+        html += `<th title="${problem.title}">${problem.label || String.fromCharCode(65 + idx)}</th>`;
     });
-    
-    container.innerHTML += '</div>';
+    html += '</tr></thead><tbody>';
+
+    entries.forEach((entry, index) => {
+        html += `<tr><td>${index + 1}</td><td>${entry.user_name}</td><td>${entry.solved_count}</td><td>${entry.penalty}</td>`;
+        (entry.problems || []).forEach(cell => {
+            html += renderLeaderboardCell(cell);
+        });
+        html += '</tr>';
+    });
+
+    html += '<tr class="leaderboard-summary"><td></td><td>Accepted / Tries</td><td></td><td></td>';
+    problems.forEach(problem => {
+        html += `<td>${problem.accepted_count}/${problem.attempts}</td>`;
+    });
+    html += '</tr></tbody></table>';
+
+    container.innerHTML += html;
+}
+
+function renderLeaderboardCell(cell) {
+    if (cell.solved) {
+        const className = cell.first_to_solve ? 'cell-first-solve' : 'cell-solved';
+        return `<td class="${className}">+${cell.attempts > 1 ? cell.attempts - 1 : ''}<br><small>${cell.solve_minute}</small></td>`;
+    }
+    if (cell.pending) {
+        return `<td class="cell-pending">?${cell.attempts > 0 ? cell.attempts : ''}</td>`;
+    }
+    if (cell.attempts > 0) {
+        return `<td class="cell-failed">-${cell.attempts}</td>`;
+    }
+    return '<td></td>';
 }
 
 // Admin functions
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"database/sql"
+)
+
+// isAdmin reports whether a user has the admin role
+func isAdmin(userID int) bool {
+	var admin bool
+	err := database.DB.QueryRow(
+		"SELECT COALESCE(is_admin, FALSE) FROM users WHERE id = $1",
+		userID,
+	).Scan(&admin)
+	return err == nil && admin
+}
+
+// canManageContest reports whether a user may modify a contest: its creator or an admin.
+// It returns sql.ErrNoRows when the contest does not exist.
+func canManageContest(userID, contestID int) (bool, error) {
+	var createdBy sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT created_by FROM contests WHERE id = $1",
+		contestID,
+	).Scan(&createdBy)
+	if err != nil {
+		return false, err
+	}
+	if createdBy.Valid && int(createdBy.Int64) == userID {
+		return true, nil
+	}
+	return isAdmin(userID), nil
+}
+
+// canManageProblem reports whether a user may modify a library problem: its
+// author or an admin. It returns sql.ErrNoRows when the problem does not exist.
+func canManageProblem(userID, problemID int) (bool, error) {
+	var createdBy sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT created_by FROM problems WHERE id = $1",
+		problemID,
+	).Scan(&createdBy)
+	if err != nil {
+		return false, err
+	}
+	if createdBy.Valid && int(createdBy.Int64) == userID {
+		return true, nil
+	}
+	return isAdmin(userID), nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/events"
+	"codesprint/models"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateAnnouncement handles posting an announcement to a contest (owner or admin only)
+func CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can post announcements", http.StatusForbidden)
+		return
+	}
+
+	var req models.CreateAnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Message == "" {
+		http.Error(w, "Message is required", http.StatusBadRequest)
+		return
+	}
+	if ok, err := contestHasProblem(contestID, req.ProblemID); err != nil || !ok {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+
+	announcement := models.Announcement{
+		ContestID: contestID,
+		ProblemID: req.ProblemID,
+		Message:   req.Message,
+		CreatedBy: userID,
+	}
+	err = database.DB.QueryRow(
+		"INSERT INTO announcements (contest_id, problem_id, message, created_by) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		contestID, req.ProblemID, req.Message, userID,
+	).Scan(&announcement.ID, &announcement.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to create announcement", http.StatusInternalServerError)
+		return
+	}
+
+	events.Publish(events.ContestTopic(contestID), "announcement", announcement)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(announcement)
+}
+
+// GetAnnouncements returns a contest's announcements, newest first
+func GetAnnouncements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	announcements, err := loadAnnouncements(contestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch announcements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(announcements)
+}
+
+// loadAnnouncements returns a contest's announcements, newest first
+func loadAnnouncements(contestID int) ([]models.Announcement, error) {
+	rows, err := database.DB.Query(
+		"SELECT id, contest_id, problem_id, message, created_by, created_at FROM announcements WHERE contest_id = $1 ORDER BY created_at DESC",
+		contestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []models.Announcement
+	for rows.Next() {
+		var a models.Announcement
+		if err := rows.Scan(&a.ID, &a.ContestID, &a.ProblemID, &a.Message, &a.CreatedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+	return announcements, rows.Err()
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/problempkg"
+	"codesprint/storage"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// checkerExitMarker prefixes the line the run script prints with the
+// checker's exit code
+const checkerExitMarker = "__checker_exit "
+
+// checkerCPULimit is the CPU time, in seconds, a checker or validator gets per testcase
+const checkerCPULimit = 10
+
+// runnableProgram is a loaded problem program with the support files it is
+// built with
+type runnableProgram struct {
+	Name     string
+	Language string
+	Kind     string
+	Files    []judge.File // source under its toolchain name, plus resources
+}
+
+// judgingPrograms are the problem programs that take part in judging a run
+type judgingPrograms struct {
+	Checker    *runnableProgram            // nil when output is compared exactly
+	Interactor *runnableProgram            // set for interactive problems
+	Graders    map[string]*runnableProgram // by language, set for function-style problems
+}
+
+// loadJudgingPrograms returns the checker, interactor and graders of one
+// version of a problem
+func loadJudgingPrograms(tx *sql.Tx, problemID, version int) (judgingPrograms, error) {
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		return judgingPrograms{}, err
+	}
+	return judgingFromPrograms(programs)
+}
+
+// judgingFromPrograms loads the programs that take part in judging from a
+// version's programs
+func judgingFromPrograms(programs []models.ProblemProgram) (judgingPrograms, error) {
+	var judging judgingPrograms
+	var err error
+	if judging.Checker, err = loadRunnable(programs, programChecker); err != nil {
+		return judging, err
+	}
+	if judging.Interactor, err = loadRunnable(programs, programInteractor); err != nil {
+		return judging, err
+	}
+	for _, p := range programs {
+		if p.Role != programGrader {
+			continue
+		}
+		grader, err := loadGrader(programs, p)
+		if err != nil {
+			return judging, err
+		}
+		if judging.Graders == nil {
+			judging.Graders = map[string]*runnableProgram{}
+		}
+		judging.Graders[p.Language] = grader
+	}
+	return judging, nil
+}
+
+// loadRunnable loads the program with the given role from a version's
+// programs. It returns nil when the version has no such program.
+func loadRunnable(programs []models.ProblemProgram, role string) (*runnableProgram, error) {
+	for _, p := range programs {
+		if p.Role == role {
+			return loadProgram(programs, p)
+		}
+	}
+	return nil, nil
+}
+
+// loadProgram loads the source of one of a version's programs along with the
+// version's support files
+func loadProgram(programs []models.ProblemProgram, program models.ProblemProgram) (*runnableProgram, error) {
+	source, err := storage.ReadString(program.SourceHash)
+	if err != nil {
+		return nil, fmt.Errorf("program %d: %w", program.ID, err)
+	}
+	runnable := &runnableProgram{Name: program.Name, Language: program.Language, Kind: program.Kind}
+	runnable.Files = append(runnable.Files, judge.File{Name: programSourceName(program.Language), Data: []byte(source)})
+	for _, p := range programs {
+		if p.Role == programResource {
+			source, err := storage.ReadString(p.SourceHash)
+			if err != nil {
+				return nil, fmt.Errorf("program %d: %w", p.ID, err)
+			}
+			runnable.Files = append(runnable.Files, judge.File{Name: p.Name, Data: []byte(source)})
+		}
+	}
+	return runnable, nil
+}
+
+// runChecker asks a problem's checker for the verdict on a program's output
+// for a testcase: accepted, wrong_answer or, from testlib checkers,
+// presentation_error
+func runChecker(ctx context.Context, checker *runnableProgram, tc models.Testcase, output string) (string, error) {
+	toolchain, ok := judge.ToolchainFor(checker.Language)
+	if !ok {
+		return "", fmt.Errorf("unsupported checker language %q", checker.Language)
+	}
+	input, err := readTestcaseData(openTestcaseInput(tc))
+	if err != nil {
+		return "", err
+	}
+	answer, err := readTestcaseData(openTestcaseOutput(tc))
+	if err != nil {
+		return "", err
+	}
+	files := append([]judge.File{
+		{Name: "input.txt", Data: input},
+		{Name: "answer.txt", Data: answer},
+	}, checker.Files...)
+
+	// The program's output arrives on stdin; the script reports the checker's
+	// exit code on stdout, where neither protocol writes anything else
+	var run string
+	switch checker.Kind {
+	case problempkg.CheckerKattis:
+		run = "mkdir -p feedback\n" + toolchain.Run + " input.txt answer.txt feedback/\necho \"" + checkerExitMarker + "$?\""
+	default:
+		run = "cat > output.txt\n" + toolchain.Run + " input.txt output.txt answer.txt\necho \"" + checkerExitMarker + "$?\""
+	}
+
+	code, _, err := runForExitCode(ctx, toolchain, files, run, output)
+	if err != nil {
+		return "", fmt.Errorf("checker %w", err)
+	}
+	switch checker.Kind {
+	case problempkg.CheckerKattis:
+		switch code {
+		case 42:
+			return judge.VerdictAccepted, nil
+		case 43:
+			return judge.VerdictWrongAnswer, nil
+		}
+	default:
+		// testlib: 0 ok, 1 wrong answer, 2 presentation error
+		switch code {
+		case 0:
+			return judge.VerdictAccepted, nil
+		case 1:
+			return judge.VerdictWrongAnswer, nil
+		case 2:
+			return judge.VerdictPresentationError, nil
+		}
+	}
+	return "", fmt.Errorf("checker failed with exit code %d", code)
+}
+
+// runForExitCode runs a problem program's script with the default executor
+// and returns the exit code the script reported along with the program's
+// stderr
+func runForExitCode(ctx context.Context, toolchain judge.Toolchain, files []judge.File, run, stdin string) (int, string, error) {
+	result, err := judge.Default.RunMultiFile(ctx, judge.MultiFileRun{
+		Files:   files,
+		Compile: toolchain.Compile,
+		Run:     run,
+		Stdin:   stdin,
+		Limits:  judge.Limits{CPUTime: checkerCPULimit},
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	if result.Status == nil || result.Status.ID != 3 {
+		description := "no status"
+		if result.Status != nil {
+			description = result.Status.Description
+		}
+		return 0, "", fmt.Errorf("run failed: %s %s", description, result.CompileOutput)
+	}
+	code, ok := checkerExitCode(result.Stdout)
+	if !ok {
+		return 0, "", fmt.Errorf("did not report an exit code")
+	}
+	return code, result.Stderr, nil
+}
+
+// checkerExitCode finds the exit code the run script printed
+func checkerExitCode(stdout string) (int, bool) {
+	i := strings.LastIndex(stdout, checkerExitMarker)
+	if i < 0 {
+		return 0, false
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(stdout[i+len(checkerExitMarker):]))
+	return code, err == nil
+}
+
+// readTestcaseData reads testcase data that a checker run needs in full
+func readTestcaseData(rc io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
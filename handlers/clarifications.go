@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/events"
+	"codesprint/models"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateClarification handles a participant's question about a contest or one of its problems
+func CreateClarification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateClarificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	if req.Question == "" {
+		http.Error(w, "Question is required", http.StatusBadRequest)
+		return
+	}
+	if ok, err := contestHasProblem(contestID, req.ProblemID); err != nil || !ok {
+		http.Error(w, "Contest or problem not found", http.StatusNotFound)
+		return
+	}
+
+	var clarification models.Clarification
+	err = database.DB.QueryRow(
+		"INSERT INTO clarifications (contest_id, problem_id, user_id, question) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		contestID, req.ProblemID, userID, req.Question,
+	).Scan(&clarification.ID, &clarification.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to create clarification", http.StatusInternalServerError)
+		return
+	}
+	clarification.ContestID = contestID
+	clarification.ProblemID = req.ProblemID
+	clarification.UserID = userID
+	clarification.Question = req.Question
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clarification)
+}
+
+// GetClarifications returns a contest's clarifications: all of them for the
+// contest owner and admins, otherwise the caller's own and the public ones
+func GetClarifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	judge, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch clarifications", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT c.id, c.contest_id, c.problem_id, c.user_id, u.name, c.question, c.answer, c.is_public, c.answered_at, c.created_at
+		FROM clarifications c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.contest_id = $1 AND ($2 OR c.user_id = $3 OR c.is_public)
+		ORDER BY c.created_at DESC
+	`, contestID, judge, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch clarifications", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var clarifications []models.Clarification
+	for rows.Next() {
+		var c models.Clarification
+		err := rows.Scan(&c.ID, &c.ContestID, &c.ProblemID, &c.UserID, &c.UserName, &c.Question, &c.Answer, &c.IsPublic, &c.AnsweredAt, &c.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if !judge && c.UserID != userID {
+			// Participants do not see who asked public questions
+			c.UserID = 0
+			c.UserName = ""
+		}
+		clarifications = append(clarifications, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clarifications)
+}
+
+// AnswerClarification handles a judge's answer to a clarification (contest owner or admin only)
+func AnswerClarification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clarificationID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid clarification ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AnswerClarificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Answer == "" {
+		http.Error(w, "Answer is required", http.StatusBadRequest)
+		return
+	}
+
+	var c models.Clarification
+	err = database.DB.QueryRow(
+		"SELECT id, contest_id, problem_id, user_id, question FROM clarifications WHERE id = $1",
+		clarificationID,
+	).Scan(&c.ID, &c.ContestID, &c.ProblemID, &c.UserID, &c.Question)
+	if err != nil {
+		http.Error(w, "Clarification not found", http.StatusNotFound)
+		return
+	}
+
+	allowed, err := canManageContest(userID, c.ContestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can answer clarifications", http.StatusForbidden)
+		return
+	}
+
+	err = database.DB.QueryRow(`
+		UPDATE clarifications SET answer = $1, is_public = $2, answered_by = $3, answered_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING answer, is_public, answered_at, created_at
+	`, req.Answer, req.Broadcast, userID, clarificationID).Scan(&c.Answer, &c.IsPublic, &c.AnsweredAt, &c.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to answer clarification", http.StatusInternalServerError)
+		return
+	}
+
+	// Deliver to the asker, or to every participant when broadcast
+	if c.IsPublic {
+		public := c
+		public.UserID = 0
+		events.Publish(events.ContestTopic(c.ContestID), "clarification", public)
+	}
+	events.Publish(events.UserTopic(c.UserID), "clarification", c)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// GetUnreadMessages returns how many announcements and answered clarifications
+// of a contest the caller has not read yet
+func GetUnreadMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := contestHasProblem(contestID, nil)
+	if err != nil {
+		http.Error(w, "Failed to fetch unread messages", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+
+	var announcements, clarifications int
+	err = database.DB.QueryRow(`
+		WITH last_read AS (
+			SELECT COALESCE(
+				(SELECT last_read_at FROM contest_message_reads WHERE contest_id = $1 AND user_id = $2),
+				'-infinity'::timestamp
+			) AS at
+		)
+		SELECT
+			(SELECT COUNT(*) FROM announcements, last_read
+				WHERE contest_id = $1 AND created_at > last_read.at),
+			(SELECT COUNT(*) FROM clarifications, last_read
+				WHERE contest_id = $1 AND answered_at > last_read.at AND (user_id = $2 OR is_public))
+	`, contestID, userID).Scan(&announcements, &clarifications)
+	if err != nil {
+		http.Error(w, "Failed to fetch unread messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"contest_id":     contestID,
+		"announcements":  announcements,
+		"clarifications": clarifications,
+	})
+}
+
+// MarkMessagesRead marks all current announcements and clarifications of a contest as read by the caller
+func MarkMessagesRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := contestHasProblem(contestID, nil)
+	if err != nil {
+		http.Error(w, "Failed to mark messages read", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO contest_message_reads (contest_id, user_id, last_read_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (contest_id, user_id) DO UPDATE SET last_read_at = EXCLUDED.last_read_at
+	`, contestID, userID)
+	if err != nil {
+		http.Error(w, "Failed to mark messages read", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"contest_id": contestID,
+		"read":       true,
+	})
+}
+
+// contestHasProblem reports whether a contest exists and, when problemID is
+// set, whether that problem belongs to it
+func contestHasProblem(contestID int, problemID *int) (bool, error) {
+	var exists bool
+	var err error
+	if problemID == nil {
+		err = database.DB.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM contests WHERE id = $1)",
+			contestID,
+		).Scan(&exists)
+	} else {
+		err = database.DB.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM contest_problems WHERE problem_id = $1 AND contest_id = $2)",
+			*problemID, contestID,
+		).Scan(&exists)
+	}
+	return exists, err
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/standings"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// errLabelTaken is returned when a contest already has a problem with the requested label
+var errLabelTaken = errors.New("label already used in this contest")
+
+// maxLabelLength is the longest label a problem can have in a contest
+const maxLabelLength = 10
+
+// AttachContestProblem adds a library problem to a contest. The caller must
+// manage the contest, and the problem must be public or manageable by them.
+func AttachContestProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AttachProblemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var label *string
+	if req.Label != "" {
+		label = &req.Label
+	}
+	if message := contestProblemError(label, req.Points, req.Position); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeContestProblems(w, userID, contestID) {
+		return
+	}
+
+	var isPublic bool
+	err = database.DB.QueryRow("SELECT is_public FROM problems WHERE id = $1", req.ProblemID).Scan(&isPublic)
+	if err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	if !isPublic {
+		allowed, err := canManageProblem(userID, req.ProblemID)
+		if err != nil {
+			http.Error(w, "Failed to fetch problem", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Only public problems or your own problems can be added to a contest", http.StatusForbidden)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to add problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var attached bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM contest_problems WHERE contest_id = $1 AND problem_id = $2)",
+		contestID, req.ProblemID,
+	).Scan(&attached)
+	if err != nil {
+		http.Error(w, "Failed to add problem", http.StatusInternalServerError)
+		return
+	}
+	if attached {
+		http.Error(w, "Problem is already part of this contest", http.StatusConflict)
+		return
+	}
+
+	link, err := attachProblem(tx, contestID, req)
+	if err == errLabelTaken {
+		http.Error(w, "Label is already used in this contest", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to add problem", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to add problem", http.StatusInternalServerError)
+		return
+	}
+
+	if err := standings.Rebuild(contestID); err != nil {
+		fmt.Printf("contest %d: failed to rebuild standings: %v\n", contestID, err)
+	}
+	publishStandings(contestID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// UpdateContestProblem changes a problem's label, points or position within a contest
+func UpdateContestProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+	problemID, err := strconv.Atoi(vars["problem_id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateContestProblemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if message := contestProblemError(req.Label, req.Points, req.Position); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeContestProblems(w, userID, contestID) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	link := models.ContestProblem{ContestID: contestID, ProblemID: problemID}
+	err = tx.QueryRow(
+		"SELECT label, points, position FROM contest_problems WHERE contest_id = $1 AND problem_id = $2 FOR UPDATE",
+		contestID, problemID,
+	).Scan(&link.Label, &link.Points, &link.Position)
+	if err != nil {
+		http.Error(w, "Problem not found in this contest", http.StatusNotFound)
+		return
+	}
+
+	if req.Label != nil && *req.Label != link.Label {
+		taken, err := labelTaken(tx, contestID, *req.Label)
+		if err != nil {
+			http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			http.Error(w, "Label is already used in this contest", http.StatusConflict)
+			return
+		}
+		link.Label = *req.Label
+	}
+	if req.Points != nil {
+		link.Points = *req.Points
+	}
+	if req.Position != nil {
+		link.Position = *req.Position
+	}
+
+	_, err = tx.Exec(
+		"UPDATE contest_problems SET label = $1, points = $2, position = $3 WHERE contest_id = $4 AND problem_id = $5",
+		link.Label, link.Points, link.Position, contestID, problemID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
+
+	if err := standings.Rebuild(contestID); err != nil {
+		fmt.Printf("contest %d: failed to rebuild standings: %v\n", contestID, err)
+	}
+	publishStandings(contestID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// DetachContestProblem removes a problem from a contest. The problem stays in
+// the library; problems that already have submissions in the contest cannot
+// be removed.
+func DetachContestProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+	problemID, err := strconv.Atoi(vars["problem_id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeContestProblems(w, userID, contestID) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to remove problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var submissionCount int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM submissions WHERE contest_id = $1 AND problem_id = $2",
+		contestID, problemID,
+	).Scan(&submissionCount)
+	if err != nil {
+		http.Error(w, "Failed to remove problem", http.StatusInternalServerError)
+		return
+	}
+	if submissionCount > 0 {
+		http.Error(w, "Problem already has submissions in this contest", http.StatusConflict)
+		return
+	}
+
+	res, err := tx.Exec("DELETE FROM contest_problems WHERE contest_id = $1 AND problem_id = $2", contestID, problemID)
+	if err != nil {
+		http.Error(w, "Failed to remove problem", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Problem not found in this contest", http.StatusNotFound)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to remove problem", http.StatusInternalServerError)
+		return
+	}
+
+	if err := standings.Rebuild(contestID); err != nil {
+		fmt.Printf("contest %d: failed to rebuild standings: %v\n", contestID, err)
+	}
+	publishStandings(contestID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeContestProblems checks that the user may change a contest's problem
+// set, writing the error response and returning false when not
+func authorizeContestProblems(w http.ResponseWriter, userID, contestID int) bool {
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can change this contest's problems", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// attachProblem links a problem into a contest, filling in the next free
+// label, default points and the last position when not given
+func attachProblem(tx *sql.Tx, contestID int, req models.AttachProblemRequest) (*models.ContestProblem, error) {
+	link := models.ContestProblem{
+		ContestID: contestID,
+		ProblemID: req.ProblemID,
+		Label:     req.Label,
+		Points:    100,
+	}
+	if req.Points != nil {
+		link.Points = *req.Points
+	}
+
+	if req.Position != nil {
+		link.Position = *req.Position
+	} else {
+		err := tx.QueryRow(
+			"SELECT COALESCE(MAX(position) + 1, 0) FROM contest_problems WHERE contest_id = $1",
+			contestID,
+		).Scan(&link.Position)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if link.Label == "" {
+		// First unused label in A, B, ..., Z, AA, AB, ...
+		for n := 0; ; n++ {
+			taken, err := labelTaken(tx, contestID, problemLabel(n))
+			if err != nil {
+				return nil, err
+			}
+			if !taken {
+				link.Label = problemLabel(n)
+				break
+			}
+		}
+	} else if taken, err := labelTaken(tx, contestID, link.Label); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, errLabelTaken
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO contest_problems (contest_id, problem_id, label, points, position) VALUES ($1, $2, $3, $4, $5)",
+		contestID, link.ProblemID, link.Label, link.Points, link.Position,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// contestProblemError returns why a label, points or position given for a
+// problem in a contest are invalid, or "" when they are valid; nil values
+// were not given
+func contestProblemError(label *string, points, position *int) string {
+	switch {
+	case label != nil && *label == "":
+		return "Label must not be empty"
+	case label != nil && utf8.RuneCountInString(*label) > maxLabelLength:
+		return fmt.Sprintf("Label must be at most %d characters", maxLabelLength)
+	case points != nil && *points <= 0:
+		return "Points must be positive"
+	case position != nil && *position < 0:
+		return "Position must not be negative"
+	}
+	return ""
+}
+
+// labelTaken reports whether a contest already uses a label
+func labelTaken(tx *sql.Tx, contestID int, label string) (bool, error) {
+	var taken bool
+	err := tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM contest_problems WHERE contest_id = $1 AND label = $2)",
+		contestID, label,
+	).Scan(&taken)
+	return taken, err
+}
+
+// problemLabel returns the spreadsheet-style label of the n-th problem (0-based):
+// A..Z, then AA, AB, ...
+func problemLabel(n int) string {
+	label := ""
+	for n++; n > 0; n = (n - 1) / 26 {
+		label = string(rune('A'+(n-1)%26)) + label
+	}
+	return label
+}
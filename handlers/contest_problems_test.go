@@ -0,0 +1,52 @@
+package handlers
+
+import "testing"
+
+func TestContestProblemError(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	tests := []struct {
+		name     string
+		label    *string
+		points   *int
+		position *int
+		want     string
+	}{
+		{"nothing given", nil, nil, nil, ""},
+		{"all valid", str("A1"), num(100), num(0), ""},
+		{"empty label", str(""), nil, nil, "Label must not be empty"},
+		{"longest label", str("ABCDEFGHIJ"), nil, nil, ""},
+		{"label too long", str("ABCDEFGHIJK"), nil, nil, "Label must be at most 10 characters"},
+		{"label counted in characters", str("ÀÉÎÕÜÀÉÎÕÜ"), nil, nil, ""},
+		{"zero points", nil, num(0), nil, "Points must be positive"},
+		{"negative points", nil, num(-5), nil, "Points must be positive"},
+		{"negative position", nil, nil, num(-1), "Position must not be negative"},
+	}
+	for _, tt := range tests {
+		if got := contestProblemError(tt.label, tt.points, tt.position); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProblemLabel(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "A"},
+		{1, "B"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := problemLabel(tt.n); got != tt.want {
+			t.Errorf("problemLabel(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
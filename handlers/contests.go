@@ -3,12 +3,18 @@ package handlers
 import (
 	"codesprint/database"
 	"codesprint/models"
+	"codesprint/standings"
 	"codesprint/utils"
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
 // CreateContest handles contest creation (admin only)
@@ -40,12 +46,17 @@ func CreateContest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "End time must be after start time", http.StatusBadRequest)
 		return
 	}
+	allowedLanguages, err := normalizeLanguages(req.AllowedLanguages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Create contest
 	var contestID int
-	err := database.DB.QueryRow(
-		"INSERT INTO contests (title, start_time, end_time, created_by) VALUES ($1, $2, $3, $4) RETURNING id",
-		req.Title, req.StartTime, req.EndTime, userID,
+	err = database.DB.QueryRow(
+		"INSERT INTO contests (title, start_time, end_time, created_by, is_draft, is_rated, allowed_languages) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		req.Title, req.StartTime, req.EndTime, userID, req.IsDraft, req.IsRated, pq.Array(allowedLanguages),
 	).Scan(&contestID)
 	if err != nil {
 		http.Error(w, "Failed to create contest", http.StatusInternalServerError)
@@ -54,14 +65,17 @@ func CreateContest(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":         contestID,
-		"title":      req.Title,
-		"start_time": req.StartTime,
-		"end_time":   req.EndTime,
+		"id":                contestID,
+		"title":             req.Title,
+		"start_time":        req.StartTime,
+		"end_time":          req.EndTime,
+		"is_draft":          req.IsDraft,
+		"is_rated":          req.IsRated,
+		"allowed_languages": allowedLanguages,
 	})
 }
 
-// GetContests returns all contests
+// GetContests returns all published contests
 func GetContests(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -69,8 +83,9 @@ func GetContests(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := database.DB.Query(`
-		SELECT id, title, start_time, end_time, created_by, created_at 
-		FROM contests 
+		SELECT id, title, start_time, end_time, created_by, is_draft, is_rated, finalized_at, allowed_languages, created_at
+		FROM contests
+		WHERE NOT is_draft
 		ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -82,7 +97,7 @@ func GetContests(w http.ResponseWriter, r *http.Request) {
 	var contests []models.Contest
 	for rows.Next() {
 		var contest models.Contest
-		err := rows.Scan(&contest.ID, &contest.Title, &contest.StartTime, &contest.EndTime, &contest.CreatedBy, &contest.CreatedAt)
+		err := rows.Scan(&contest.ID, &contest.Title, &contest.StartTime, &contest.EndTime, &contest.CreatedBy, &contest.IsDraft, &contest.IsRated, &contest.FinalizedAt, pq.Array(&contest.AllowedLanguages), &contest.CreatedAt)
 		if err != nil {
 			http.Error(w, "Failed to scan contest", http.StatusInternalServerError)
 			return
@@ -115,15 +130,430 @@ func GetContest(w http.ResponseWriter, r *http.Request) {
 
 	var contest models.Contest
 	err = database.DB.QueryRow(
-		"SELECT id, title, start_time, end_time, created_by, created_at FROM contests WHERE id = $1",
+		"SELECT id, title, start_time, end_time, created_by, is_draft, is_rated, finalized_at, allowed_languages, created_at FROM contests WHERE id = $1",
 		contestID,
-	).Scan(&contest.ID, &contest.Title, &contest.StartTime, &contest.EndTime, &contest.CreatedBy, &contest.CreatedAt)
+	).Scan(&contest.ID, &contest.Title, &contest.StartTime, &contest.EndTime, &contest.CreatedBy, &contest.IsDraft, &contest.IsRated, &contest.FinalizedAt, pq.Array(&contest.AllowedLanguages), &contest.CreatedAt)
 	if err != nil {
 		http.Error(w, "Contest not found", http.StatusNotFound)
 		return
 	}
 
+	contest.Announcements, err = loadAnnouncements(contestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch announcements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contest)
+}
+
+// UpdateContest handles contest updates (owner or admin only). PUT replaces
+// every editable field, PATCH changes only the fields present in the body.
+func UpdateContest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can modify this contest", http.StatusForbidden)
+		return
+	}
+
+	var req models.UpdateContestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPut && (req.Title == nil || req.StartTime == nil || req.EndTime == nil) {
+		http.Error(w, "Title, start_time and end_time are required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update contest", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var contest models.Contest
+	err = tx.QueryRow(
+		"SELECT id, title, start_time, end_time, created_by, is_draft, is_rated, finalized_at, allowed_languages, created_at FROM contests WHERE id = $1 FOR UPDATE",
+		contestID,
+	).Scan(&contest.ID, &contest.Title, &contest.StartTime, &contest.EndTime, &contest.CreatedBy, &contest.IsDraft, &contest.IsRated, &contest.FinalizedAt, pq.Array(&contest.AllowedLanguages), &contest.CreatedAt)
+	if err != nil {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+
+	startTime, endTime, isRated := contest.StartTime, contest.EndTime, contest.IsRated
+	if req.Title != nil {
+		contest.Title = *req.Title
+	}
+	if req.StartTime != nil {
+		contest.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		contest.EndTime = *req.EndTime
+	}
+	if req.IsDraft != nil {
+		contest.IsDraft = *req.IsDraft
+	} else if r.Method == http.MethodPut {
+		contest.IsDraft = false
+	}
+	if req.IsRated != nil {
+		contest.IsRated = *req.IsRated
+	} else if r.Method == http.MethodPut {
+		contest.IsRated = false
+	}
+	if req.AllowedLanguages != nil {
+		contest.AllowedLanguages, err = normalizeLanguages(*req.AllowedLanguages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if r.Method == http.MethodPut {
+		contest.AllowedLanguages = nil
+	}
+
+	// Validate input
+	if contest.Title == "" {
+		http.Error(w, "Title is required", http.StatusBadRequest)
+		return
+	}
+	if contest.EndTime.Before(contest.StartTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+
+	timesChanged := !contest.StartTime.Equal(startTime) || !contest.EndTime.Equal(endTime)
+	if contest.FinalizedAt != nil && (timesChanged || contest.IsRated != isRated) {
+		http.Error(w, "Contest results are final; times and rating cannot be changed", http.StatusConflict)
+		return
+	}
+	if timesChanged {
+		conflict, err := checkContestWindow(tx, contestID, contest.StartTime, contest.EndTime)
+		if err != nil {
+			http.Error(w, "Failed to validate contest times", http.StatusInternalServerError)
+			return
+		}
+		if conflict != "" {
+			http.Error(w, conflict, http.StatusConflict)
+			return
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE contests SET title = $1, start_time = $2, end_time = $3, is_draft = $4, is_rated = $5, allowed_languages = $6 WHERE id = $7",
+		contest.Title, contest.StartTime, contest.EndTime, contest.IsDraft, contest.IsRated, pq.Array(contest.AllowedLanguages), contestID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to update contest", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update contest", http.StatusInternalServerError)
+		return
+	}
+
+	// Penalties are measured from the start time, so the standings must follow it
+	if timesChanged {
+		if err := standings.Rebuild(contestID); err != nil {
+			fmt.Printf("contest %d: failed to rebuild standings: %v\n", contestID, err)
+		}
+		publishStandings(contestID)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(contest)
 }
 
+// checkContestWindow returns a non-empty reason when a contest's times cannot
+// be changed to [startTime, endTime] without invalidating its submissions.
+// Official submissions must stay inside the window. Practice and virtual
+// submissions, made after the contest ended, must stay after it, so their
+// is_practice flags never need recomputing.
+func checkContestWindow(tx *sql.Tx, contestID int, startTime, endTime time.Time) (string, error) {
+	var judging int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM submissions WHERE contest_id = $1 AND status IN ('pending', 'running')",
+		contestID,
+	).Scan(&judging)
+	if err != nil {
+		return "", err
+	}
+	if judging > 0 {
+		return "Contest times cannot be changed while submissions are being judged", nil
+	}
+
+	var first, last, firstAfter sql.NullTime
+	err = tx.QueryRow(`
+		SELECT MIN(created_at) FILTER (WHERE virtual_participation_id IS NULL AND NOT is_practice),
+			MAX(created_at) FILTER (WHERE virtual_participation_id IS NULL AND NOT is_practice),
+			MIN(created_at) FILTER (WHERE virtual_participation_id IS NOT NULL OR is_practice)
+		FROM submissions WHERE contest_id = $1
+	`, contestID).Scan(&first, &last, &firstAfter)
+	if err != nil {
+		return "", err
+	}
+	if first.Valid && first.Time.Before(startTime) {
+		return "Start time cannot be later than the first submission", nil
+	}
+	if last.Valid && last.Time.After(endTime) {
+		return "End time cannot be earlier than the last submission", nil
+	}
+	if firstAfter.Valid && !firstAfter.Time.After(endTime) {
+		return "End time cannot be later than the first practice or virtual submission", nil
+	}
+	return "", nil
+}
+
+// DeleteContest handles contest deletion (owner or admin only). A contest
+// with submissions can only be deleted by an admin passing force=true,
+// which deletes the submissions too.
+func DeleteContest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can delete this contest", http.StatusForbidden)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete contest", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Ratings applied by a finalized rated contest depend on it, so it stays
+	var ratingsApplied bool
+	err = tx.QueryRow(
+		"SELECT is_rated AND finalized_at IS NOT NULL FROM contests WHERE id = $1 FOR UPDATE",
+		contestID,
+	).Scan(&ratingsApplied)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete contest", http.StatusInternalServerError)
+		return
+	}
+	if ratingsApplied {
+		http.Error(w, "Contest is finalized and rated; it cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	var submissionCount int
+	err = tx.QueryRow("SELECT COUNT(*) FROM submissions WHERE contest_id = $1", contestID).Scan(&submissionCount)
+	if err != nil {
+		http.Error(w, "Failed to delete contest", http.StatusInternalServerError)
+		return
+	}
+	if submissionCount > 0 {
+		if !force || !isAdmin(userID) {
+			http.Error(w, "Contest has submissions; an admin must pass force=true to delete it", http.StatusConflict)
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM submissions WHERE contest_id = $1", contestID); err != nil {
+			http.Error(w, "Failed to delete submissions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Problem links and standings cascade; the problems stay in the library
+	if _, err := tx.Exec("DELETE FROM contests WHERE id = $1", contestID); err != nil {
+		http.Error(w, "Failed to delete contest", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete contest", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":                  contestID,
+		"deleted":             true,
+		"deleted_submissions": submissionCount,
+	})
+}
+
+// CloneContest copies a contest and its problem set into a new draft contest
+// owned by the caller (owner or admin only). The clone uses the same library
+// problems with the same labels and points.
+func CloneContest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can clone this contest", http.StatusForbidden)
+		return
+	}
+
+	// The body is optional
+	var req models.CloneContestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to clone contest", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var source models.Contest
+	err = tx.QueryRow(
+		"SELECT id, title, start_time, end_time, is_rated, allowed_languages FROM contests WHERE id = $1",
+		contestID,
+	).Scan(&source.ID, &source.Title, &source.StartTime, &source.EndTime, &source.IsRated, pq.Array(&source.AllowedLanguages))
+	if err != nil {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+
+	clone := models.Contest{
+		Title:     req.Title,
+		StartTime: source.StartTime,
+		EndTime:   source.EndTime,
+		CreatedBy: userID,
+		IsDraft:   true,
+		IsRated:   source.IsRated,
+	}
+	clone.AllowedLanguages = source.AllowedLanguages
+	if clone.Title == "" {
+		clone.Title = "Copy of " + source.Title
+	}
+	if req.StartTime != nil {
+		// Keep the source's duration unless an end time is given too
+		clone.StartTime = *req.StartTime
+		clone.EndTime = req.StartTime.Add(source.EndTime.Sub(source.StartTime))
+	}
+	if req.EndTime != nil {
+		clone.EndTime = *req.EndTime
+	}
+	if clone.EndTime.Before(clone.StartTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+
+	err = tx.QueryRow(
+		"INSERT INTO contests (title, start_time, end_time, created_by, is_draft, is_rated, allowed_languages) VALUES ($1, $2, $3, $4, TRUE, $5, $6) RETURNING id, created_at",
+		clone.Title, clone.StartTime, clone.EndTime, userID, clone.IsRated, pq.Array(clone.AllowedLanguages),
+	).Scan(&clone.ID, &clone.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to clone contest", http.StatusInternalServerError)
+		return
+	}
+
+	problemCount, err := cloneContestProblems(tx, contestID, clone.ID)
+	if err != nil {
+		http.Error(w, "Failed to clone problems", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to clone contest", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"contest":       clone,
+		"source_id":     contestID,
+		"problem_count": problemCount,
+	})
+}
+
+// cloneContestProblems links every problem of a contest into another contest
+// and returns how many problems were linked
+func cloneContestProblems(tx *sql.Tx, fromContestID, toContestID int) (int, error) {
+	res, err := tx.Exec(`
+		INSERT INTO contest_problems (contest_id, problem_id, label, points, position)
+		SELECT $1, problem_id, label, points, position FROM contest_problems WHERE contest_id = $2
+	`, toContestID, fromContestID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
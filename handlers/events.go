@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"codesprint/events"
+	"codesprint/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sseKeepAlive is how often a comment line is sent on idle streams so that
+// proxies do not close them
+const sseKeepAlive = 25 * time.Second
+
+// StreamSubmissions streams verdict changes of the current user's submissions
+func StreamSubmissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	streamTopic(w, r, events.UserTopic(userID))
+}
+
+// StreamContest streams standings changes of a contest
+func StreamContest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["contest_id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	streamTopic(w, r, events.ContestTopic(contestID))
+}
+
+// streamTopic writes the events of a topic as Server-Sent Events until the
+// client disconnects
+func streamTopic(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := events.Subscribe(topic)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case ev := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+			flusher.Flush()
+		}
+	}
+}
+
+// publishSubmission notifies the submitter and the contest's leaderboard
+// viewers that a submission changed
+func publishSubmission(submissionID, userID, contestID, problemID int, status, detail string, score, runtime int) {
+	events.Publish(events.UserTopic(userID), "submission", map[string]interface{}{
+		"submission_id": submissionID,
+		"contest_id":    contestID,
+		"problem_id":    problemID,
+		"status":        status,
+		"status_detail": detail,
+		"score":         score,
+		"runtime":       runtime,
+	})
+	if contestID != 0 {
+		publishStandings(contestID)
+	}
+}
+
+// publishStandings notifies a contest's leaderboard viewers that its standings changed
+func publishStandings(contestID int) {
+	events.Publish(events.ContestTopic(contestID), "standings", map[string]interface{}{
+		"contest_id": contestID,
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/storage"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// loadGrader loads a grader, its source stored under the grader name of its
+// language's grader toolchain
+func loadGrader(programs []models.ProblemProgram, program models.ProblemProgram) (*runnableProgram, error) {
+	toolchain, ok := judge.GraderToolchainFor(program.Language)
+	if !ok {
+		return nil, fmt.Errorf("program %d: no grader toolchain for %q", program.ID, program.Language)
+	}
+	grader, err := loadProgram(programs, program)
+	if err != nil {
+		return nil, err
+	}
+	grader.Files[0].Name = toolchain.Grader
+	return grader, nil
+}
+
+// runWithGrader runs a contestant's solution built together with the
+// problem's grader for its language, with the default executor. The time
+// limit is in milliseconds and the memory limit in megabytes.
+func runWithGrader(ctx context.Context, code, language string, graders map[string]*runnableProgram, stdin string, timeLimit, memoryLimit int) (*judge.Judge0Response, error) {
+	toolchain, ok := judge.GraderToolchainFor(language)
+	l, _ := judge.LookupLanguage(language)
+	grader := graders[l.Name]
+	if !ok || grader == nil {
+		return nil, fmt.Errorf("no grader for language %q", language)
+	}
+	files := append([]judge.File{{Name: toolchain.Source, Data: []byte(code)}}, grader.Files...)
+	return judge.Default.RunMultiFile(ctx, judge.MultiFileRun{
+		Files:   files,
+		Compile: toolchain.Compile,
+		Run:     toolchain.Run,
+		Stdin:   stdin,
+		Limits:  judge.Limits{CPUTime: float64(timeLimit) / 1000, Memory: memoryLimit * 1024},
+	})
+}
+
+// graderLanguages lists the languages a function-style problem has graders for
+func graderLanguages(graders map[string]*runnableProgram) string {
+	languages := make([]string, 0, len(graders))
+	for language := range graders {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return strings.Join(languages, ", ")
+}
+
+// loadProblemTemplates returns the languages a version of a problem has
+// graders for, and the signature templates contestants start from. Both are
+// empty for problems that read stdin.
+func loadProblemTemplates(problemID, version int) ([]string, map[string]string, error) {
+	rows, err := database.DB.Query(`
+		SELECT role, language, source_hash
+		FROM problem_programs
+		WHERE problem_id = $1 AND role IN ('grader', 'template')
+			AND added_in_version <= $2 AND (removed_in_version IS NULL OR removed_in_version > $2)
+		ORDER BY language
+	`, problemID, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var languages []string
+	var templates map[string]string
+	for rows.Next() {
+		var role, language, hash string
+		if err := rows.Scan(&role, &language, &hash); err != nil {
+			return nil, nil, err
+		}
+		if role == programGrader {
+			languages = append(languages, language)
+			continue
+		}
+		source, err := storage.ReadString(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if templates == nil {
+			templates = map[string]string{}
+		}
+		templates[language] = source
+	}
+	return languages, templates, rows.Err()
+}
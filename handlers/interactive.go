@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/problempkg"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// judgeInteractive runs a program against the problem's interactor on one
+// testcase. A solution that ran out of time gets time_limit_exceeded, since
+// the interactor rejects a solution cut off mid-dialogue, and one over the
+// memory limit gets memory_limit_exceeded; otherwise the interactor's exit
+// code decides, and a solution that crashed without being
+// rejected gets runtime_error. Failures of the judge or of the interactor
+// itself get judge_error.
+func judgeInteractive(ctx context.Context, code, language string, tc models.Testcase, interactor *runnableProgram, timeLimit, memoryLimit int) testcaseResult {
+	lang, ok := judge.LookupLanguage(language)
+	if !ok || lang.Run == "" {
+		return judgeFailure(tc, fmt.Errorf("language %q cannot run interactively", language))
+	}
+	input, err := readTestcaseData(openTestcaseInput(tc))
+	if err != nil {
+		return judgeFailure(tc, err)
+	}
+	answer, err := readTestcaseData(openTestcaseOutput(tc))
+	if err != nil {
+		return judgeFailure(tc, err)
+	}
+
+	// testlib interactors write a log to their output file; Kattis ones take
+	// a feedback directory
+	args := []string{"input.txt", "output.txt", "answer.txt"}
+	if interactor.Kind == problempkg.CheckerKattis {
+		args = []string{"input.txt", "answer.txt", "."}
+	}
+	result, err := judge.Default.RunInteractive(ctx, judge.InteractiveRun{
+		Solution: judge.Program{
+			Language: language,
+			Files:    []judge.File{{Name: lang.Source(), Data: []byte(lang.PrepareSource(code))}},
+		},
+		Interactor: judge.Program{
+			Language: interactor.Language,
+			Files: append([]judge.File{
+				{Name: "input.txt", Data: input},
+				{Name: "answer.txt", Data: answer},
+			}, interactor.Files...),
+		},
+		InteractorArgs:      args,
+		TimeLimit:           float64(timeLimit) / 1000,
+		MemoryLimit:         memoryLimit * 1024,
+		InteractorTimeLimit: checkerCPULimit,
+	})
+	if err != nil {
+		return judgeFailure(tc, fmt.Errorf("interactive run: %w", err))
+	}
+	if result.CompileOutput != "" {
+		return testcaseResult{Testcase: tc, Status: judge.VerdictCompilationError}
+	}
+
+	verdict := testcaseResult{Testcase: tc, Runtime: result.Runtime, Memory: result.Memory}
+	accepted, rejected := result.InteractorExit == 0, result.InteractorExit == 1 || result.InteractorExit == 2
+	if interactor.Kind == problempkg.CheckerKattis {
+		accepted, rejected = result.InteractorExit == 42, result.InteractorExit == 43
+	}
+	switch {
+	case result.TimedOut:
+		verdict.Status = judge.VerdictTimeLimitExceeded
+	case memoryExceeded(result.Memory, memoryLimit):
+		verdict.Status = judge.VerdictMemoryLimitExceeded
+	case rejected:
+		verdict.Status = judge.VerdictWrongAnswer
+		if interactor.Kind != problempkg.CheckerKattis && result.InteractorExit == 2 {
+			verdict.Status = judge.VerdictPresentationError
+		}
+	case result.SolutionExit > 0:
+		verdict.Status, verdict.Detail = judge.VerdictRuntimeError, fmt.Sprintf("exit code %d", result.SolutionExit)
+	case result.SolutionExit != 0:
+		verdict.Status, verdict.Detail = judge.VerdictRuntimeError, "killed by a signal"
+	case accepted:
+		verdict.Status = judge.VerdictAccepted
+	default:
+		message := strings.TrimSpace(result.InteractorStderr)
+		if len(message) > maxValidatorMessage {
+			message = message[:maxValidatorMessage]
+		}
+		verdict.Status, verdict.Err = judge.VerdictJudgeError, fmt.Errorf("interactor failed with exit code %d: %s", result.InteractorExit, message)
+	}
+	return verdict
+}
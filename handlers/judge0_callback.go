@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"codesprint/judge"
+	"errors"
+	"net/http"
+)
+
+// maxCallbackBody bounds a callback: base64 output within Judge0's own limits
+const maxCallbackBody = 256 << 20
+
+// Judge0Callback receives a finished submission from Judge0. The callback URL
+// carries the batch the submission belongs to and its signature, since Judge0
+// cannot authenticate itself otherwise.
+func Judge0Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	err := judge.Judge0.HandleCallback(query.Get("batch"), query.Get("signature"), http.MaxBytesReader(w, r.Body, maxCallbackBody))
+	if errors.Is(err, judge.ErrInvalidCallback) {
+		http.Error(w, "Invalid callback signature", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid callback body", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
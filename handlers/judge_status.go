@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"codesprint/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// judgeRetryDelay is the least time a submission waits before it is
+	// judged again after the judge was unavailable
+	judgeRetryDelay = 10 * time.Second
+	// judgeQueueTimeout is how long a submission stays queued for an
+	// unavailable judge before it gets judge_error
+	judgeQueueTimeout = 30 * time.Minute
+	// judgeLease is how long a server's claim on a submission it judges
+	// lasts; the claim is renewed while judging goes on, so only the
+	// submissions of a server that stopped can be claimed by another
+	judgeLease = 5 * time.Minute
+)
+
+// unavailableJudge0 returns the Judge0 server judging failed on because it
+// could not be reached, so the submission should stay queued rather than get
+// a verdict; nil when judging did not fail that way or Judge0 does not run
+// the submission's language
+func unavailableJudge0(language string, results []testcaseResult) *judge.Judge0Client {
+	l, ok := judge.LookupLanguage(language)
+	if !ok {
+		return nil
+	}
+	client := judge.Default.Judge0For(l)
+	if client == nil {
+		return nil
+	}
+	for _, result := range results {
+		if errors.Is(result.Err, judge.ErrUnavailable) {
+			return client
+		}
+	}
+	return nil
+}
+
+// keepClaim renews this server's claim on submissions until the returned
+// function is called; those judged meanwhile are no longer claimed
+func keepClaim(submissionIDs ...int) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(judgeLease / 5)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := database.DB.Exec(
+					"UPDATE submissions SET judge_lease_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second' WHERE id = ANY($1) AND status IN ('pending', 'running')",
+					pq.Array(submissionIDs), judgeLease.Seconds(),
+				)
+				if err != nil {
+					fmt.Printf("submissions %v: failed to renew judging claim: %v\n", submissionIDs, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ResumeQueuedSubmissions claims and judges again the submissions left
+// pending, e.g. by a restart while they were queued for an unavailable
+// judge. Submissions another server is judging are left to it.
+func ResumeQueuedSubmissions() error {
+	rows, err := database.DB.Query(`
+		UPDATE submissions SET judge_lease_until = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE status IN ('pending', 'running')
+			AND (judge_lease_until IS NULL OR judge_lease_until < CURRENT_TIMESTAMP)
+		RETURNING id
+	`, judgeLease.Seconds())
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sort.Ints(ids)
+	for _, id := range ids {
+		if err := startJudging(id); err != nil {
+			fmt.Printf("submission %d: failed to resume judging: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+// StartResumingQueuedSubmissions resumes queued submissions now and then
+// every half lease in the background, so those whose server stopped while
+// it held their claim are judged once the claim runs out
+func StartResumingQueuedSubmissions() {
+	go func() {
+		for {
+			if err := ResumeQueuedSubmissions(); err != nil {
+				fmt.Printf("Failed to resume queued submissions: %v\n", err)
+			}
+			time.Sleep(judgeLease / 2)
+		}
+	}()
+}
+
+// startJudging judges a stored submission this server has claimed in the
+// background against the problem version it was made for
+func startJudging(submissionID int) error {
+	judgeSubmission, err := storedSubmission(submissionID)
+	if err != nil {
+		return err
+	}
+	go judgeSubmission()
+	return nil
+}
+
+// judgeInOrder judges stored submissions this server has claimed one after
+// another in the background, so a large rejudge does not take over the
+// judge, then calls done if it is not nil. The claim on those still waiting
+// is renewed meanwhile.
+func judgeInOrder(ids []int, done func()) {
+	go func() {
+		defer keepClaim(ids...)()
+		for _, id := range ids {
+			judgeSubmission, err := storedSubmission(id)
+			if err != nil {
+				fmt.Printf("submission %d: failed to load for judging: %v\n", id, err)
+				continue
+			}
+			judgeSubmission()
+		}
+		if done != nil {
+			done()
+		}
+	}()
+}
+
+// storedSubmission loads a stored submission with its problem version's
+// testcases and judging programs, returning the function that judges it
+func storedSubmission(submissionID int) (func(), error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var code, language, policy string
+	var problemID, version, timeLimit, memoryLimit int
+	err = tx.QueryRow(`
+		SELECT s.code, s.language, s.problem_id, s.problem_version, COALESCE(v.time_limit, p.time_limit), COALESCE(v.memory_limit, p.memory_limit), COALESCE(v.judging_policy, p.judging_policy)
+		FROM submissions s
+		JOIN problems p ON p.id = s.problem_id
+		LEFT JOIN problem_versions v ON v.problem_id = s.problem_id AND v.version = s.problem_version
+		WHERE s.id = $1
+	`, submissionID).Scan(&code, &language, &problemID, &version, &timeLimit, &memoryLimit, &policy)
+	if err != nil {
+		return nil, err
+	}
+	testcases, err := loadVersionTestcases(tx, problemID, version)
+	if err != nil {
+		return nil, err
+	}
+	judging, err := loadJudgingPrograms(tx, problemID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		processSubmission(submissionID, code, language, testcases, judging, timeLimit, memoryLimit, policy)
+	}, nil
+}
+
+// GetJudgeHealth reports the state of the judge and its queue (admin only)
+func GetJudgeHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !isAdmin(userID) {
+		http.Error(w, "Only admins can view judge health", http.StatusForbidden)
+		return
+	}
+
+	var queued, judgeErrors int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE status IN ('pending', 'running')),
+			COUNT(*) FILTER (WHERE status = 'judge_error')
+		FROM submissions
+	`).Scan(&queued, &judgeErrors)
+	if err != nil {
+		http.Error(w, "Failed to count submissions", http.StatusInternalServerError)
+		return
+	}
+
+	executor := "judge0"
+	if _, ok := judge.Default.(*judge.LocalExecutor); ok {
+		executor = "local"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"executor":     executor,
+		"judge0":       judge.Judge0.Health(),
+		"queued":       queued,
+		"judge_errors": judgeErrors,
+	})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"codesprint/judge"
+	"codesprint/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Judging policies: how many testcases a submission runs on
+const (
+	policyStopAtFailure = "stop_at_first_failure" // ICPC: the verdict is the first failing testcase
+	policyRunAll        = "run_all"               // IOI: every testcase runs, for partial scores
+)
+
+// validJudgingPolicy reports whether a policy is known
+func validJudgingPolicy(policy string) bool {
+	return policy == policyStopAtFailure || policy == policyRunAll
+}
+
+// testcaseResult is the verdict of a program on one testcase
+type testcaseResult struct {
+	Testcase models.Testcase
+	Status   string
+	Runtime  int    // milliseconds
+	Memory   int    // peak, kilobytes
+	Detail   string // signal or exit code of a runtime error, or what failed in the judge
+	Err      error
+}
+
+// judgeTestcases runs a program on a set of testcases, up to
+// judge.Parallelism at a time, and returns their verdicts in order. With
+// stopAtFailure the results end at the first failing testcase: later ones
+// are not started once a testcase fails, and those still running are
+// cancelled as soon as every earlier testcase has its verdict.
+func judgeTestcases(code, language string, testcases []models.Testcase, judging judgingPrograms, timeLimit, memoryLimit int, stopAtFailure bool) []testcaseResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := &testcaseRun{results: make([]*testcaseResult, len(testcases)), failAt: len(testcases), stopAtFailure: stopAtFailure, cancel: cancel}
+
+	lang, ok := judge.LookupLanguage(language)
+	if !ok || judging.Interactor != nil || judging.Graders != nil {
+		// Interactive and function-style problems run testcase by testcase
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for w := 0; w < judge.Parallelism; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					run.finish(i, judgeTestcase(ctx, code, language, testcases[i], judging, timeLimit, memoryLimit))
+				}
+			}()
+		}
+		for i := range testcases {
+			if ctx.Err() != nil || run.skip(i) {
+				break
+			}
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+		return run.ordered(testcases, nil)
+	}
+
+	inputs := make([]judge.Input, len(testcases))
+	for i, tc := range testcases {
+		tc := tc
+		inputs[i] = func() (io.ReadCloser, error) { return openTestcaseInput(tc) }
+	}
+	// Outputs are checked as runs finish, so a slow checker does not hold up
+	// the runs
+	var checks sync.WaitGroup
+	err := judge.Default.RunBatch(ctx, lang, code, judge.Batch{
+		Inputs: inputs,
+		Limits: judge.Limits{CPUTime: float64(lang.TimeLimit(timeLimit)) / 1000, Memory: memoryLimit * 1024},
+		Skip:   run.skip,
+		Done: func(i int, result *judge.Judge0Response) {
+			checks.Add(1)
+			go func() {
+				defer checks.Done()
+				run.finish(i, checkRun(ctx, result, testcases[i], judging, memoryLimit))
+			}()
+		},
+	})
+	checks.Wait()
+	if ctx.Err() != nil {
+		// Cancelled because the verdict was already known
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("run error: %w", err)
+	}
+	return run.ordered(testcases, err)
+}
+
+// testcaseRun collects the verdicts of a judgeTestcases call as they arrive
+type testcaseRun struct {
+	mu            sync.Mutex
+	results       []*testcaseResult
+	failAt        int // first failing testcase so far
+	stopAtFailure bool
+	cancel        func()
+}
+
+// skip reports whether a testcase need not start: with stopAtFailure, one
+// after a testcase that already failed
+func (r *testcaseRun) skip(i int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopAtFailure && i > r.failAt
+}
+
+func (r *testcaseRun) finish(i int, result testcaseResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[i] = &result
+	if !r.stopAtFailure {
+		return
+	}
+	if result.Status != "accepted" && i < r.failAt {
+		r.failAt = i
+	}
+	if r.failAt == len(r.results) {
+		return
+	}
+	for _, earlier := range r.results[:r.failAt] {
+		if earlier == nil {
+			return
+		}
+	}
+	r.cancel()
+}
+
+// ordered returns the verdicts in testcase order, up to the first failure
+// with stopAtFailure. Testcases left without a verdict by a failure of the
+// judge get judge_error with err.
+func (r *testcaseRun) ordered(testcases []models.Testcase, err error) []testcaseResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		err = errors.New("testcase was not judged")
+	}
+	var results []testcaseResult
+	for i, result := range r.results {
+		if result == nil {
+			failure := judgeFailure(testcases[i], err)
+			result = &failure
+		}
+		results = append(results, *result)
+		if r.stopAtFailure && result.Status != "accepted" {
+			break
+		}
+	}
+	return results
+}
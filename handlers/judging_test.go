@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"codesprint/judge"
+	"codesprint/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidJudgingPolicy(t *testing.T) {
+	for policy, want := range map[string]bool{
+		"stop_at_first_failure": true,
+		"run_all":               true,
+		"":                      false,
+		"RUN_ALL":               false,
+		"ioi":                   false,
+	} {
+		if got := validJudgingPolicy(policy); got != want {
+			t.Errorf("validJudgingPolicy(%q) = %v, want %v", policy, got, want)
+		}
+	}
+}
+
+// finished is a verdict arriving for testcase i
+type finished struct {
+	i      int
+	status string
+}
+
+func TestTestcaseRun(t *testing.T) {
+	const ac, wa = judge.VerdictAccepted, judge.VerdictWrongAnswer
+	runErr := errors.New("run error: Judge0 unavailable")
+	tests := []struct {
+		name          string
+		stopAtFailure bool
+		finished      []finished
+		err           error
+		cancelled     bool
+		skipped       []int    // testcases skip reports true for at the end
+		want          []string // statuses returned by ordered
+	}{
+		{
+			name:     "run all, out of order",
+			finished: []finished{{2, ac}, {0, ac}, {3, ac}, {1, ac}},
+			want:     []string{ac, ac, ac, ac},
+		},
+		{
+			name:     "run all keeps going after a failure",
+			finished: []finished{{0, ac}, {1, wa}, {2, ac}, {3, wa}},
+			want:     []string{ac, wa, ac, wa},
+		},
+		{
+			name:     "run all with a failed batch",
+			finished: []finished{{0, ac}, {1, wa}},
+			err:      runErr,
+			want:     []string{ac, wa, judge.VerdictJudgeError, judge.VerdictJudgeError},
+		},
+		{
+			name:          "stop after the earlier testcases pass",
+			stopAtFailure: true,
+			finished:      []finished{{0, ac}, {1, wa}},
+			cancelled:     true,
+			skipped:       []int{2, 3},
+			want:          []string{ac, wa},
+		},
+		{
+			name:          "stop once an earlier testcase catches up",
+			stopAtFailure: true,
+			finished:      []finished{{2, wa}, {0, ac}, {3, ac}, {1, ac}},
+			cancelled:     true,
+			skipped:       []int{3},
+			want:          []string{ac, ac, wa},
+		},
+		{
+			name:          "earlier failure replaces a later one",
+			stopAtFailure: true,
+			finished:      []finished{{2, wa}, {0, ac}, {1, judge.VerdictTimeLimitExceeded}},
+			cancelled:     true,
+			skipped:       []int{2, 3},
+			want:          []string{ac, judge.VerdictTimeLimitExceeded},
+		},
+		{
+			name:          "failure with an earlier testcase never judged",
+			stopAtFailure: true,
+			finished:      []finished{{1, wa}},
+			skipped:       []int{2, 3},
+			want:          []string{judge.VerdictJudgeError},
+		},
+		{
+			name:          "stop at failure, all accepted",
+			stopAtFailure: true,
+			finished:      []finished{{1, ac}, {0, ac}, {3, ac}, {2, ac}},
+			want:          []string{ac, ac, ac, ac},
+		},
+	}
+	for _, tt := range tests {
+		testcases := make([]models.Testcase, 4)
+		for i := range testcases {
+			testcases[i].ID = i + 1
+		}
+		cancelled := false
+		run := &testcaseRun{results: make([]*testcaseResult, len(testcases)), failAt: len(testcases), stopAtFailure: tt.stopAtFailure, cancel: func() { cancelled = true }}
+		for _, f := range tt.finished {
+			run.finish(f.i, testcaseResult{Testcase: testcases[f.i], Status: f.status})
+		}
+
+		if cancelled != tt.cancelled {
+			t.Errorf("%s: cancelled %v, want %v", tt.name, cancelled, tt.cancelled)
+		}
+		var skipped []int
+		for i := range testcases {
+			if run.skip(i) {
+				skipped = append(skipped, i)
+			}
+		}
+		if !reflect.DeepEqual(skipped, tt.skipped) {
+			t.Errorf("%s: skipped %v, want %v", tt.name, skipped, tt.skipped)
+		}
+		var got []string
+		for i, result := range run.ordered(testcases, tt.err) {
+			got = append(got, result.Status)
+			if result.Testcase.ID != i+1 {
+				t.Errorf("%s: result %d is for testcase %d", tt.name, i, result.Testcase.ID)
+			}
+			if result.Status == judge.VerdictJudgeError && (result.Err == nil || tt.err != nil && result.Err != tt.err) {
+				t.Errorf("%s: testcase %d failed with %v, want %v", tt.name, i+1, result.Err, tt.err)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// GetLanguages lists the languages submissions can be written in. With a
+// contest_id only those the contest allows are listed.
+func GetLanguages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	languages := judge.Languages()
+	if contestIDStr := r.URL.Query().Get("contest_id"); contestIDStr != "" {
+		contestID, err := strconv.Atoi(contestIDStr)
+		if err != nil {
+			http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+			return
+		}
+		var allowed []string
+		err = database.DB.QueryRow(
+			"SELECT allowed_languages FROM contests WHERE id = $1",
+			contestID,
+		).Scan(pq.Array(&allowed))
+		if err != nil {
+			http.Error(w, "Contest not found", http.StatusNotFound)
+			return
+		}
+		filtered := []judge.Language{}
+		for _, l := range languages {
+			if languageAllowed(allowed, l.Name) {
+				filtered = append(filtered, l)
+			}
+		}
+		languages = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(languages)
+}
+
+// normalizeLanguages resolves a contest's allowed languages to their
+// canonical names, dropping duplicates. An empty list becomes nil, which
+// allows every language.
+func normalizeLanguages(names []string) ([]string, error) {
+	var list []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		l, ok := judge.LookupLanguage(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown language %q", name)
+		}
+		if !seen[l.Name] {
+			seen[l.Name] = true
+			list = append(list, l.Name)
+		}
+	}
+	return list, nil
+}
+
+// languageAllowed reports whether a contest's allowed languages include a
+// language; nil allows every language
+func languageAllowed(allowed []string, language string) bool {
+	if allowed == nil {
+		return true
+	}
+	for _, name := range allowed {
+		if name == language {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLanguages(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+		err   string
+	}{
+		{nil, nil, ""},
+		{[]string{}, nil, ""},
+		{[]string{"c++", "python"}, []string{"cpp", "python3"}, ""},
+		{[]string{"cpp", "c++", "java", "cpp"}, []string{"cpp", "java"}, ""},
+		{[]string{"cpp", "cobol"}, nil, `Unknown language "cobol"`},
+	}
+	for _, tt := range tests {
+		got, err := normalizeLanguages(tt.names)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("normalizeLanguages(%q): error %v, want %q", tt.names, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeLanguages(%q) = %q, %v; want %q", tt.names, got, err, tt.want)
+		}
+	}
+}
+
+func TestLanguageAllowed(t *testing.T) {
+	tests := []struct {
+		allowed  []string
+		language string
+		want     bool
+	}{
+		{nil, "cpp", true},
+		{[]string{"cpp", "java"}, "java", true},
+		{[]string{"cpp", "java"}, "python3", false},
+		{[]string{}, "cpp", false},
+	}
+	for _, tt := range tests {
+		if got := languageAllowed(tt.allowed, tt.language); got != tt.want {
+			t.Errorf("languageAllowed(%q, %s) = %v, want %v", tt.allowed, tt.language, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
-	"codesprint/database"
-	"codesprint/models"
+	"codesprint/standings"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -29,46 +31,57 @@ func GetLeaderboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Recompute leaderboard from submissions
-	rows, err := database.DB.Query(`
-		SELECT 
-			u.id as user_id,
-			u.name as user_name,
-			COUNT(DISTINCT CASE WHEN s.status = 'accepted' THEN s.problem_id END) as solved_count,
-			COALESCE(SUM(CASE WHEN s.status = 'accepted' THEN 
-				EXTRACT(EPOCH FROM (s.created_at - c.start_time)) / 60 
-			END), 0)::INTEGER as penalty,
-			MAX(CASE WHEN s.status = 'accepted' THEN s.created_at END) as last_submission_time
-		FROM users u
-		LEFT JOIN submissions s ON u.id = s.user_id AND s.contest_id = $1
-		LEFT JOIN contests c ON c.id = $1
-		WHERE EXISTS (
-			SELECT 1 FROM submissions WHERE user_id = u.id AND contest_id = $1
-		)
-		GROUP BY u.id, u.name
-		ORDER BY solved_count DESC, penalty ASC, last_submission_time ASC
-	`, contestID)
+	// Contests whose standings were never built (e.g. no submissions since
+	// upgrading) are built on first read
+	if _, err := standings.Version(contestID); err == sql.ErrNoRows {
+		if err := standings.Rebuild(contestID); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Contest not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	version, err := standings.Version(contestID)
 	if err != nil {
 		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	etag := leaderboardETag(contestID, version)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-	var leaderboard []models.LeaderboardEntry
-	for rows.Next() {
-		var entry models.LeaderboardEntry
-		var lastSubmissionTime *string
-		err := rows.Scan(&entry.UserID, &entry.UserName, &entry.SolvedCount, &entry.Penalty, &lastSubmissionTime)
-		if err != nil {
-			continue
-		}
-		if lastSubmissionTime != nil {
-			// Parse time if needed
-		}
-		leaderboard = append(leaderboard, entry)
+	leaderboard, version, err := standings.Load(contestID)
+	if err != nil {
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", leaderboardETag(contestID, version))
 	json.NewEncoder(w).Encode(leaderboard)
 }
 
+func leaderboardETag(contestID int, version int64) string {
+	return fmt.Sprintf(`"lb-%d-%d"`, contestID, version)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
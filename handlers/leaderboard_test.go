@@ -0,0 +1,25 @@
+package handlers
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	etag := leaderboardETag(3, 42)
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`"lb-3-42"`, true},
+		{`W/"lb-3-42"`, true},
+		{`"lb-3-41", "lb-3-42"`, true},
+		{"*", true},
+		{`"lb-3-41"`, false},
+		{`"lb-4-42"`, false},
+		{`lb-3-42`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %s) = %v, want %v", tt.ifNoneMatch, etag, got, tt.want)
+		}
+	}
+}
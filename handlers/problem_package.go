@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/problempkg"
+	"codesprint/standings"
+	"codesprint/storage"
+	"codesprint/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// ImportProblem creates a library problem from a Kattis/ICPC or Polygon
+// package. The multipart form carries the zip in "package"; an optional
+// contest_id attaches the new problem to that contest.
+func ImportProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTestcaseArchiveSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Invalid multipart form or package too large", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	contestID := 0
+	if s := r.FormValue("contest_id"); s != "" {
+		var err error
+		if contestID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+			return
+		}
+		if !authorizeContestProblems(w, userID, contestID) {
+			return
+		}
+	}
+
+	file, header, err := r.FormFile("package")
+	if err != nil {
+		http.Error(w, "package file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	archive, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		http.Error(w, "package is not a valid zip file", http.StatusBadRequest)
+		return
+	}
+	pkg, err := problempkg.Read(archive)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Move tests and programs into blob storage before touching the database
+	blobs := make([][2]storage.Blob, len(pkg.Tests))
+	for i, test := range pkg.Tests {
+		for j, open := range []problempkg.Opener{test.Input, test.Answer} {
+			var invalid string
+			blobs[i][j], invalid, err = storePackageFile(test.Name, open)
+			if err != nil {
+				fmt.Printf("failed to store test %s of package: %v\n", test.Name, err)
+				http.Error(w, "Failed to store tests", http.StatusInternalServerError)
+				return
+			}
+			if invalid != "" {
+				http.Error(w, invalid, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	var programs []models.ProblemProgram
+	if pkg.Checker != nil {
+		blob, err := storage.Put(bytes.NewReader(pkg.Checker.Source))
+		if err != nil {
+			http.Error(w, "Failed to store checker", http.StatusInternalServerError)
+			return
+		}
+		programs = append(programs, models.ProblemProgram{
+			Role: programChecker, Name: pkg.Checker.Name, Language: pkg.Checker.Language, Kind: pkg.Checker.Kind,
+			SourceHash: blob.Hash, SourceSize: blob.Size,
+		})
+		for _, f := range pkg.Resources {
+			blob, err := storage.Put(bytes.NewReader(f.Data))
+			if err != nil {
+				http.Error(w, "Failed to store checker resources", http.StatusInternalServerError)
+				return
+			}
+			programs = append(programs, models.ProblemProgram{
+				Role: programResource, Name: f.Name, SourceHash: blob.Hash, SourceSize: blob.Size,
+			})
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to import problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	problem := models.Problem{
+		Title:       pkg.Title,
+		Statement:   pkg.Statement,
+		TimeLimit:   pkg.TimeLimit,
+		MemoryLimit: pkg.MemoryLimit,
+		Version:     1,
+		CreatedBy:   &userID,
+	}
+	err = tx.QueryRow(
+		"INSERT INTO problems (title, statement, time_limit, memory_limit, is_public, created_by) VALUES ($1, $2, $3, $4, FALSE, $5) RETURNING id, created_at",
+		pkg.Title, pkg.Statement, pkg.TimeLimit, pkg.MemoryLimit, userID,
+	).Scan(&problem.ID, &problem.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to import problem", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(
+		"INSERT INTO problem_versions (problem_id, version, title, statement, time_limit, memory_limit, judging_policy, created_by) VALUES ($1, 1, $2, $3, $4, $5, $6, $7)",
+		problem.ID, pkg.Title, pkg.Statement, pkg.TimeLimit, pkg.MemoryLimit, policyStopAtFailure, userID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to import problem", http.StatusInternalServerError)
+		return
+	}
+
+	samples := 0
+	for i, test := range pkg.Tests {
+		if _, err := insertTestcase(tx, problem.ID, 1, blobs[i][0], blobs[i][1], test.IsSample); err != nil {
+			http.Error(w, "Failed to import testcases", http.StatusInternalServerError)
+			return
+		}
+		if test.IsSample {
+			samples++
+		}
+	}
+	for _, p := range programs {
+		p.ProblemID = problem.ID
+		p.AddedInVersion = 1
+		if _, err := insertProgram(tx, p); err != nil {
+			http.Error(w, "Failed to import checker", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if contestID != 0 {
+		link, err := attachProblem(tx, contestID, models.AttachProblemRequest{ProblemID: problem.ID})
+		if err != nil {
+			http.Error(w, "Failed to add problem to contest", http.StatusInternalServerError)
+			return
+		}
+		problem.ContestID = link.ContestID
+		problem.Label = link.Label
+		problem.Points = link.Points
+		problem.Position = link.Position
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to import problem", http.StatusInternalServerError)
+		return
+	}
+	if contestID != 0 {
+		if err := standings.Rebuild(contestID); err != nil {
+			fmt.Printf("contest %d: failed to rebuild standings: %v\n", contestID, err)
+		}
+		publishStandings(contestID)
+	}
+
+	checker := ""
+	if pkg.Checker != nil {
+		checker = pkg.Checker.Kind
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"problem":   problem,
+		"testcases": len(pkg.Tests),
+		"samples":   samples,
+		"checker":   checker,
+		"resources": len(pkg.Resources),
+	})
+}
+
+// ExportProblem sends the current version of a problem as a package (author
+// or admin only). ?format= picks kattis (the default) or polygon.
+func ExportProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = problempkg.FormatKattis
+	}
+	if format != problempkg.FormatKattis && format != problempkg.FormatPolygon {
+		http.Error(w, "format must be kattis or polygon", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "export") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to export problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	pkg := &problempkg.Package{ShortName: fmt.Sprintf("problem-%d", problemID)}
+	var version int
+	err = tx.QueryRow(
+		"SELECT title, statement, time_limit, memory_limit, version FROM problems WHERE id = $1",
+		problemID,
+	).Scan(&pkg.Title, &pkg.Statement, &pkg.TimeLimit, &pkg.MemoryLimit, &version)
+	if err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	testcases, err := loadVersionTestcases(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch testcases", http.StatusInternalServerError)
+		return
+	}
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch programs", http.StatusInternalServerError)
+		return
+	}
+	tx.Rollback()
+
+	for _, tc := range testcases {
+		tc := tc
+		pkg.Tests = append(pkg.Tests, problempkg.Test{
+			Name:     strconv.Itoa(tc.ID),
+			IsSample: tc.IsSample,
+			Input:    func() (io.ReadCloser, error) { return openTestcaseInput(tc) },
+			Answer:   func() (io.ReadCloser, error) { return openTestcaseOutput(tc) },
+		})
+	}
+	for _, p := range programs {
+		source, err := storage.ReadString(p.SourceHash)
+		if err != nil {
+			http.Error(w, "Failed to load program source", http.StatusInternalServerError)
+			return
+		}
+		switch p.Role {
+		case programChecker:
+			pkg.Checker = &problempkg.Program{Name: p.Name, Language: p.Language, Kind: p.Kind, Source: []byte(source)}
+		case programResource:
+			pkg.Resources = append(pkg.Resources, problempkg.File{Name: p.Name, Data: []byte(source)})
+		case programInteractor:
+			http.Error(w, "Interactive problems cannot be exported", http.StatusConflict)
+			return
+		case programGrader:
+			http.Error(w, "Function-style problems cannot be exported", http.StatusConflict)
+			return
+		}
+	}
+
+	// Refuse before the response starts; once the zip is streaming, errors
+	// can only cut it short
+	if err := problempkg.CheckFormat(pkg, format); err != nil {
+		if errors.Is(err, problempkg.ErrIncompatibleChecker) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.zip", pkg.ShortName, format)))
+	if err := problempkg.Write(w, pkg, format); err != nil {
+		fmt.Printf("problem %d: failed to export package: %v\n", problemID, err)
+	}
+}
+
+// storePackageFile streams one test file of a package into blob storage.
+// A file that cannot be read from the package or is too large comes back as
+// a message for the uploader; failures of the storage are errors.
+func storePackageFile(name string, open problempkg.Opener) (storage.Blob, string, error) {
+	rc, err := open()
+	if err != nil {
+		return storage.Blob{}, fmt.Sprintf("failed to read test %s: %v", name, err), nil
+	}
+	defer rc.Close()
+
+	src := &packageFileReader{r: io.LimitReader(rc, maxTestcaseFileSize+1)}
+	blob, err := storage.Put(src)
+	if src.err != nil {
+		return storage.Blob{}, fmt.Sprintf("failed to read test %s: %v", name, src.err), nil
+	}
+	if err != nil {
+		return storage.Blob{}, "", err
+	}
+	if blob.Size > maxTestcaseFileSize {
+		return storage.Blob{}, fmt.Sprintf("test %s is larger than %d MB", name, maxTestcaseFileSize>>20), nil
+	}
+	return blob, "", nil
+}
+
+// packageFileReader keeps the error reading a package file failed with, to
+// tell a broken package from a storage failure
+type packageFileReader struct {
+	r   io.Reader
+	err error
+}
+
+func (p *packageFileReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		p.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/problempkg"
+	"codesprint/storage"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles of problem programs
+const (
+	programChecker    = "checker"
+	programValidator  = "validator"
+	programSolution   = "solution"
+	programResource   = "resource"
+	programGenerator  = "generator"
+	programScript     = "script"
+	programInteractor = "interactor"
+	programGrader     = "grader"
+	programTemplate   = "template"
+)
+
+// solutionVerdicts are the verdicts a reference solution can be expected to get
+var solutionVerdicts = map[string]bool{
+	"accepted":              true,
+	"wrong_answer":          true,
+	"presentation_error":    true,
+	"time_limit_exceeded":   true,
+	"runtime_error":         true,
+	"memory_limit_exceeded": true,
+	"output_limit_exceeded": true,
+}
+
+// maxProgramSourceSize caps the source of a problem program or support file
+const maxProgramSourceSize = 8 << 20
+
+// GetProblemPrograms lists the programs of a problem's current version (author or admin only)
+func GetProblemPrograms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the programs of") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to fetch programs", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("SELECT version FROM problems WHERE id = $1", problemID).Scan(&version); err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch programs", http.StatusInternalServerError)
+		return
+	}
+
+	// Sources are small enough to return inline, and setters want to see them
+	for i := range programs {
+		if programs[i].Source, err = storage.ReadString(programs[i].SourceHash); err != nil {
+			http.Error(w, "Failed to load program source", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(programs)
+}
+
+// CreateProblemProgram adds a checker, interactor, input validator, reference
+// solution, testcase generator, grader, signature template or support file to
+// the current version of a problem (author or admin only). A new checker,
+// interactor or validator replaces the old one, graders and templates the one
+// for the same language; solutions, generators and support files replace the
+// one with the same name.
+func CreateProblemProgram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateProgramRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxProgramSourceSize)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	program, msg := newProgram(req)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeProblem(w, userID, problemID, "add programs to") {
+		return
+	}
+
+	blob, err := storage.PutString(req.Source)
+	if err != nil {
+		http.Error(w, "Failed to store program", http.StatusInternalServerError)
+		return
+	}
+	program.SourceHash, program.SourceSize = blob.Hash, blob.Size
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create program", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := editableVersion(tx, problemID)
+	if err != nil {
+		http.Error(w, "Failed to create program", http.StatusInternalServerError)
+		return
+	}
+
+	// Drop what the new program replaces
+	existing, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to create program", http.StatusInternalServerError)
+		return
+	}
+	for _, p := range existing {
+		single := p.Role == programChecker || p.Role == programInteractor || p.Role == programValidator
+		perLanguage := (p.Role == programGrader || p.Role == programTemplate) && p.Language == program.Language
+		if p.Role == program.Role && (single || perLanguage || p.Name == program.Name) {
+			if err := removeProgram(tx, p.ID, version); err != nil {
+				http.Error(w, "Failed to create program", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	program.ProblemID = problemID
+	program.AddedInVersion = version
+	if program.ID, err = insertProgram(tx, program); err != nil {
+		http.Error(w, "Failed to create program", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create program", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(program)
+}
+
+// DeleteProblemProgram removes a program from the current version of a
+// problem (author or admin only). Earlier versions keep it.
+func DeleteProblemProgram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	programID, err := strconv.Atoi(vars["program_id"])
+	if err != nil {
+		http.Error(w, "Invalid program ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "remove programs from") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete program", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM problem_programs WHERE id = $1 AND problem_id = $2 AND removed_in_version IS NULL)",
+		programID, problemID,
+	).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to delete program", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Program not found", http.StatusNotFound)
+		return
+	}
+
+	version, err := editableVersion(tx, problemID)
+	if err != nil {
+		http.Error(w, "Failed to delete program", http.StatusInternalServerError)
+		return
+	}
+	if err := removeProgram(tx, programID, version); err != nil {
+		http.Error(w, "Failed to delete program", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete program", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":              programID,
+		"deleted":         true,
+		"problem_version": version,
+	})
+}
+
+// newProgram validates a program request, returning the program without its
+// source blob or an error message
+func newProgram(req models.CreateProgramRequest) (models.ProblemProgram, string) {
+	p := models.ProblemProgram{Role: req.Role, Name: path.Base(strings.TrimSpace(req.Name))}
+	if req.Source == "" {
+		return p, "source is required"
+	}
+	if len(req.Source) > maxProgramSourceSize {
+		return p, "source is too large"
+	}
+
+	unnamed := p.Name == "" || p.Name == "." || p.Name == "/"
+	switch req.Role {
+	case programSolution:
+		// Reference solutions are judged like submissions
+		language, ok := judge.LookupLanguage(req.Language)
+		if !ok {
+			return p, "unknown language " + strconv.Quote(req.Language)
+		}
+		p.Language = language.Name
+		if unnamed {
+			p.Name = req.Role + language.Extension
+		}
+	case programChecker, programInteractor, programValidator, programGenerator:
+		if _, ok := judge.ToolchainFor(req.Language); !ok {
+			return p, "language " + strconv.Quote(req.Language) + " cannot build problem programs on this judge; Judge0 builds them in c, cpp or python3"
+		}
+		language, _ := judge.LookupLanguage(req.Language)
+		p.Language = language.Name
+		if unnamed {
+			p.Name = req.Role + path.Ext(programSourceName(p.Language))
+		}
+	case programGrader, programTemplate:
+		if _, ok := judge.GraderToolchainFor(req.Language); !ok {
+			return p, "language must be c, cpp or python3"
+		}
+		language, _ := judge.LookupLanguage(req.Language)
+		p.Language = language.Name
+		if unnamed {
+			p.Name = req.Role + path.Ext(programSourceName(p.Language))
+		}
+	case programResource:
+		if unnamed {
+			return p, "name is required for a resource"
+		}
+	default:
+		return p, "role must be checker, interactor, validator, solution, generator, grader, template or resource"
+	}
+
+	switch req.Role {
+	case programChecker, programInteractor, programValidator:
+		p.Kind = req.Kind
+		if p.Kind == "" {
+			p.Kind = problempkg.CheckerTestlib
+		}
+		if p.Kind != problempkg.CheckerTestlib && p.Kind != problempkg.CheckerKattis {
+			return p, "kind must be testlib or kattis"
+		}
+	case programSolution:
+		p.ExpectedVerdict = req.ExpectedVerdict
+		if p.ExpectedVerdict == "" {
+			p.ExpectedVerdict = "accepted"
+		}
+		if !solutionVerdicts[p.ExpectedVerdict] {
+			return p, "expected_verdict must be accepted, wrong_answer, presentation_error, time_limit_exceeded, runtime_error, memory_limit_exceeded or output_limit_exceeded"
+		}
+	}
+	return p, ""
+}
+
+// programSourceName is the file name a program's source is compiled from
+func programSourceName(language string) string {
+	t, _ := judge.ToolchainFor(language)
+	return t.Source
+}
+
+// insertProgram adds a program whose source is already in blob storage and
+// returns its ID
+func insertProgram(tx *sql.Tx, p models.ProblemProgram) (int, error) {
+	var id int
+	err := tx.QueryRow(`
+		INSERT INTO problem_programs (problem_id, role, name, language, kind, expected_verdict, source_hash, source_size, added_in_version)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9) RETURNING id
+	`, p.ProblemID, p.Role, p.Name, p.Language, p.Kind, p.ExpectedVerdict, p.SourceHash, p.SourceSize, p.AddedInVersion).Scan(&id)
+	return id, err
+}
+
+// removeProgram takes a program out of a version: a program that only ever
+// belonged to that version is deleted, others are marked removed
+func removeProgram(tx *sql.Tx, programID, version int) error {
+	res, err := tx.Exec("DELETE FROM problem_programs WHERE id = $1 AND added_in_version = $2", programID, version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = tx.Exec(
+		"UPDATE problem_programs SET removed_in_version = $1 WHERE id = $2 AND removed_in_version IS NULL",
+		version, programID,
+	)
+	return err
+}
+
+// loadVersionPrograms returns the programs of one version of a problem,
+// without their sources
+func loadVersionPrograms(tx *sql.Tx, problemID, version int) ([]models.ProblemProgram, error) {
+	rows, err := tx.Query(`
+		SELECT id, problem_id, role, name, COALESCE(language, ''), COALESCE(kind, ''), COALESCE(expected_verdict, ''), source_hash, source_size,
+			added_in_version, removed_in_version, created_at
+		FROM problem_programs
+		WHERE problem_id = $1 AND added_in_version <= $2 AND (removed_in_version IS NULL OR removed_in_version > $2)
+		ORDER BY role, name, id
+	`, problemID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var programs []models.ProblemProgram
+	for rows.Next() {
+		var p models.ProblemProgram
+		if err := rows.Scan(&p.ID, &p.ProblemID, &p.Role, &p.Name, &p.Language, &p.Kind, &p.ExpectedVerdict, &p.SourceHash, &p.SourceSize, &p.AddedInVersion, &p.RemovedInVersion, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		programs = append(programs, p)
+	}
+	return programs, rows.Err()
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/problempkg"
+	"codesprint/storage"
+	"codesprint/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxValidatorMessage caps the validator output kept per rejected input
+const maxValidatorMessage = 1000
+
+// referenceSolution is a reference solution loaded for a verification run
+type referenceSolution struct {
+	models.ProblemProgram
+	Code string
+}
+
+// VerifyProblem starts a verification of a problem's current version (author
+// or admin only): the input validator checks every testcase input and every
+// reference solution is judged on every testcase, its verdicts compared with
+// the expected one. The run is asynchronous; poll the returned verification.
+func VerifyProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "verify") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start verification", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var version, timeLimit, memoryLimit int
+	err = tx.QueryRow(
+		"SELECT version, time_limit, memory_limit FROM problems WHERE id = $1 FOR SHARE",
+		problemID,
+	).Scan(&version, &timeLimit, &memoryLimit)
+	if err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	testcases, err := loadVersionTestcases(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch testcases", http.StatusInternalServerError)
+		return
+	}
+	if len(testcases) == 0 {
+		http.Error(w, "No testcases found for this problem", http.StatusBadRequest)
+		return
+	}
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch programs", http.StatusInternalServerError)
+		return
+	}
+	judging, err := judgingFromPrograms(programs)
+	if err != nil {
+		http.Error(w, "Failed to load checker", http.StatusInternalServerError)
+		return
+	}
+	validator, err := loadRunnable(programs, programValidator)
+	if err != nil {
+		http.Error(w, "Failed to load validator", http.StatusInternalServerError)
+		return
+	}
+	var solutions []referenceSolution
+	for _, p := range programs {
+		if p.Role != programSolution {
+			continue
+		}
+		code, err := storage.ReadString(p.SourceHash)
+		if err != nil {
+			http.Error(w, "Failed to load solution source", http.StatusInternalServerError)
+			return
+		}
+		solutions = append(solutions, referenceSolution{ProblemProgram: p, Code: code})
+	}
+	if validator == nil && len(solutions) == 0 {
+		http.Error(w, "Add an input validator or reference solutions to verify this problem", http.StatusBadRequest)
+		return
+	}
+	if judging.Interactor != nil && len(solutions) > 0 && !judge.Default.Interactive() {
+		http.Error(w, "This judge cannot run interactive problems", http.StatusServiceUnavailable)
+		return
+	}
+
+	verification := models.ProblemVerification{
+		ProblemID:      problemID,
+		ProblemVersion: version,
+		Status:         "running",
+		CreatedBy:      &userID,
+	}
+	err = tx.QueryRow(
+		"INSERT INTO problem_verifications (problem_id, problem_version, status, created_by) VALUES ($1, $2, 'running', $3) RETURNING id, created_at",
+		problemID, version, userID,
+	).Scan(&verification.ID, &verification.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to start verification", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to start verification", http.StatusInternalServerError)
+		return
+	}
+
+	go runVerification(verification.ID, testcases, validator, judging, solutions, timeLimit, memoryLimit)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(verification)
+}
+
+// GetProblemVerifications lists the verifications of a problem, newest first (author or admin only)
+func GetProblemVerifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the verifications of") {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, problem_id, problem_version, status, report, created_by, created_at, finished_at
+		FROM problem_verifications
+		WHERE problem_id = $1
+		ORDER BY id DESC
+	`, problemID)
+	if err != nil {
+		http.Error(w, "Failed to fetch verifications", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	verifications := []models.ProblemVerification{}
+	for rows.Next() {
+		v, err := scanVerification(rows)
+		if err != nil {
+			http.Error(w, "Failed to fetch verifications", http.StatusInternalServerError)
+			return
+		}
+		verifications = append(verifications, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verifications)
+}
+
+// GetProblemVerification returns one verification with its report (author or admin only)
+func GetProblemVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	verificationID, err := strconv.Atoi(vars["verification_id"])
+	if err != nil {
+		http.Error(w, "Invalid verification ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the verifications of") {
+		return
+	}
+
+	row := database.DB.QueryRow(`
+		SELECT id, problem_id, problem_version, status, report, created_by, created_at, finished_at
+		FROM problem_verifications
+		WHERE id = $1 AND problem_id = $2
+	`, verificationID, problemID)
+	v, err := scanVerification(row)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Verification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch verification", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// scanVerification scans a problem_verifications row, decoding its report
+func scanVerification(row interface{ Scan(...interface{}) error }) (models.ProblemVerification, error) {
+	var v models.ProblemVerification
+	var report sql.NullString
+	if err := row.Scan(&v.ID, &v.ProblemID, &v.ProblemVersion, &v.Status, &report, &v.CreatedBy, &v.CreatedAt, &v.FinishedAt); err != nil {
+		return v, err
+	}
+	if report.Valid {
+		v.Report = &models.VerificationReport{}
+		if err := json.Unmarshal([]byte(report.String), v.Report); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// runVerification validates every input and judges every reference solution,
+// then records the report. The verification passes when all inputs are valid
+// and every solution got its expected verdict.
+func runVerification(verificationID int, testcases []models.Testcase, validator *runnableProgram, judging judgingPrograms, solutions []referenceSolution, timeLimit, memoryLimit int) {
+	report := models.VerificationReport{Solutions: []models.SolutionReport{}}
+	passed := true
+
+	if validator != nil {
+		result := &models.ValidatorReport{Name: validator.Name, Invalid: []models.InvalidInput{}}
+		for _, tc := range testcases {
+			valid, message, err := runValidator(validator, tc)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("validator on testcase %d: %v", tc.ID, err))
+				continue
+			}
+			result.Checked++
+			if !valid {
+				result.Invalid = append(result.Invalid, models.InvalidInput{TestcaseID: tc.ID, Message: message})
+				passed = false
+			}
+		}
+		report.Validator = result
+	}
+
+	for _, solution := range solutions {
+		result := models.SolutionReport{
+			ProgramID:       solution.ID,
+			Name:            solution.Name,
+			Language:        solution.Language,
+			ExpectedVerdict: solution.ExpectedVerdict,
+			Verdict:         "accepted",
+		}
+		for _, run := range judgeTestcases(solution.Code, solution.Language, testcases, judging, timeLimit, memoryLimit, false) {
+			test := models.SolutionTestResult{TestcaseID: run.Testcase.ID, Verdict: run.Status, Runtime: run.Runtime, Memory: run.Memory}
+			if run.Err != nil {
+				test.Error = run.Err.Error()
+				report.Errors = append(report.Errors, fmt.Sprintf("solution %s on testcase %d: %v", solution.Name, run.Testcase.ID, run.Err))
+			}
+			if run.Runtime > result.MaxRuntime {
+				result.MaxRuntime = run.Runtime
+			}
+			if run.Memory > result.MaxMemory {
+				result.MaxMemory = run.Memory
+			}
+			if run.Status != "accepted" && result.Verdict == "accepted" {
+				result.Verdict = run.Status
+			}
+			result.Tests = append(result.Tests, test)
+		}
+		result.Matches = verdictsMatch(solution.ExpectedVerdict, result.Tests)
+		if !result.Matches {
+			passed = false
+		}
+		report.Solutions = append(report.Solutions, result)
+	}
+
+	status := "passed"
+	if len(report.Errors) > 0 {
+		status = "error"
+	} else if !passed {
+		status = "failed"
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		fmt.Printf("verification %d: failed to encode report: %v\n", verificationID, err)
+		status = "error"
+	}
+	_, err = database.DB.Exec(
+		"UPDATE problem_verifications SET status = $1, report = $2, finished_at = CURRENT_TIMESTAMP WHERE id = $3",
+		status, string(data), verificationID,
+	)
+	if err != nil {
+		fmt.Printf("Failed to update verification %d: %v\n", verificationID, err)
+	}
+}
+
+// verdictsMatch reports whether a reference solution behaved as tagged. An
+// accepted solution must pass every testcase; any other solution must get its
+// expected verdict on at least one testcase and pass the rest, as in Polygon.
+func verdictsMatch(expected string, tests []models.SolutionTestResult) bool {
+	hit := false
+	for _, test := range tests {
+		switch test.Verdict {
+		case "accepted":
+		case expected:
+			hit = true
+		default:
+			return false
+		}
+	}
+	return expected == "accepted" || hit
+}
+
+// runValidator runs the input validator on one testcase input, returning
+// whether it is valid and, when not, what the validator said about it
+func runValidator(validator *runnableProgram, tc models.Testcase) (bool, string, error) {
+	toolchain, ok := judge.ToolchainFor(validator.Language)
+	if !ok {
+		return false, "", fmt.Errorf("unsupported validator language %q", validator.Language)
+	}
+	input, err := readTestcaseData(openTestcaseInput(tc))
+	if err != nil {
+		return false, "", err
+	}
+
+	// The input arrives on stdin, which is how both protocols read it
+	run := toolchain.Run + "\necho \"" + checkerExitMarker + "$?\""
+	code, stderr, err := runForExitCode(context.Background(), toolchain, validator.Files, run, string(input))
+	if err != nil {
+		return false, "", fmt.Errorf("validator %w", err)
+	}
+
+	valid := code == 0
+	if validator.Kind == problempkg.CheckerKattis {
+		valid = code == 42
+	}
+	message := strings.TrimSpace(stderr)
+	if len(message) > maxValidatorMessage {
+		message = message[:maxValidatorMessage]
+	}
+	if !valid && message == "" {
+		message = fmt.Sprintf("validator exited with code %d", code)
+	}
+	return valid, message, nil
+}
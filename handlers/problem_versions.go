@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetProblemVersions lists the versions of a problem, newest first (author or admin only)
+func GetProblemVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the history of") {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT v.problem_id, v.version, v.title, v.time_limit, v.memory_limit, COALESCE(v.judging_policy, p.judging_policy), v.version = p.version, v.created_by, v.created_at,
+			(SELECT COUNT(*) FROM testcases t
+			 WHERE t.problem_id = v.problem_id AND t.added_in_version <= v.version
+				AND (t.removed_in_version IS NULL OR t.removed_in_version > v.version))
+		FROM problem_versions v
+		JOIN problems p ON p.id = v.problem_id
+		WHERE v.problem_id = $1
+		ORDER BY v.version DESC
+	`, problemID)
+	if err != nil {
+		http.Error(w, "Failed to fetch problem versions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var versions []models.ProblemVersion
+	for rows.Next() {
+		var v models.ProblemVersion
+		if err := rows.Scan(&v.ProblemID, &v.Version, &v.Title, &v.TimeLimit, &v.MemoryLimit, &v.JudgingPolicy, &v.Current, &v.CreatedBy, &v.CreatedAt, &v.TestcaseCount); err != nil {
+			http.Error(w, "Failed to fetch problem versions", http.StatusInternalServerError)
+			return
+		}
+		versions = append(versions, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GetProblemVersion returns one version of a problem with its statement (author or admin only)
+func GetProblemVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the history of") {
+		return
+	}
+
+	var v models.ProblemVersion
+	err = database.DB.QueryRow(`
+		SELECT v.problem_id, v.version, v.title, v.statement, v.time_limit, v.memory_limit, COALESCE(v.judging_policy, p.judging_policy), v.version = p.version, v.created_by, v.created_at,
+			(SELECT COUNT(*) FROM testcases t
+			 WHERE t.problem_id = v.problem_id AND t.added_in_version <= v.version
+				AND (t.removed_in_version IS NULL OR t.removed_in_version > v.version))
+		FROM problem_versions v
+		JOIN problems p ON p.id = v.problem_id
+		WHERE v.problem_id = $1 AND v.version = $2
+	`, problemID, version).Scan(&v.ProblemID, &v.Version, &v.Title, &v.Statement, &v.TimeLimit, &v.MemoryLimit, &v.JudgingPolicy, &v.Current, &v.CreatedBy, &v.CreatedAt, &v.TestcaseCount)
+	if err != nil {
+		http.Error(w, "Problem version not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorizeProblem checks that the user may change a library problem, writing
+// the error response and returning false when not
+func authorizeProblem(w http.ResponseWriter, userID, problemID int, action string) bool {
+	allowed, err := canManageProblem(userID, problemID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch problem", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "Only the problem author or an admin can "+action+" this problem", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// editableVersion locks a problem and returns the version that edits should
+// go to. The current version is edited in place until a submission has been
+// judged against it; after that a copy becomes the new current version, so
+// past verdicts keep pointing at what they were judged on.
+func editableVersion(tx *sql.Tx, problemID int) (int, error) {
+	var version int
+	err := tx.QueryRow("SELECT version FROM problems WHERE id = $1 FOR UPDATE", problemID).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	var used bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM submissions WHERE problem_id = $1 AND problem_version = $2)",
+		problemID, version,
+	).Scan(&used)
+	if err != nil || !used {
+		return version, err
+	}
+
+	version++
+	_, err = tx.Exec(`
+		INSERT INTO problem_versions (problem_id, version, title, statement, time_limit, memory_limit, judging_policy, created_by)
+		SELECT id, $2, title, statement, time_limit, memory_limit, judging_policy, created_by FROM problems WHERE id = $1
+	`, problemID, version)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE problems SET version = $1 WHERE id = $2", version, problemID); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// loadVersionTestcases returns the testcases of one version of a problem.
+// Data in blob storage is not loaded; open it with openTestcaseInput and
+// openTestcaseOutput.
+func loadVersionTestcases(tx *sql.Tx, problemID, version int) ([]models.Testcase, error) {
+	rows, err := tx.Query(`
+		SELECT id, problem_id, COALESCE(input, ''), COALESCE(expected_output, ''),
+			COALESCE(input_hash, ''), COALESCE(output_hash, ''),
+			COALESCE(input_size, OCTET_LENGTH(input)), COALESCE(output_size, OCTET_LENGTH(expected_output)),
+			is_sample, added_in_version, removed_in_version, COALESCE(generated_by, '')
+		FROM testcases
+		WHERE problem_id = $1 AND added_in_version <= $2 AND (removed_in_version IS NULL OR removed_in_version > $2)
+		ORDER BY id
+	`, problemID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var testcases []models.Testcase
+	for rows.Next() {
+		var tc models.Testcase
+		if err := rows.Scan(&tc.ID, &tc.ProblemID, &tc.Input, &tc.ExpectedOutput, &tc.InputHash, &tc.OutputHash, &tc.InputSize, &tc.OutputSize, &tc.IsSample, &tc.AddedInVersion, &tc.RemovedInVersion, &tc.GeneratedBy); err != nil {
+			return nil, err
+		}
+		testcases = append(testcases, tc)
+	}
+	return testcases, rows.Err()
+}
@@ -3,15 +3,19 @@ package handlers
 import (
 	"codesprint/database"
 	"codesprint/models"
+	"codesprint/standings"
 	"codesprint/utils"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
-// CreateProblem handles problem creation (admin only)
+// CreateProblem adds a problem to the library and, when contest_id is given,
+// to that contest (contest owner or admin only)
 func CreateProblem(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -42,27 +46,107 @@ func CreateProblem(w http.ResponseWriter, r *http.Request) {
 	if req.MemoryLimit <= 0 {
 		req.MemoryLimit = 256 // default 256 MB
 	}
+	if req.JudgingPolicy == "" {
+		req.JudgingPolicy = policyStopAtFailure
+	}
+	if !validJudgingPolicy(req.JudgingPolicy) {
+		http.Error(w, "Judging policy must be stop_at_first_failure or run_all", http.StatusBadRequest)
+		return
+	}
 
-	// Create problem
-	var problemID int
-	err := database.DB.QueryRow(
-		"INSERT INTO problems (contest_id, title, statement, time_limit, memory_limit) VALUES ($1, $2, $3, $4, $5) RETURNING id",
-		req.ContestID, req.Title, req.Statement, req.TimeLimit, req.MemoryLimit,
-	).Scan(&problemID)
+	if req.ContestID != 0 {
+		var label *string
+		if req.Label != "" {
+			label = &req.Label
+		}
+		if message := contestProblemError(label, req.Points, nil); message != "" {
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+		allowed, err := canManageContest(userID, req.ContestID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Contest not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Only the contest owner or an admin can add problems to this contest", http.StatusForbidden)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
 	if err != nil {
 		http.Error(w, "Failed to create problem", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
+
+	// Create problem in the library
+	problem := models.Problem{
+		Title:         req.Title,
+		Statement:     req.Statement,
+		TimeLimit:     req.TimeLimit,
+		MemoryLimit:   req.MemoryLimit,
+		IsPublic:      req.IsPublic,
+		JudgingPolicy: req.JudgingPolicy,
+		Version:       1,
+		CreatedBy:     &userID,
+	}
+	err = tx.QueryRow(
+		"INSERT INTO problems (title, statement, time_limit, memory_limit, is_public, judging_policy, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+		req.Title, req.Statement, req.TimeLimit, req.MemoryLimit, req.IsPublic, req.JudgingPolicy, userID,
+	).Scan(&problem.ID, &problem.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to create problem", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(
+		"INSERT INTO problem_versions (problem_id, version, title, statement, time_limit, memory_limit, judging_policy, created_by) VALUES ($1, 1, $2, $3, $4, $5, $6, $7)",
+		problem.ID, req.Title, req.Statement, req.TimeLimit, req.MemoryLimit, req.JudgingPolicy, userID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to create problem", http.StatusInternalServerError)
+		return
+	}
+
+	// Optionally attach it to a contest right away
+	if req.ContestID != 0 {
+		link, err := attachProblem(tx, req.ContestID, models.AttachProblemRequest{
+			ProblemID: problem.ID,
+			Label:     req.Label,
+			Points:    req.Points,
+		})
+		if err == errLabelTaken {
+			http.Error(w, "Label is already used in this contest", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to add problem to contest", http.StatusInternalServerError)
+			return
+		}
+		problem.ContestID = link.ContestID
+		problem.Label = link.Label
+		problem.Points = link.Points
+		problem.Position = link.Position
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create problem", http.StatusInternalServerError)
+		return
+	}
+	if req.ContestID != 0 {
+		if err := standings.Rebuild(req.ContestID); err != nil {
+			fmt.Printf("contest %d: failed to rebuild standings: %v\n", req.ContestID, err)
+		}
+		publishStandings(req.ContestID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":           problemID,
-		"contest_id":   req.ContestID,
-		"title":        req.Title,
-		"statement":    req.Statement,
-		"time_limit":   req.TimeLimit,
-		"memory_limit": req.MemoryLimit,
-	})
+	json.NewEncoder(w).Encode(problem)
 }
 
 // GetContestProblems returns all problems for a contest
@@ -79,10 +163,13 @@ func GetContestProblems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := database.DB.Query(
-		"SELECT id, contest_id, title, statement, time_limit, memory_limit, created_at FROM problems WHERE contest_id = $1 ORDER BY id",
-		contestID,
-	)
+	rows, err := database.DB.Query(`
+		SELECT p.id, cp.contest_id, cp.label, cp.points, cp.position, p.title, p.statement, p.time_limit, p.memory_limit, p.is_public, p.version, p.created_by, p.created_at
+		FROM contest_problems cp
+		JOIN problems p ON p.id = cp.problem_id
+		WHERE cp.contest_id = $1
+		ORDER BY cp.position, cp.label
+	`, contestID)
 	if err != nil {
 		http.Error(w, "Failed to fetch problems", http.StatusInternalServerError)
 		return
@@ -92,7 +179,7 @@ func GetContestProblems(w http.ResponseWriter, r *http.Request) {
 	var problems []models.Problem
 	for rows.Next() {
 		var problem models.Problem
-		err := rows.Scan(&problem.ID, &problem.ContestID, &problem.Title, &problem.Statement, &problem.TimeLimit, &problem.MemoryLimit, &problem.CreatedAt)
+		err := rows.Scan(&problem.ID, &problem.ContestID, &problem.Label, &problem.Points, &problem.Position, &problem.Title, &problem.Statement, &problem.TimeLimit, &problem.MemoryLimit, &problem.IsPublic, &problem.Version, &problem.CreatedBy, &problem.CreatedAt)
 		if err != nil {
 			http.Error(w, "Failed to scan problem", http.StatusInternalServerError)
 			return
@@ -124,16 +211,275 @@ func GetProblem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var problem models.Problem
-	err = database.DB.QueryRow(
-		"SELECT id, contest_id, title, statement, time_limit, memory_limit, created_at FROM problems WHERE id = $1",
+	err = database.DB.QueryRow(`
+		SELECT id, title, statement, time_limit, memory_limit, is_public, judging_policy, version, created_by, created_at,
+			EXISTS (
+				SELECT 1 FROM problem_programs pp
+				WHERE pp.problem_id = problems.id AND pp.role = 'interactor'
+					AND pp.added_in_version <= problems.version
+					AND (pp.removed_in_version IS NULL OR pp.removed_in_version > problems.version)
+			)
+		FROM problems WHERE id = $1
+	`, problemID).Scan(&problem.ID, &problem.Title, &problem.Statement, &problem.TimeLimit, &problem.MemoryLimit, &problem.IsPublic, &problem.JudgingPolicy, &problem.Version, &problem.CreatedBy, &problem.CreatedAt, &problem.Interactive)
+	if err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	problem.Languages, problem.Templates, err = loadProblemTemplates(problem.ID, problem.Version)
+	if err != nil {
+		http.Error(w, "Failed to load templates", http.StatusInternalServerError)
+		return
+	}
+
+	// Include the problem's label and points when viewed from a contest
+	if contestIDStr := r.URL.Query().Get("contest_id"); contestIDStr != "" {
+		contestID, err := strconv.Atoi(contestIDStr)
+		if err != nil {
+			http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+			return
+		}
+		err = database.DB.QueryRow(
+			"SELECT contest_id, label, points, position FROM contest_problems WHERE contest_id = $1 AND problem_id = $2",
+			contestID, problemID,
+		).Scan(&problem.ContestID, &problem.Label, &problem.Points, &problem.Position)
+		if err != nil {
+			http.Error(w, "Problem not found in this contest", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(problem)
+}
+
+// UpdateProblem changes a problem's statement, limits or visibility (author or
+// admin only). Statement and limit changes go to a new problem version once
+// submissions have been judged against the current one.
+func UpdateProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateProblemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.Title != nil && *req.Title == "") || (req.Statement != nil && *req.Statement == "") {
+		http.Error(w, "Title and statement must not be empty", http.StatusBadRequest)
+		return
+	}
+	if (req.TimeLimit != nil && *req.TimeLimit <= 0) || (req.MemoryLimit != nil && *req.MemoryLimit <= 0) {
+		http.Error(w, "Time and memory limits must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.JudgingPolicy != nil && !validJudgingPolicy(*req.JudgingPolicy) {
+		http.Error(w, "Judging policy must be stop_at_first_failure or run_all", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeProblem(w, userID, problemID, "edit") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var problem models.Problem
+	err = tx.QueryRow(
+		"SELECT id, title, statement, time_limit, memory_limit, is_public, judging_policy, version, created_by, created_at FROM problems WHERE id = $1 FOR UPDATE",
 		problemID,
-	).Scan(&problem.ID, &problem.ContestID, &problem.Title, &problem.Statement, &problem.TimeLimit, &problem.MemoryLimit, &problem.CreatedAt)
+	).Scan(&problem.ID, &problem.Title, &problem.Statement, &problem.TimeLimit, &problem.MemoryLimit, &problem.IsPublic, &problem.JudgingPolicy, &problem.Version, &problem.CreatedBy, &problem.CreatedAt)
 	if err != nil {
 		http.Error(w, "Problem not found", http.StatusNotFound)
 		return
 	}
+	before := problem
+
+	if req.Title != nil {
+		problem.Title = *req.Title
+	}
+	if req.Statement != nil {
+		problem.Statement = *req.Statement
+	}
+	if req.TimeLimit != nil {
+		problem.TimeLimit = *req.TimeLimit
+	}
+	if req.MemoryLimit != nil {
+		problem.MemoryLimit = *req.MemoryLimit
+	}
+	if req.IsPublic != nil {
+		problem.IsPublic = *req.IsPublic
+	}
+	if req.JudgingPolicy != nil {
+		problem.JudgingPolicy = *req.JudgingPolicy
+	}
+
+	versioned := startsVersion(before, problem)
+	if versioned {
+		problem.Version, err = editableVersion(tx, problemID)
+		if err != nil {
+			http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE problems SET title = $1, statement = $2, time_limit = $3, memory_limit = $4, is_public = $5, judging_policy = $6 WHERE id = $7",
+		problem.Title, problem.Statement, problem.TimeLimit, problem.MemoryLimit, problem.IsPublic, problem.JudgingPolicy, problemID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
+	if versioned {
+		_, err = tx.Exec(
+			"UPDATE problem_versions SET title = $1, statement = $2, time_limit = $3, memory_limit = $4, judging_policy = $5, created_by = $6, created_at = CURRENT_TIMESTAMP WHERE problem_id = $7 AND version = $8",
+			problem.Title, problem.Statement, problem.TimeLimit, problem.MemoryLimit, problem.JudgingPolicy, userID, problemID, problem.Version,
+		)
+	} else if problem.JudgingPolicy != before.JudgingPolicy {
+		_, err = tx.Exec(
+			"UPDATE problem_versions SET judging_policy = $1 WHERE problem_id = $2 AND version = $3",
+			problem.JudgingPolicy, problemID, problem.Version,
+		)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update problem", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(problem)
 }
 
+// startsVersion reports whether an edit of a problem makes a new version:
+// only a change to the statement or limits does; the judging policy of the
+// current version, and whether the problem is public, are changed in place
+func startsVersion(before, after models.Problem) bool {
+	return after.Title != before.Title || after.Statement != before.Statement ||
+		after.TimeLimit != before.TimeLimit || after.MemoryLimit != before.MemoryLimit
+}
+
+// DeleteProblem removes a problem from the library (author or admin only).
+// Problems that are part of a contest or have submissions cannot be deleted.
+func DeleteProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "delete") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete problem", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT 1 FROM problems WHERE id = $1 FOR UPDATE", problemID); err != nil {
+		http.Error(w, "Failed to delete problem", http.StatusInternalServerError)
+		return
+	}
+
+	var contestCount, submissionCount int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM contest_problems WHERE problem_id = $1),
+			(SELECT COUNT(*) FROM submissions WHERE problem_id = $1)
+	`, problemID).Scan(&contestCount, &submissionCount)
+	if err != nil {
+		http.Error(w, "Failed to delete problem", http.StatusInternalServerError)
+		return
+	}
+	if contestCount > 0 {
+		http.Error(w, "Problem is used in a contest; remove it from the contest first", http.StatusConflict)
+		return
+	}
+	if submissionCount > 0 {
+		http.Error(w, "Problem has submissions and cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	// Testcases and versions cascade
+	if _, err := tx.Exec("DELETE FROM problems WHERE id = $1", problemID); err != nil {
+		http.Error(w, "Failed to delete problem", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete problem", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      problemID,
+		"deleted": true,
+	})
+}
+
+// GetArchiveProblems returns the public problems of the practice archive
+func GetArchiveProblems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT id, title, statement, time_limit, memory_limit, is_public, version, created_by, created_at FROM problems WHERE is_public ORDER BY id",
+	)
+	if err != nil {
+		http.Error(w, "Failed to fetch problems", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var problems []models.Problem
+	for rows.Next() {
+		var problem models.Problem
+		err := rows.Scan(&problem.ID, &problem.Title, &problem.Statement, &problem.TimeLimit, &problem.MemoryLimit, &problem.IsPublic, &problem.Version, &problem.CreatedBy, &problem.CreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan problem", http.StatusInternalServerError)
+			return
+		}
+		problems = append(problems, problem)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(problems)
+}
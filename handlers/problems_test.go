@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"codesprint/models"
+	"testing"
+)
+
+func TestStartsVersion(t *testing.T) {
+	before := models.Problem{
+		Title: "Sum", Statement: "Add two numbers", TimeLimit: 1000, MemoryLimit: 256,
+		IsPublic: false, JudgingPolicy: policyStopAtFailure, Version: 2,
+	}
+	tests := []struct {
+		name string
+		edit func(p *models.Problem)
+		want bool
+	}{
+		{"no change", func(p *models.Problem) {}, false},
+		{"title", func(p *models.Problem) { p.Title = "Sum of two" }, true},
+		{"statement", func(p *models.Problem) { p.Statement += "." }, true},
+		{"time limit", func(p *models.Problem) { p.TimeLimit = 2000 }, true},
+		{"memory limit", func(p *models.Problem) { p.MemoryLimit = 512 }, true},
+		{"made public", func(p *models.Problem) { p.IsPublic = true }, false},
+		{"judging policy", func(p *models.Problem) { p.JudgingPolicy = policyRunAll }, false},
+		{"same values given again", func(p *models.Problem) { p.Title, p.TimeLimit = "Sum", 1000 }, false},
+	}
+	for _, tt := range tests {
+		after := before
+		tt.edit(&after)
+		if got := startsVersion(before, after); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
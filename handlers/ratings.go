@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/rating"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// FinalizeContest marks an ended contest's results as final and, for rated
+// contests, applies the rating changes (owner or admin only)
+func FinalizeContest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can finalize this contest", http.StatusForbidden)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to finalize contest", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var ended, finalized, rated bool
+	err = tx.QueryRow(
+		"SELECT end_time < CURRENT_TIMESTAMP, finalized_at IS NOT NULL, is_rated FROM contests WHERE id = $1 FOR UPDATE",
+		contestID,
+	).Scan(&ended, &finalized, &rated)
+	if err != nil {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if finalized {
+		http.Error(w, "Contest is already finalized", http.StatusConflict)
+		return
+	}
+	if !ended {
+		http.Error(w, "Contest has not ended yet", http.StatusConflict)
+		return
+	}
+
+	// Standings leave out submissions the judge failed on, so results are
+	// not final until they are judged again
+	var judging, failed int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE status IN ('pending', 'running')), COUNT(*) FILTER (WHERE status = 'judge_error')
+		FROM submissions WHERE contest_id = $1 AND NOT is_practice
+	`, contestID).Scan(&judging, &failed)
+	if err != nil {
+		http.Error(w, "Failed to finalize contest", http.StatusInternalServerError)
+		return
+	}
+	if judging > 0 {
+		http.Error(w, "Contest submissions are still being judged", http.StatusConflict)
+		return
+	}
+	if failed > 0 {
+		http.Error(w, fmt.Sprintf("%d contest submissions got judge_error; rejudge them before finalizing", failed), http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE contests SET finalized_at = CURRENT_TIMESTAMP WHERE id = $1", contestID); err != nil {
+		http.Error(w, "Failed to finalize contest", http.StatusInternalServerError)
+		return
+	}
+	if rated {
+		if err := rating.ApplyContest(tx, contestID); err != nil {
+			fmt.Printf("contest %d: failed to apply ratings: %v\n", contestID, err)
+			http.Error(w, "Failed to apply ratings", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to finalize contest", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        contestID,
+		"finalized": true,
+		"rated":     rated,
+	})
+}
+
+// GetRatingHistory returns a user's rating changes, oldest first
+func GetRatingHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT rc.contest_id, c.title, rc.rank, rc.old_rating, rc.new_rating, rc.delta, rc.created_at
+		FROM rating_changes rc
+		JOIN contests c ON c.id = rc.contest_id
+		WHERE rc.user_id = $1
+		ORDER BY c.end_time, rc.contest_id
+	`, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch rating history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var history []models.RatingChange
+	for rows.Next() {
+		var change models.RatingChange
+		err := rows.Scan(&change.ContestID, &change.ContestTitle, &change.Rank, &change.OldRating, &change.NewRating, &change.Delta, &change.CreatedAt)
+		if err != nil {
+			continue
+		}
+		history = append(history, change)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// GetRatings returns the global ratings leaderboard
+func GetRatings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT u.id, u.name, u.rating, (SELECT COUNT(*) FROM rating_changes rc WHERE rc.user_id = u.id)
+		FROM users u
+		WHERE u.rating IS NOT NULL
+		ORDER BY u.rating DESC, u.id
+	`)
+	if err != nil {
+		http.Error(w, "Failed to fetch ratings", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var ratings []models.RatingEntry
+	for rows.Next() {
+		var entry models.RatingEntry
+		if err := rows.Scan(&entry.UserID, &entry.UserName, &entry.Rating, &entry.ContestCount); err != nil {
+			continue
+		}
+		ratings = append(ratings, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
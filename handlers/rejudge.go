@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/rating"
+	"codesprint/standings"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// errRatingsApplied is returned by startRejudge when a rejudge that is not
+// forced covers official submissions of a finalized rated contest
+var errRatingsApplied = errors.New("rejudge covers a finalized rated contest")
+
+// submissionVerdicts are the verdicts a rejudge can be narrowed to
+var submissionVerdicts = map[string]bool{
+	judge.VerdictAccepted:            true,
+	judge.VerdictWrongAnswer:         true,
+	judge.VerdictPresentationError:   true,
+	judge.VerdictTimeLimitExceeded:   true,
+	judge.VerdictMemoryLimitExceeded: true,
+	judge.VerdictOutputLimitExceeded: true,
+	judge.VerdictRuntimeError:        true,
+	judge.VerdictCompilationError:    true,
+	judge.VerdictJudgeError:          true,
+}
+
+// RejudgeSubmission judges a submission again against its problem's current
+// version (problem author, contest owner or admin)
+func RejudgeSubmission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	submissionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid submission ID", http.StatusBadRequest)
+		return
+	}
+
+	var problemID, contestID int
+	var status string
+	err = database.DB.QueryRow(
+		"SELECT problem_id, COALESCE(contest_id, 0), status FROM submissions WHERE id = $1",
+		submissionID,
+	).Scan(&problemID, &contestID, &status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Submission not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch submission", http.StatusInternalServerError)
+		return
+	}
+
+	allowed, err := canManageProblem(userID, problemID)
+	if err == nil && !allowed && contestID != 0 {
+		allowed, err = canManageContest(userID, contestID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch submission", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the problem author, the contest owner or an admin can rejudge this submission", http.StatusForbidden)
+		return
+	}
+	if status == "pending" || status == "running" {
+		http.Error(w, "Submission is still being judged", http.StatusConflict)
+		return
+	}
+
+	rejudge := models.Rejudge{SubmissionID: &submissionID, CreatedBy: userID}
+	err = startRejudge(&rejudge, r.URL.Query().Get("force") == "true")
+	if err == errRatingsApplied {
+		http.Error(w, "Submission counts towards applied ratings; pass force=true to rejudge it and recompute ratings", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Printf("rejudge of submission %d: %v\n", submissionID, err)
+		http.Error(w, "Failed to rejudge submission", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rejudge)
+}
+
+// RejudgeProblem judges a problem's submissions again, optionally only those
+// with some verdicts (author or admin only)
+func RejudgeProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	problemID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "rejudge") {
+		return
+	}
+
+	req, ok := decodeRejudgeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rejudge := models.Rejudge{ProblemID: &problemID, Statuses: req.Statuses, CreatedBy: userID}
+	err = startRejudge(&rejudge, r.URL.Query().Get("force") == "true")
+	if err == errRatingsApplied {
+		http.Error(w, "Some submissions count towards applied ratings; pass force=true to rejudge them and recompute ratings", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Printf("rejudge of problem %d: %v\n", problemID, err)
+		http.Error(w, "Failed to rejudge submissions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rejudge)
+}
+
+// RejudgeContest judges a contest's submissions again, optionally only those
+// on one problem or with some verdicts (owner or admin only)
+func RejudgeContest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	contestID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+	allowed, err := canManageContest(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch contest", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Only the contest owner or an admin can rejudge this contest", http.StatusForbidden)
+		return
+	}
+
+	req, ok := decodeRejudgeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rejudge := models.Rejudge{ContestID: &contestID, Statuses: req.Statuses, CreatedBy: userID}
+	if req.ProblemID != 0 {
+		rejudge.ProblemID = &req.ProblemID
+	}
+	err = startRejudge(&rejudge, r.URL.Query().Get("force") == "true")
+	if err == errRatingsApplied {
+		http.Error(w, "Contest is finalized and rated; pass force=true to rejudge it and recompute ratings", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Printf("rejudge of contest %d: %v\n", contestID, err)
+		http.Error(w, "Failed to rejudge submissions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rejudge)
+}
+
+// decodeRejudgeRequest reads an optional rejudge filter from the request
+// body, writing the error response and returning false when it is invalid
+func decodeRejudgeRequest(w http.ResponseWriter, r *http.Request) (models.RejudgeRequest, bool) {
+	var req models.RejudgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	for _, status := range req.Statuses {
+		if !submissionVerdicts[status] {
+			http.Error(w, fmt.Sprintf("Unknown verdict %q", status), http.StatusBadRequest)
+			return req, false
+		}
+	}
+	if len(req.Statuses) == 0 {
+		req.Statuses = nil
+	}
+	return req, true
+}
+
+// startRejudge records a rejudge, moves the verdicts of the submissions it
+// covers into their history and queues them again against their problems'
+// current versions. Submissions still being judged are left alone. The
+// affected standings are rebuilt right away, with the rejudged submissions
+// pending. A rejudge covering official submissions of a finalized rated
+// contest fails with errRatingsApplied unless forced, in which case all
+// ratings are recomputed once the submissions are judged.
+func startRejudge(rejudge *models.Rejudge, force bool) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"INSERT INTO rejudges (submission_id, problem_id, contest_id, statuses, created_by) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		rejudge.SubmissionID, rejudge.ProblemID, rejudge.ContestID, pq.Array(rejudge.Statuses), rejudge.CreatedBy,
+	).Scan(&rejudge.ID, &rejudge.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id FROM submissions
+		WHERE ($1::int IS NULL OR id = $1)
+			AND ($2::int IS NULL OR problem_id = $2)
+			AND ($3::int IS NULL OR contest_id = $3)
+			AND ($4::text[] IS NULL OR status = ANY($4))
+			AND status NOT IN ('pending', 'running')
+		ORDER BY id
+		FOR UPDATE
+	`, rejudge.SubmissionID, rejudge.ProblemID, rejudge.ContestID, pq.Array(rejudge.Statuses))
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var ratingsApplied bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM submissions s
+			JOIN contests c ON c.id = s.contest_id
+			WHERE s.id = ANY($1) AND c.is_rated AND c.finalized_at IS NOT NULL
+				AND s.virtual_participation_id IS NULL AND NOT s.is_practice
+		)
+	`, pq.Array(ids)).Scan(&ratingsApplied)
+	if err != nil {
+		return err
+	}
+	if ratingsApplied && !force {
+		return errRatingsApplied
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO submission_verdicts (submission_id, rejudge_id, status, status_detail, score, runtime, memory, problem_version)
+		SELECT id, $1::int, status, status_detail, score, runtime, memory, problem_version FROM submissions WHERE id = ANY($2)
+	`, rejudge.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM submission_results WHERE submission_id = ANY($1)", pq.Array(ids)); err != nil {
+		return err
+	}
+
+	type queued struct {
+		id, userID, contestID, problemID int
+	}
+	var submissions []queued
+	rows, err = tx.Query(`
+		UPDATE submissions s SET status = 'pending', status_detail = NULL, score = 0, runtime = 0, memory = 0, problem_version = p.version,
+			judge_lease_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		FROM problems p
+		WHERE p.id = s.problem_id AND s.id = ANY($1)
+		RETURNING s.id, s.user_id, COALESCE(s.contest_id, 0), s.problem_id
+	`, pq.Array(ids), judgeLease.Seconds())
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var s queued
+		if err := rows.Scan(&s.id, &s.userID, &s.contestID, &s.problemID); err != nil {
+			rows.Close()
+			return err
+		}
+		submissions = append(submissions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE rejudges SET submission_count = $1 WHERE id = $2", len(submissions), rejudge.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	rejudge.SubmissionCount = len(submissions)
+	rejudge.SubmissionIDs = make([]int, len(submissions))
+	contests := map[int]bool{}
+	for i, s := range submissions {
+		rejudge.SubmissionIDs[i] = s.id
+		if s.contestID != 0 {
+			contests[s.contestID] = true
+		}
+	}
+	for contestID := range contests {
+		if err := standings.Rebuild(contestID); err != nil {
+			fmt.Printf("rejudge %d: failed to rebuild standings of contest %d: %v\n", rejudge.ID, contestID, err)
+		}
+	}
+	for _, s := range submissions {
+		publishSubmission(s.id, s.userID, s.contestID, s.problemID, "pending", "", 0, 0)
+	}
+
+	var done func()
+	if ratingsApplied {
+		rejudgeID := rejudge.ID
+		done = func() {
+			if err := rating.RecomputeAll(); err != nil {
+				fmt.Printf("rejudge %d: failed to recompute ratings: %v\n", rejudgeID, err)
+			}
+		}
+	}
+	judgeInOrder(rejudge.SubmissionIDs, done)
+	return nil
+}
+
+// loadVerdictHistory returns the verdicts a submission had before its
+// rejudges, oldest first
+func loadVerdictHistory(submissionID int) ([]models.SubmissionVerdict, error) {
+	rows, err := database.DB.Query(
+		"SELECT id, submission_id, rejudge_id, status, COALESCE(status_detail, ''), score, runtime, memory, problem_version, replaced_at FROM submission_verdicts WHERE submission_id = $1 ORDER BY replaced_at, id",
+		submissionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.SubmissionVerdict
+	for rows.Next() {
+		var v models.SubmissionVerdict
+		if err := rows.Scan(&v.ID, &v.SubmissionID, &v.RejudgeID, &v.Status, &v.StatusDetail, &v.Score, &v.Runtime, &v.Memory, &v.ProblemVersion, &v.ReplacedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, v)
+	}
+	return history, rows.Err()
+}
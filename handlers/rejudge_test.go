@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"codesprint/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRejudgeRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   models.RejudgeRequest
+		status int // of the error response; zero when the request is valid
+	}{
+		{name: "no body", body: ""},
+		{name: "empty object", body: "{}"},
+		{name: "empty statuses", body: `{"statuses": []}`},
+		{
+			name: "statuses and problem",
+			body: `{"statuses": ["wrong_answer", "judge_error"], "problem_id": 7}`,
+			want: models.RejudgeRequest{Statuses: []string{"wrong_answer", "judge_error"}, ProblemID: 7},
+		},
+		{name: "unknown verdict", body: `{"statuses": ["accepted", "pending"]}`, status: http.StatusBadRequest},
+		{name: "not json", body: `{"statuses": `, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/problem/7/rejudge", strings.NewReader(tt.body))
+		req, ok := decodeRejudgeRequest(w, r)
+		if ok != (tt.status == 0) {
+			t.Errorf("%s: ok %v, response %d %s", tt.name, ok, w.Code, w.Body)
+			continue
+		}
+		if !ok {
+			if w.Code != tt.status {
+				t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(req, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, req, tt.want)
+		}
+	}
+}
@@ -1,17 +1,24 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
 	"codesprint/database"
 	"codesprint/judge"
 	"codesprint/models"
+	"codesprint/standings"
 	"codesprint/utils"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
 // SubmitCode handles code submission
@@ -38,174 +45,436 @@ func SubmitCode(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Code and language are required", http.StatusBadRequest)
 		return
 	}
+	language, ok := judge.LookupLanguage(req.Language)
+	if !ok || !language.Enabled || !judge.Default.CanRun(language) {
+		http.Error(w, fmt.Sprintf("Unsupported language %q", req.Language), http.StatusBadRequest)
+		return
+	}
+	req.Language = language.Name
 
 	// Get problem to check time limit
 	var problem models.Problem
 	err := database.DB.QueryRow(
-		"SELECT id, contest_id, title, time_limit, memory_limit FROM problems WHERE id = $1",
+		"SELECT id, title, time_limit, memory_limit, is_public FROM problems WHERE id = $1",
 		req.ProblemID,
-	).Scan(&problem.ID, &problem.ContestID, &problem.Title, &problem.TimeLimit, &problem.MemoryLimit)
+	).Scan(&problem.ID, &problem.Title, &problem.TimeLimit, &problem.MemoryLimit, &problem.IsPublic)
 	if err != nil {
 		http.Error(w, "Problem not found", http.StatusNotFound)
 		return
 	}
 
-	// Get all testcases for the problem
-	rows, err := database.DB.Query(
-		"SELECT id, input, expected_output FROM testcases WHERE problem_id = $1",
-		req.ProblemID,
-	)
-	if err != nil {
-		http.Error(w, "Failed to fetch testcases", http.StatusInternalServerError)
+	// Without a contest the submission is archive practice on a public problem
+	var contestID *int
+	if req.ContestID != 0 {
+		contestID = &req.ContestID
+		var allowedLanguages []string
+		err = database.DB.QueryRow(`
+			SELECT c.allowed_languages
+			FROM contests c
+			JOIN contest_problems cp ON cp.contest_id = c.id
+			WHERE c.id = $1 AND cp.problem_id = $2
+		`, req.ContestID, req.ProblemID).Scan(pq.Array(&allowedLanguages))
+		if err != nil {
+			http.Error(w, "Problem not found in this contest", http.StatusNotFound)
+			return
+		}
+		if !languageAllowed(allowedLanguages, language.Name) {
+			http.Error(w, fmt.Sprintf("Language %q is not allowed in this contest", language.Name), http.StatusBadRequest)
+			return
+		}
+	} else if !problem.IsPublic {
+		http.Error(w, "Problem not found", http.StatusNotFound)
 		return
 	}
-	defer rows.Close()
 
-	var testcases []models.Testcase
-	for rows.Next() {
-		var tc models.Testcase
-		err := rows.Scan(&tc.ID, &tc.Input, &tc.ExpectedOutput)
+	// Submissions during a virtual participation are scored from the user's
+	// own start; any other submission after the contest ended is practice
+	var virtualParticipationID *int
+	if contestID != nil {
+		if vp, err := loadVirtualParticipation(userID, req.ContestID); err == nil && vp.Active {
+			virtualParticipationID = &vp.ID
+		}
+	}
+
+	// Create submission record, marking it pending on the leaderboard
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create submission", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the contest so its times cannot change before the submission is
+	// recorded; the end time decides whether it is practice
+	contestEnded := true
+	if contestID != nil {
+		err = tx.QueryRow(
+			"SELECT end_time < CURRENT_TIMESTAMP FROM contests WHERE id = $1 FOR SHARE",
+			req.ContestID,
+		).Scan(&contestEnded)
 		if err != nil {
-			continue
+			http.Error(w, "Contest not found", http.StatusNotFound)
+			return
 		}
-		testcases = append(testcases, tc)
 	}
+	isPractice := contestEnded && virtualParticipationID == nil
 
+	// Lock the problem so its current version cannot change before the
+	// submission records it, then judge against that version's testcases
+	var problemVersion int
+	err = tx.QueryRow(
+		"SELECT version, time_limit, judging_policy FROM problems WHERE id = $1 FOR SHARE",
+		req.ProblemID,
+	).Scan(&problemVersion, &problem.TimeLimit, &problem.JudgingPolicy)
+	if err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	testcases, err := loadVersionTestcases(tx, req.ProblemID, problemVersion)
+	if err != nil {
+		http.Error(w, "Failed to fetch testcases", http.StatusInternalServerError)
+		return
+	}
 	if len(testcases) == 0 {
 		http.Error(w, "No testcases found for this problem", http.StatusBadRequest)
 		return
 	}
+	judging, err := loadJudgingPrograms(tx, req.ProblemID, problemVersion)
+	if err != nil {
+		http.Error(w, "Failed to load checker", http.StatusInternalServerError)
+		return
+	}
+	if judging.Interactor != nil && !judge.Default.Interactive() {
+		http.Error(w, "This judge cannot run interactive problems", http.StatusServiceUnavailable)
+		return
+	}
+	if judging.Interactor != nil && language.Run == "" {
+		http.Error(w, "Interactive problems cannot be solved in "+language.DisplayName, http.StatusBadRequest)
+		return
+	}
+	if judging.Graders != nil && judging.Graders[language.Name] == nil {
+		http.Error(w, "This problem takes solutions in "+graderLanguages(judging.Graders)+" only", http.StatusBadRequest)
+		return
+	}
 
-	// Create submission record
 	var submissionID int
-	err = database.DB.QueryRow(
-		"INSERT INTO submissions (user_id, problem_id, contest_id, language, code, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		userID, req.ProblemID, req.ContestID, req.Language, req.Code, "pending",
+	err = tx.QueryRow(
+		"INSERT INTO submissions (user_id, problem_id, contest_id, language, code, status, virtual_participation_id, is_practice, problem_version, judge_lease_until) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP + $10 * INTERVAL '1 second') RETURNING id",
+		userID, req.ProblemID, contestID, req.Language, req.Code, "pending", virtualParticipationID, isPractice, problemVersion, judgeLease.Seconds(),
 	).Scan(&submissionID)
 	if err != nil {
 		http.Error(w, "Failed to create submission", http.StatusInternalServerError)
 		return
 	}
+	if err := standings.ApplySubmission(tx, submissionID); err != nil {
+		fmt.Printf("submission %d: failed to update standings: %v\n", submissionID, err)
+		http.Error(w, "Failed to create submission", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create submission", http.StatusInternalServerError)
+		return
+	}
+	publishSubmission(submissionID, userID, req.ContestID, req.ProblemID, "pending", "", 0, 0)
 
 	// Process submission asynchronously
-	go processSubmission(submissionID, req.Code, req.Language, testcases, problem.TimeLimit)
+	go processSubmission(submissionID, req.Code, req.Language, testcases, judging, problem.TimeLimit, problem.MemoryLimit, problem.JudgingPolicy)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"submission_id": submissionID,
-		"status":        "pending",
+		"submission_id":   submissionID,
+		"status":          "pending",
+		"virtual":         virtualParticipationID != nil,
+		"practice":        isPractice,
+		"problem_version": problemVersion,
 	})
 }
 
-// processSubmission processes a submission against all testcases
-func processSubmission(submissionID int, code, language string, testcases []models.Testcase, timeLimit int) {
-	languageID := judge.GetLanguageID(language)
-	allPassed := true
+// processSubmission processes a submission against all testcases, judging
+// outputs with the problem's checker when it has one
+func processSubmission(submissionID int, code, language string, testcases []models.Testcase, judging judgingPrograms, timeLimit, memoryLimit int, policy string) {
+	passed := 0
 	totalRuntime := 0
+	peakMemory := 0
 	finalStatus := "accepted"
-
-	// Process each testcase
-	for _, tc := range testcases {
-		// Submit to Judge0
-		result, err := judge.SubmitCode(code, languageID, tc.Input)
-		if err != nil {
-			fmt.Printf("submission %d: SubmitCode error: %v\n", submissionID, err)
-			finalStatus = "runtime_error"
-			allPassed = false
+	finalDetail := ""
+	defer keepClaim(submissionID)()
+
+	// While Judge0 is unavailable the submission stays queued, until it has
+	// waited judgeQueueTimeout and gets judge_error
+	results := judgeTestcases(code, language, testcases, judging, timeLimit, memoryLimit, policy != policyRunAll)
+	queuedUntil := time.Now().Add(judgeQueueTimeout)
+	for client := unavailableJudge0(language, results); client != nil; client = unavailableJudge0(language, results) {
+		if time.Now().After(queuedUntil) {
+			fmt.Printf("submission %d: judge still unavailable, giving up\n", submissionID)
 			break
 		}
+		fmt.Printf("submission %d: judge unavailable, keeping it queued\n", submissionID)
+		client.WaitAvailable(judgeRetryDelay)
+		results = judgeTestcases(code, language, testcases, judging, timeLimit, memoryLimit, policy != policyRunAll)
+	}
 
-		fmt.Printf("submission %d: submitted to Judge0 token=%s\n", submissionID, result.Token)
-
-		// Poll for result
-		pollResult, err := judge.PollSubmissionResult(result.Token, 30, time.Second*2)
-		if err != nil {
-			fmt.Printf("submission %d: PollSubmissionResult error: %v\n", submissionID, err)
-			finalStatus = "runtime_error"
-			allPassed = false
-			break
+	// The verdict is the first failing testcase's; under run_all the
+	// remaining testcases still count towards the score
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("submission %d: testcase %d: %v\n", submissionID, result.Testcase.ID, result.Err)
 		}
-
-		if pollResult != nil && pollResult.Status != nil {
-			fmt.Printf("submission %d: token=%s status=%d (%s)\n", submissionID, result.Token, pollResult.Status.ID, pollResult.Status.Description)
+		if result.Runtime > totalRuntime {
+			totalRuntime = result.Runtime
 		}
-
-		// Parse runtime
-		if pollResult.Time != "" {
-			// Judge0 returns time as "0.001" (seconds), convert to milliseconds
-			var runtimeSeconds float64
-			fmt.Sscanf(pollResult.Time, "%f", &runtimeSeconds)
-			runtimeMs := int(runtimeSeconds * 1000)
-			if runtimeMs > totalRuntime {
-				totalRuntime = runtimeMs
-			}
+		if result.Memory > peakMemory {
+			peakMemory = result.Memory
 		}
 
-		// Check result status
-		status := judge.MapJudge0StatusToInternal(pollResult.Status.ID)
-
-		// Check if output matches (only if Judge0 says accepted)
-		if pollResult.Status.ID == 3 { // Judge0 accepted status
-			// Trim whitespace for comparison
-			output := trimWhitespace(pollResult.Stdout)
-			expected := trimWhitespace(tc.ExpectedOutput)
-			if output != expected {
-				status = "wrong_answer"
-			}
-		}
-
-		if status != "accepted" {
-			finalStatus = status
-			allPassed = false
-			break
+		if result.Status == "accepted" {
+			passed++
+		} else if finalStatus == "accepted" {
+			finalStatus, finalDetail = result.Status, result.Detail
 		}
 	}
 
 	// Calculate score
 	score := 0
-	if allPassed {
+	if finalStatus == "accepted" {
 		score = 100
+	} else if policy == policyRunAll {
+		score = passed * 100 / len(testcases)
 	}
 
-	// Update submission
-	_, err := database.DB.Exec(
-		"UPDATE submissions SET status = $1, score = $2, runtime = $3 WHERE id = $4",
-		finalStatus, score, totalRuntime, submissionID,
-	)
-	if err != nil {
+	// Update submission, testcase results and standings together
+	if err := finishSubmission(submissionID, finalStatus, finalDetail, score, totalRuntime, peakMemory, results); err != nil {
 		fmt.Printf("Failed to update submission %d: %v\n", submissionID, err)
 	}
+}
 
-	// Update leaderboard cache
-	updateLeaderboardCache(submissionID)
+// judgeTestcase runs a program on one testcase and returns its verdict and
+// runtime in milliseconds. Failures of the judge itself come back as
+// judge_error together with the error.
+func judgeTestcase(ctx context.Context, code, language string, tc models.Testcase, judging judgingPrograms, timeLimit, memoryLimit int) testcaseResult {
+	lang, ok := judge.LookupLanguage(language)
+	if !ok {
+		return judgeFailure(tc, fmt.Errorf("unknown language %q", language))
+	}
+	timeLimit = lang.TimeLimit(timeLimit)
+
+	if judging.Interactor != nil {
+		return judgeInteractive(ctx, code, language, tc, judging.Interactor, timeLimit, memoryLimit)
+	}
+
+	var pollResult *judge.Judge0Response
+	if judging.Graders != nil {
+		// Function-style problems build the program with the grader
+		input, err := readTestcaseData(openTestcaseInput(tc))
+		if err != nil {
+			return judgeFailure(tc, fmt.Errorf("failed to read input: %w", err))
+		}
+		if pollResult, err = runWithGrader(ctx, code, language, judging.Graders, string(input), timeLimit, memoryLimit); err != nil {
+			return judgeFailure(tc, fmt.Errorf("grader run error: %w", err))
+		}
+	} else {
+		// Run the program, streaming the input from storage
+		input, err := openTestcaseInput(tc)
+		if err != nil {
+			return judgeFailure(tc, fmt.Errorf("failed to open input: %w", err))
+		}
+		pollResult, err = judge.Default.Run(lang, code, input, judge.Limits{CPUTime: float64(timeLimit) / 1000, Memory: memoryLimit * 1024})
+		input.Close()
+		if err != nil {
+			return judgeFailure(tc, fmt.Errorf("run error: %w", err))
+		}
+	}
+	return checkRun(ctx, pollResult, tc, judging, memoryLimit)
 }
 
-func trimWhitespace(s string) string {
-	// Trim leading and trailing whitespace, normalize line endings
-	lines := []string{}
-	currentLine := ""
-	for _, char := range s {
-		if char == '\n' || char == '\r' {
-			if len(currentLine) > 0 {
-				lines = append(lines, currentLine)
-				currentLine = ""
-			}
+// judgeFailure is the result of a testcase the judge failed to judge
+func judgeFailure(tc models.Testcase, err error) testcaseResult {
+	return testcaseResult{Testcase: tc, Status: judge.VerdictJudgeError, Err: err}
+}
+
+// checkRun turns the result of a run on a testcase into its verdict, runtime
+// and memory, checking the output of accepted runs. Runs over the memory
+// limit, in megabytes, get memory_limit_exceeded unless they ran out of time.
+func checkRun(ctx context.Context, pollResult *judge.Judge0Response, tc models.Testcase, judging judgingPrograms, memoryLimit int) testcaseResult {
+	result := testcaseResult{Testcase: tc, Memory: pollResult.Memory}
+
+	// Parse runtime
+	if pollResult.Time != "" {
+		// Judge0 returns time as "0.001" (seconds), convert to milliseconds
+		var runtimeSeconds float64
+		fmt.Sscanf(pollResult.Time, "%f", &runtimeSeconds)
+		result.Runtime = int(runtimeSeconds * 1000)
+	}
+
+	// Check result status
+	result.Status, result.Detail = pollResult.Verdict()
+	if result.Status == judge.VerdictJudgeError {
+		result.Err = fmt.Errorf("Judge0 failed: %s", result.Detail)
+		return result
+	}
+	if result.Status != judge.VerdictTimeLimitExceeded && memoryExceeded(result.Memory, memoryLimit) {
+		result.Status, result.Detail = judge.VerdictMemoryLimitExceeded, ""
+		return result
+	}
+
+	// Check if output matches (only if Judge0 says accepted)
+	if result.Status == judge.VerdictAccepted {
+		var err error
+		if judging.Checker != nil {
+			result.Status, err = runChecker(ctx, judging.Checker, tc, pollResult.Stdout)
 		} else {
-			currentLine += string(char)
+			result.Status, err = outputVerdict(pollResult.Stdout, tc)
+		}
+		if err != nil {
+			result.Status, result.Err = judge.VerdictJudgeError, fmt.Errorf("failed to check output: %w", err)
+		}
+	}
+	return result
+}
+
+// finishSubmission records a submission's verdict and its testcase results
+// and applies it to the contest standings in a single transaction
+func finishSubmission(submissionID int, status, detail string, score, runtime, memory int, results []testcaseResult) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID, contestID, problemID int
+	err = tx.QueryRow(
+		"UPDATE submissions SET status = $1, status_detail = NULLIF($2, ''), score = $3, runtime = $4, memory = $5, judge_lease_until = NULL WHERE id = $6 RETURNING user_id, COALESCE(contest_id, 0), problem_id",
+		status, detail, score, runtime, memory, submissionID,
+	).Scan(&userID, &contestID, &problemID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM submission_results WHERE submission_id = $1", submissionID); err != nil {
+		return err
+	}
+	for i, result := range results {
+		_, err := tx.Exec(
+			"INSERT INTO submission_results (submission_id, position, testcase_id, status, status_detail, runtime, memory) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)",
+			submissionID, i+1, result.Testcase.ID, result.Status, result.Detail, result.Runtime, result.Memory,
+		)
+		if err != nil {
+			return err
 		}
 	}
-	if len(currentLine) > 0 {
-		lines = append(lines, currentLine)
+	if err := standings.ApplySubmission(tx, submissionID); err != nil {
+		return err
 	}
-	// Join lines with newline
-	result := ""
-	for i, line := range lines {
-		if i > 0 {
-			result += "\n"
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	publishSubmission(submissionID, userID, contestID, problemID, status, detail, score, runtime)
+	return nil
+}
+
+// outputMatches compares a program's output with a testcase's expected output,
+// ignoring blank lines and line-ending style, streaming the expected output
+// from storage
+func outputMatches(output string, tc models.Testcase) (bool, error) {
+	expected, err := openTestcaseOutput(tc)
+	if err != nil {
+		return false, err
+	}
+	defer expected.Close()
+
+	got := newLineScanner(strings.NewReader(output))
+	want := newLineScanner(expected)
+	for {
+		gotMore, wantMore := got.Scan(), want.Scan()
+		if gotMore != wantMore {
+			return false, want.Err()
+		}
+		if !gotMore {
+			return true, want.Err()
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			return false, nil
 		}
-		result += line
 	}
-	return result
+}
+
+// memoryExceeded reports whether a run's peak memory in kilobytes is over a
+// memory limit in megabytes
+func memoryExceeded(memory, memoryLimit int) bool {
+	return memoryLimit > 0 && memory > memoryLimit*1024
+}
+
+// outputVerdict compares a program's output with a testcase's expected
+// output: accepted when the lines match, presentation_error when only the
+// whitespace differs, wrong_answer otherwise
+func outputVerdict(output string, tc models.Testcase) (string, error) {
+	match, err := outputMatches(output, tc)
+	if err != nil || match {
+		return judge.VerdictAccepted, err
+	}
+	if match, err = tokensMatch(output, tc); err != nil {
+		return "", err
+	}
+	if match {
+		return judge.VerdictPresentationError, nil
+	}
+	return judge.VerdictWrongAnswer, nil
+}
+
+// tokensMatch reports whether a program's output has the tokens of a
+// testcase's expected output, however they are spaced
+func tokensMatch(output string, tc models.Testcase) (bool, error) {
+	expected, err := openTestcaseOutput(tc)
+	if err != nil {
+		return false, err
+	}
+	defer expected.Close()
+
+	got := newTokenScanner(strings.NewReader(output))
+	want := newTokenScanner(expected)
+	for {
+		gotMore, wantMore := got.Scan(), want.Scan()
+		if gotMore != wantMore {
+			return false, want.Err()
+		}
+		if !gotMore {
+			return true, want.Err()
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			return false, nil
+		}
+	}
+}
+
+// newTokenScanner returns a scanner over the whitespace-separated tokens of r
+func newTokenScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTestcaseFileSize)
+	scanner.Split(bufio.ScanWords)
+	return scanner
+}
+
+// newLineScanner returns a scanner over the non-empty lines of r, split at \n or \r
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTestcaseFileSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		start := 0
+		for start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+			start++
+		}
+		for i := start; i < len(data); i++ {
+			if data[i] == '\n' || data[i] == '\r' {
+				return i + 1, data[start:i], nil
+			}
+		}
+		if atEOF && start < len(data) {
+			return len(data), data[start:], nil
+		}
+		// Request more data, dropping the separators already skipped
+		return start, nil, nil
+	})
+	return scanner
 }
 
 // GetSubmission returns a submission by ID
@@ -229,19 +498,53 @@ func GetSubmission(w http.ResponseWriter, r *http.Request) {
 
 	var submission models.Submission
 	err = database.DB.QueryRow(
-		"SELECT id, user_id, problem_id, contest_id, language, code, status, score, runtime, created_at FROM submissions WHERE id = $1",
+		"SELECT id, user_id, problem_id, COALESCE(contest_id, 0), language, code, status, COALESCE(status_detail, ''), score, runtime, memory, virtual_participation_id, is_practice, problem_version, created_at FROM submissions WHERE id = $1",
 		submissionID,
-	).Scan(&submission.ID, &submission.UserID, &submission.ProblemID, &submission.ContestID, &submission.Language, &submission.Code, &submission.Status, &submission.Score, &submission.Runtime, &submission.CreatedAt)
+	).Scan(&submission.ID, &submission.UserID, &submission.ProblemID, &submission.ContestID, &submission.Language, &submission.Code, &submission.Status, &submission.StatusDetail, &submission.Score, &submission.Runtime, &submission.Memory, &submission.VirtualParticipationID, &submission.IsPractice, &submission.ProblemVersion, &submission.CreatedAt)
 	if err != nil {
 		http.Error(w, "Submission not found", http.StatusNotFound)
 		return
 	}
+	submission.Results, err = loadSubmissionResults(submissionID)
+	if err != nil {
+		http.Error(w, "Failed to fetch testcase results", http.StatusInternalServerError)
+		return
+	}
+	submission.History, err = loadVerdictHistory(submissionID)
+	if err != nil {
+		http.Error(w, "Failed to fetch verdict history", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(submission)
 }
 
-// GetUserSubmissions returns all submissions for a user in a contest
+// loadSubmissionResults returns a submission's verdicts on the testcases it
+// ran on, in testcase order
+func loadSubmissionResults(submissionID int) ([]models.SubmissionResult, error) {
+	rows, err := database.DB.Query(
+		"SELECT position, testcase_id, status, COALESCE(status_detail, ''), runtime, memory FROM submission_results WHERE submission_id = $1 ORDER BY position",
+		submissionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.SubmissionResult
+	for rows.Next() {
+		var result models.SubmissionResult
+		if err := rows.Scan(&result.Position, &result.TestcaseID, &result.Status, &result.StatusDetail, &result.Runtime, &result.Memory); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// GetUserSubmissions returns all submissions for a user in a contest, or in
+// the practice archive
 func GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -254,15 +557,19 @@ func GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	contestIDStr := r.URL.Query().Get("contest_id")
-	contestID, err := strconv.Atoi(contestIDStr)
-	if err != nil {
-		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
-		return
+	// Without contest_id, list the user's archive practice submissions
+	contestID := 0
+	if contestIDStr := r.URL.Query().Get("contest_id"); contestIDStr != "" {
+		var err error
+		contestID, err = strconv.Atoi(contestIDStr)
+		if err != nil {
+			http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+			return
+		}
 	}
 
 	rows, err := database.DB.Query(
-		"SELECT id, user_id, problem_id, contest_id, language, status, score, runtime, created_at FROM submissions WHERE user_id = $1 AND contest_id = $2 ORDER BY created_at DESC",
+		"SELECT id, user_id, problem_id, COALESCE(contest_id, 0), language, status, COALESCE(status_detail, ''), score, runtime, memory, virtual_participation_id, is_practice, problem_version, created_at FROM submissions WHERE user_id = $1 AND COALESCE(contest_id, 0) = $2 ORDER BY created_at DESC",
 		userID, contestID,
 	)
 	if err != nil {
@@ -274,7 +581,7 @@ func GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
 	var submissions []models.Submission
 	for rows.Next() {
 		var sub models.Submission
-		err := rows.Scan(&sub.ID, &sub.UserID, &sub.ProblemID, &sub.ContestID, &sub.Language, &sub.Status, &sub.Score, &sub.Runtime, &sub.CreatedAt)
+		err := rows.Scan(&sub.ID, &sub.UserID, &sub.ProblemID, &sub.ContestID, &sub.Language, &sub.Status, &sub.StatusDetail, &sub.Score, &sub.Runtime, &sub.Memory, &sub.VirtualParticipationID, &sub.IsPractice, &sub.ProblemVersion, &sub.CreatedAt)
 		if err != nil {
 			continue
 		}
@@ -284,66 +591,3 @@ func GetUserSubmissions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(submissions)
 }
-
-// updateLeaderboardCache updates the leaderboard cache for a submission
-func updateLeaderboardCache(submissionID int) {
-	var submission models.Submission
-	err := database.DB.QueryRow(
-		"SELECT user_id, contest_id, problem_id, status, created_at FROM submissions WHERE id = $1",
-		submissionID,
-	).Scan(&submission.UserID, &submission.ContestID, &submission.ProblemID, &submission.Status, &submission.CreatedAt)
-	if err != nil {
-		return
-	}
-
-	// Only count accepted submissions
-	if submission.Status != "accepted" {
-		return
-	}
-
-	// Check if this is the first accepted submission for this problem
-	var existingCount int
-	err = database.DB.QueryRow(
-		"SELECT COUNT(*) FROM submissions WHERE user_id = $1 AND contest_id = $2 AND problem_id = $3 AND status = 'accepted'",
-		submission.UserID, submission.ContestID, submission.ProblemID,
-	).Scan(&existingCount)
-	if err != nil || existingCount > 1 {
-		// Not the first accepted, don't update
-		return
-	}
-
-	// Get current leaderboard entry
-	var solvedCount, penalty int
-	var lastSubmissionTime time.Time
-	err = database.DB.QueryRow(
-		"SELECT solved_count, penalty, last_submission_time FROM leaderboard_cache WHERE contest_id = $1 AND user_id = $2",
-		submission.ContestID, submission.UserID,
-	).Scan(&solvedCount, &penalty, &lastSubmissionTime)
-
-	if err != nil {
-		// Create new entry
-		contestStart, _ := getContestStartTime(submission.ContestID)
-		penaltyMinutes := int(submission.CreatedAt.Sub(contestStart).Minutes())
-		database.DB.Exec(
-			"INSERT INTO leaderboard_cache (contest_id, user_id, solved_count, penalty, last_submission_time) VALUES ($1, $2, $3, $4, $5)",
-			submission.ContestID, submission.UserID, 1, penaltyMinutes, submission.CreatedAt,
-		)
-	} else {
-		// Update existing entry
-		contestStart, _ := getContestStartTime(submission.ContestID)
-		penaltyMinutes := int(submission.CreatedAt.Sub(contestStart).Minutes())
-		database.DB.Exec(
-			"UPDATE leaderboard_cache SET solved_count = solved_count + 1, penalty = penalty + $1, last_submission_time = $2 WHERE contest_id = $3 AND user_id = $4",
-			penaltyMinutes, submission.CreatedAt, submission.ContestID, submission.UserID,
-		)
-	}
-}
-
-func getContestStartTime(contestID int) (time.Time, error) {
-	var startTime time.Time
-	err := database.DB.QueryRow(
-		"SELECT start_time FROM contests WHERE id = $1",
-		contestID,
-	).Scan(&startTime)
-	return startTime, err
-}
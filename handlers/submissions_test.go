@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"codesprint/judge"
+	"codesprint/models"
+	"testing"
+)
+
+func TestOutputVerdict(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+		want     string
+	}{
+		{"exact", "1 2\n3\n", "1 2\n3\n", judge.VerdictAccepted},
+		{"no trailing newline", "1 2\n3", "1 2\n3\n", judge.VerdictAccepted},
+		{"crlf line endings", "1 2\r\n3\r\n", "1 2\n3\n", judge.VerdictAccepted},
+		{"blank lines", "\n1 2\n\n3\n\n", "1 2\n3\n", judge.VerdictAccepted},
+		{"both empty", "", "", judge.VerdictAccepted},
+		{"tokens split across lines", "1\n2\n3\n", "1 2\n3\n", judge.VerdictPresentationError},
+		{"extra spaces", "1  2 \n3\n", "1 2\n3\n", judge.VerdictPresentationError},
+		{"wrong token", "1 2\n4\n", "1 2\n3\n", judge.VerdictWrongAnswer},
+		{"missing line", "1 2\n", "1 2\n3\n", judge.VerdictWrongAnswer},
+		{"extra line", "1 2\n3\n4\n", "1 2\n3\n", judge.VerdictWrongAnswer},
+		{"empty output", "", "1\n", judge.VerdictWrongAnswer},
+	}
+	for _, tt := range tests {
+		got, err := outputVerdict(tt.output, models.Testcase{ExpectedOutput: tt.expected})
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %s, %v; want %s", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestMemoryExceeded(t *testing.T) {
+	tests := []struct {
+		memory      int // kilobytes
+		memoryLimit int // megabytes
+		want        bool
+	}{
+		{0, 256, false},
+		{256 * 1024, 256, false},
+		{256*1024 + 1, 256, true},
+		{1 << 30, 0, false}, // no limit
+		{1, 0, false},
+	}
+	for _, tt := range tests {
+		if got := memoryExceeded(tt.memory, tt.memoryLimit); got != tt.want {
+			t.Errorf("memoryExceeded(%d KB, %d MB) = %v, want %v", tt.memory, tt.memoryLimit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"archive/zip"
+	"codesprint/database"
+	"codesprint/problempkg"
+	"codesprint/storage"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxTestcaseArchiveSize caps the size of an uploaded testcase archive
+	maxTestcaseArchiveSize = 512 << 20
+	// maxTestcaseFileSize caps the uncompressed size of a single testcase file
+	maxTestcaseFileSize = 64 << 20
+)
+
+// Extensions recognised for the two halves of a testcase
+var (
+	testcaseInputExts  = []string{".in", ".input"}
+	testcaseOutputExts = []string{".out", ".ans", ".output"}
+)
+
+// archiveTestcase is one input/output pair of a testcase archive
+type archiveTestcase struct {
+	Name     string
+	Input    *zip.File
+	Output   *zip.File
+	IsSample bool
+}
+
+// UploadTestcases adds the testcases in a zip archive to the current version
+// of a problem (author or admin only). The multipart form carries the zip in
+// "archive"; replace=true removes the existing testcases first. Files are
+// paired by name (01.in with 01.out or 01.ans); tests named sample* or in a
+// sample(s) directory are marked as samples.
+func UploadTestcases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "add testcases to") {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTestcaseArchiveSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Invalid multipart form or archive too large", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		http.Error(w, "archive file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	archive, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		http.Error(w, "archive is not a valid zip file", http.StatusBadRequest)
+		return
+	}
+	testcases, err := readTestcaseArchive(archive)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	replace := r.FormValue("replace") == "true"
+
+	// Move the data into blob storage before touching the database
+	blobs := make([][2]storage.Blob, len(testcases))
+	for i, tc := range testcases {
+		if blobs[i], err = storeArchiveTestcase(tc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to upload testcases", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := editableVersion(tx, problemID)
+	if err != nil {
+		http.Error(w, "Failed to upload testcases", http.StatusInternalServerError)
+		return
+	}
+	removed := 0
+	if replace {
+		if removed, err = removeVersionTestcases(tx, problemID, version, false); err != nil {
+			http.Error(w, "Failed to replace testcases", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	ids := make([]int, 0, len(testcases))
+	for i, tc := range testcases {
+		id, err := insertTestcase(tx, problemID, version, blobs[i][0], blobs[i][1], tc.IsSample)
+		if err != nil {
+			http.Error(w, "Failed to upload testcases", http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to upload testcases", http.StatusInternalServerError)
+		return
+	}
+
+	names := make([]string, len(testcases))
+	samples := 0
+	for i, tc := range testcases {
+		names[i] = tc.Name
+		if tc.IsSample {
+			samples++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"problem_id":      problemID,
+		"problem_version": version,
+		"added":           len(ids),
+		"samples":         samples,
+		"removed":         removed,
+		"testcase_ids":    ids,
+		"names":           names,
+	})
+}
+
+// readTestcaseArchive pairs the input and output files of a zip archive into
+// testcases, in natural name order. Every input needs an output and vice versa.
+func readTestcaseArchive(archive *zip.Reader) ([]archiveTestcase, error) {
+	inputs := map[string]*zip.File{}
+	outputs := map[string]*zip.File{}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || isArchiveJunk(f.Name) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.Name))
+		key := strings.TrimSuffix(f.Name, path.Ext(f.Name))
+		switch {
+		case hasExt(testcaseInputExts, ext):
+			if _, dup := inputs[key]; dup {
+				return nil, fmt.Errorf("duplicate input for test %s", key)
+			}
+			inputs[key] = f
+		case hasExt(testcaseOutputExts, ext):
+			if _, dup := outputs[key]; dup {
+				return nil, fmt.Errorf("duplicate output for test %s", key)
+			}
+			outputs[key] = f
+		default:
+			return nil, fmt.Errorf("unexpected file %s: expected .in/.out or .in/.ans pairs", f.Name)
+		}
+	}
+
+	keys := make([]string, 0, len(inputs))
+	for key := range inputs {
+		if _, ok := outputs[key]; !ok {
+			return nil, fmt.Errorf("test %s has no output file", key)
+		}
+		keys = append(keys, key)
+	}
+	for key := range outputs {
+		if _, ok := inputs[key]; !ok {
+			return nil, fmt.Errorf("test %s has no input file", key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("archive contains no testcases")
+	}
+	sort.Slice(keys, func(i, j int) bool { return problempkg.NaturalLess(keys[i], keys[j]) })
+
+	testcases := make([]archiveTestcase, 0, len(keys))
+	for _, key := range keys {
+		testcases = append(testcases, archiveTestcase{
+			Name:     key,
+			Input:    inputs[key],
+			Output:   outputs[key],
+			IsSample: isSampleName(key),
+		})
+	}
+	return testcases, nil
+}
+
+// storeArchiveTestcase copies both files of a testcase into blob storage
+func storeArchiveTestcase(tc archiveTestcase) ([2]storage.Blob, error) {
+	var blobs [2]storage.Blob
+	for i, f := range []*zip.File{tc.Input, tc.Output} {
+		blob, err := storeArchiveFile(f)
+		if err != nil {
+			return blobs, err
+		}
+		blobs[i] = blob
+	}
+	return blobs, nil
+}
+
+// storeArchiveFile streams one file of an archive into blob storage, refusing oversized files
+func storeArchiveFile(f *zip.File) (storage.Blob, error) {
+	if f.UncompressedSize64 > maxTestcaseFileSize {
+		return storage.Blob{}, fmt.Errorf("%s is larger than %d MB", f.Name, maxTestcaseFileSize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return storage.Blob{}, fmt.Errorf("failed to read %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	// The header size can lie; never read past the limit
+	blob, err := storage.Put(io.LimitReader(rc, maxTestcaseFileSize+1))
+	if err != nil {
+		return storage.Blob{}, fmt.Errorf("failed to store %s: %v", f.Name, err)
+	}
+	if blob.Size > maxTestcaseFileSize {
+		return storage.Blob{}, fmt.Errorf("%s is larger than %d MB", f.Name, maxTestcaseFileSize>>20)
+	}
+	return blob, nil
+}
+
+// removeVersionTestcases removes every testcase, or with generatedOnly every
+// generated testcase, from an editable version of a problem: testcases only
+// that version has are deleted, older ones are closed off so earlier versions
+// keep them. It returns how many were removed.
+func removeVersionTestcases(tx *sql.Tx, problemID, version int, generatedOnly bool) (int, error) {
+	res, err := tx.Exec(
+		"DELETE FROM testcases WHERE problem_id = $1 AND added_in_version = $2 AND ($3 = FALSE OR generated_by IS NOT NULL)",
+		problemID, version, generatedOnly,
+	)
+	if err != nil {
+		return 0, err
+	}
+	deleted, _ := res.RowsAffected()
+
+	res, err = tx.Exec(
+		"UPDATE testcases SET removed_in_version = $1 WHERE problem_id = $2 AND removed_in_version IS NULL AND ($3 = FALSE OR generated_by IS NOT NULL)",
+		version, problemID, generatedOnly,
+	)
+	if err != nil {
+		return 0, err
+	}
+	closed, _ := res.RowsAffected()
+	return int(deleted + closed), nil
+}
+
+func hasExt(exts []string, ext string) bool {
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// isArchiveJunk reports whether a file is metadata added by archivers
+func isArchiveJunk(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") || base == "Thumbs.db"
+}
+
+// isSampleName reports whether a test is a sample: named sample*/example* or
+// placed in a sample(s)/example(s) directory
+func isSampleName(key string) bool {
+	lower := strings.ToLower(key)
+	for _, part := range strings.Split(lower, "/") {
+		if strings.HasPrefix(part, "sample") || strings.HasPrefix(part, "example") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// zipArchive builds a zip of the named files, in order
+func zipArchive(t *testing.T, files map[string]string, order ...string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		var err error
+		if strings.HasSuffix(name, "/") {
+			_, err = zw.Create(name)
+		} else {
+			var w io.Writer
+			if w, err = zw.Create(name); err == nil {
+				_, err = w.Write([]byte(files[name]))
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReadTestcaseArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string // name=content
+		want    []string // test names, with * for samples
+		wantErr string
+	}{
+		{
+			name:  "pairs in natural order",
+			files: []string{"10.in=a", "10.out=b", "2.in=c", "2.ans=d", "1.input=e", "1.output=f"},
+			want:  []string{"1", "2", "10"},
+		},
+		{
+			name:  "samples by name and directory",
+			files: []string{"samples/", "samples/1.in=a", "samples/1.out=b", "sample2.in=c", "sample2.out=d", "tests/3.in=e", "tests/3.out=f"},
+			want:  []string{"sample2*", "samples/1*", "tests/3"},
+		},
+		{
+			name:  "empty expected output",
+			files: []string{"1.in=a", "1.out="},
+			want:  []string{"1"},
+		},
+		{
+			name:  "archiver junk skipped",
+			files: []string{"1.in=a", "1.out=b", "__MACOSX/._1.in=x", ".DS_Store=x", "Thumbs.db=x"},
+			want:  []string{"1"},
+		},
+		{
+			name:    "input without output",
+			files:   []string{"1.in=a", "1.out=b", "2.in=c"},
+			wantErr: "test 2 has no output file",
+		},
+		{
+			name:    "output without input",
+			files:   []string{"1.ans=b"},
+			wantErr: "test 1 has no input file",
+		},
+		{
+			name:    "duplicate output",
+			files:   []string{"1.in=a", "1.out=b", "1.ans=c"},
+			wantErr: "duplicate output for test 1",
+		},
+		{
+			name:    "unexpected file",
+			files:   []string{"1.in=a", "1.out=b", "readme.txt=c"},
+			wantErr: "unexpected file readme.txt",
+		},
+		{
+			name:    "no testcases",
+			files:   []string{"tests/"},
+			wantErr: "archive contains no testcases",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			var order []string
+			for _, f := range tt.files {
+				name, content, _ := strings.Cut(f, "=")
+				files[name] = content
+				order = append(order, name)
+			}
+			testcases, err := readTestcaseArchive(zipArchive(t, files, order...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tc := range testcases {
+				name := tc.Name
+				if tc.IsSample {
+					name += "*"
+				}
+				got = append(got, name)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got tests %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSampleName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"sample1", true},
+		{"Sample-2", true},
+		{"example", true},
+		{"samples/01", true},
+		{"Examples/a", true},
+		{"group/sample/3", true},
+		{"01", false},
+		{"tests/01", false},
+		{"mysample", false},
+		{"resample/1", false},
+	}
+	for _, tt := range tests {
+		if got := isSampleName(tt.key); got != tt.want {
+			t.Errorf("isSampleName(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"codesprint/models"
+	"codesprint/storage"
+	"database/sql"
+	"io"
+	"strings"
+)
+
+// insertTestcase adds a testcase whose data is already in blob storage to a
+// version of a problem and returns its ID
+func insertTestcase(tx *sql.Tx, problemID, version int, input, output storage.Blob, isSample bool) (int, error) {
+	var id int
+	err := tx.QueryRow(`
+		INSERT INTO testcases (problem_id, input_hash, input_size, output_hash, output_size, is_sample, added_in_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`, problemID, input.Hash, input.Size, output.Hash, output.Size, isSample, version).Scan(&id)
+	return id, err
+}
+
+// insertGeneratedTestcase adds a generated testcase, recording the generator
+// invocation that produced it
+func insertGeneratedTestcase(tx *sql.Tx, problemID, version int, input, output storage.Blob, isSample bool, invocation string) (int, error) {
+	var id int
+	err := tx.QueryRow(`
+		INSERT INTO testcases (problem_id, input_hash, input_size, output_hash, output_size, is_sample, added_in_version, generated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	`, problemID, input.Hash, input.Size, output.Hash, output.Size, isSample, version, invocation).Scan(&id)
+	return id, err
+}
+
+// openTestcaseInput returns a reader for a testcase's input
+func openTestcaseInput(tc models.Testcase) (io.ReadCloser, error) {
+	if tc.InputHash == "" {
+		return io.NopCloser(strings.NewReader(tc.Input)), nil
+	}
+	return storage.Open(tc.InputHash)
+}
+
+// openTestcaseOutput returns a reader for a testcase's expected output
+func openTestcaseOutput(tc models.Testcase) (io.ReadCloser, error) {
+	if tc.OutputHash == "" {
+		return io.NopCloser(strings.NewReader(tc.ExpectedOutput)), nil
+	}
+	return storage.Open(tc.OutputHash)
+}
+
+// fillTestcaseData loads the input and expected output of a testcase into
+// the struct; meant for small testcases such as samples
+func fillTestcaseData(tc *models.Testcase) error {
+	var err error
+	if tc.InputHash != "" {
+		if tc.Input, err = storage.ReadString(tc.InputHash); err != nil {
+			return err
+		}
+	}
+	if tc.OutputHash != "" {
+		if tc.ExpectedOutput, err = storage.ReadString(tc.OutputHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
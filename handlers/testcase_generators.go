@@ -0,0 +1,612 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/judge"
+	"codesprint/models"
+	"codesprint/storage"
+	"codesprint/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxGeneratedTests caps the invocations of a generation script
+	maxGeneratedTests = 500
+	// maxGeneratedInputKB caps a generated input; Judge0 refuses larger
+	// max_file_size values unless its MAX_MAX_FILE_SIZE is raised
+	maxGeneratedInputKB = 4096
+	// scriptProgramName is the name the generation script is stored under
+	scriptProgramName = "script.json"
+)
+
+// GetGenerationScript returns the generation script of a problem's current
+// version (author or admin only)
+func GetGenerationScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the generation script of") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to fetch generation script", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("SELECT version FROM problems WHERE id = $1", problemID).Scan(&version); err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch generation script", http.StatusInternalServerError)
+		return
+	}
+	script, err := loadGenerationScript(programs)
+	if err != nil {
+		http.Error(w, "Failed to load generation script", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(script)
+}
+
+// SetGenerationScript replaces the generation script of a problem's current
+// version (author or admin only). Every invocation must name a generator of
+// that version.
+func SetGenerationScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	var script models.GenerationScript
+	if err := json.NewDecoder(r.Body).Decode(&script); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(script.Tests) == 0 {
+		http.Error(w, "A generation script needs at least one test", http.StatusBadRequest)
+		return
+	}
+	if len(script.Tests) > maxGeneratedTests {
+		http.Error(w, fmt.Sprintf("A generation script can have at most %d tests", maxGeneratedTests), http.StatusBadRequest)
+		return
+	}
+	for i := range script.Tests {
+		if script.Tests[i].Args == nil {
+			script.Tests[i].Args = []string{}
+		}
+		if script.Tests[i].Seed == 0 {
+			script.Tests[i].Seed = int64(i + 1)
+		}
+	}
+
+	if !authorizeProblem(w, userID, problemID, "change the generation script of") {
+		return
+	}
+
+	data, err := json.MarshalIndent(script, "", "  ")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	blob, err := storage.PutString(string(data))
+	if err != nil {
+		http.Error(w, "Failed to store generation script", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to save generation script", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := editableVersion(tx, problemID)
+	if err != nil {
+		http.Error(w, "Failed to save generation script", http.StatusInternalServerError)
+		return
+	}
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to save generation script", http.StatusInternalServerError)
+		return
+	}
+	for i, inv := range script.Tests {
+		if findGenerator(programs, inv.Generator) == nil {
+			http.Error(w, fmt.Sprintf("Test %d: no generator named %q", i+1, inv.Generator), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, p := range programs {
+		if p.Role == programScript {
+			if err := removeProgram(tx, p.ID, version); err != nil {
+				http.Error(w, "Failed to save generation script", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	_, err = insertProgram(tx, models.ProblemProgram{
+		ProblemID:      problemID,
+		Role:           programScript,
+		Name:           scriptProgramName,
+		SourceHash:     blob.Hash,
+		SourceSize:     blob.Size,
+		AddedInVersion: version,
+	})
+	if err != nil {
+		http.Error(w, "Failed to save generation script", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to save generation script", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(script)
+}
+
+// GenerateTestcases starts running a problem's generation script (author or
+// admin only): each generator invocation produces an input, the validator
+// checks it and a reference solution produces the expected output. The
+// testcases are added to the problem only when every test was generated.
+func GenerateTestcases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.GenerateTestcasesRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !authorizeProblem(w, userID, problemID, "generate testcases for") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start generation", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var version, timeLimit int
+	err = tx.QueryRow("SELECT version, time_limit FROM problems WHERE id = $1", problemID).Scan(&version, &timeLimit)
+	if err != nil {
+		http.Error(w, "Problem not found", http.StatusNotFound)
+		return
+	}
+	programs, err := loadVersionPrograms(tx, problemID, version)
+	if err != nil {
+		http.Error(w, "Failed to fetch programs", http.StatusInternalServerError)
+		return
+	}
+	script, err := loadGenerationScript(programs)
+	if err != nil {
+		http.Error(w, "Failed to load generation script", http.StatusInternalServerError)
+		return
+	}
+	if len(script.Tests) == 0 {
+		http.Error(w, "The problem has no generation script", http.StatusBadRequest)
+		return
+	}
+	judging, err := judgingFromPrograms(programs)
+	if err != nil {
+		http.Error(w, "Failed to load programs", http.StatusInternalServerError)
+		return
+	}
+	if judging.Interactor != nil {
+		http.Error(w, "Interactive problems have no solution output to use as answers", http.StatusBadRequest)
+		return
+	}
+
+	generators := map[string]*runnableProgram{}
+	for _, inv := range script.Tests {
+		if _, ok := generators[inv.Generator]; ok {
+			continue
+		}
+		p := findGenerator(programs, inv.Generator)
+		if p == nil {
+			http.Error(w, fmt.Sprintf("No generator named %q", inv.Generator), http.StatusBadRequest)
+			return
+		}
+		if generators[inv.Generator], err = loadProgram(programs, *p); err != nil {
+			http.Error(w, "Failed to load generator", http.StatusInternalServerError)
+			return
+		}
+	}
+	validator, err := loadRunnable(programs, programValidator)
+	if err != nil {
+		http.Error(w, "Failed to load validator", http.StatusInternalServerError)
+		return
+	}
+
+	var solution *referenceSolution
+	for _, p := range programs {
+		if p.Role != programSolution {
+			continue
+		}
+		if req.Solution == p.Name || (req.Solution == "" && p.ExpectedVerdict == "accepted") {
+			code, err := storage.ReadString(p.SourceHash)
+			if err != nil {
+				http.Error(w, "Failed to load solution source", http.StatusInternalServerError)
+				return
+			}
+			solution = &referenceSolution{ProblemProgram: p, Code: code}
+			break
+		}
+	}
+	if solution == nil {
+		http.Error(w, "Add an accepted reference solution to produce the expected outputs", http.StatusBadRequest)
+		return
+	}
+
+	generation := models.ProblemGeneration{ProblemID: problemID, Status: "running", CreatedBy: &userID}
+	err = tx.QueryRow(
+		"INSERT INTO problem_generations (problem_id, status, created_by) VALUES ($1, 'running', $2) RETURNING id, created_at",
+		problemID, userID,
+	).Scan(&generation.ID, &generation.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to start generation", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to start generation", http.StatusInternalServerError)
+		return
+	}
+
+	go runGeneration(generation.ID, problemID, script, generators, validator, *solution, judging.Graders, timeLimit, req.Replace)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(generation)
+}
+
+// GetProblemGenerations lists the runs of a problem's generation script,
+// newest first (author or admin only)
+func GetProblemGenerations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the generations of") {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, problem_id, status, COALESCE(message, ''), problem_version, added, removed, created_by, created_at, finished_at
+		FROM problem_generations
+		WHERE problem_id = $1
+		ORDER BY id DESC
+	`, problemID)
+	if err != nil {
+		http.Error(w, "Failed to fetch generations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	generations := []models.ProblemGeneration{}
+	for rows.Next() {
+		g, err := scanGeneration(rows)
+		if err != nil {
+			http.Error(w, "Failed to fetch generations", http.StatusInternalServerError)
+			return
+		}
+		generations = append(generations, g)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(generations)
+}
+
+// GetProblemGeneration returns one run of a problem's generation script (author or admin only)
+func GetProblemGeneration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	problemID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid problem ID", http.StatusBadRequest)
+		return
+	}
+	generationID, err := strconv.Atoi(vars["generation_id"])
+	if err != nil {
+		http.Error(w, "Invalid generation ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "view the generations of") {
+		return
+	}
+
+	row := database.DB.QueryRow(`
+		SELECT id, problem_id, status, COALESCE(message, ''), problem_version, added, removed, created_by, created_at, finished_at
+		FROM problem_generations
+		WHERE id = $1 AND problem_id = $2
+	`, generationID, problemID)
+	g, err := scanGeneration(row)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Generation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch generation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g)
+}
+
+// scanGeneration scans a problem_generations row
+func scanGeneration(row interface{ Scan(...interface{}) error }) (models.ProblemGeneration, error) {
+	var g models.ProblemGeneration
+	err := row.Scan(&g.ID, &g.ProblemID, &g.Status, &g.Message, &g.ProblemVersion, &g.Added, &g.Removed, &g.CreatedBy, &g.CreatedAt, &g.FinishedAt)
+	return g, err
+}
+
+// loadGenerationScript decodes the generation script among a version's
+// programs; a version without one has an empty script
+func loadGenerationScript(programs []models.ProblemProgram) (models.GenerationScript, error) {
+	script := models.GenerationScript{Tests: []models.GeneratorInvocation{}}
+	for _, p := range programs {
+		if p.Role != programScript {
+			continue
+		}
+		data, err := storage.ReadString(p.SourceHash)
+		if err != nil {
+			return script, err
+		}
+		err = json.Unmarshal([]byte(data), &script)
+		return script, err
+	}
+	return script, nil
+}
+
+// findGenerator finds a generator by name, with or without its extension
+func findGenerator(programs []models.ProblemProgram, name string) *models.ProblemProgram {
+	for i, p := range programs {
+		if p.Role == programGenerator && (p.Name == name || strings.TrimSuffix(p.Name, path.Ext(p.Name)) == name) {
+			return &programs[i]
+		}
+	}
+	return nil
+}
+
+// generatedTest is a testcase produced by a generation run
+type generatedTest struct {
+	Input, Output storage.Blob
+	Sample        bool
+	Invocation    string
+}
+
+// runGeneration runs a generation script and adds the resulting testcases to
+// the problem's current version, recording the outcome on the generation
+func runGeneration(generationID, problemID int, script models.GenerationScript, generators map[string]*runnableProgram, validator *runnableProgram, solution referenceSolution, graders map[string]*runnableProgram, timeLimit int, replace bool) {
+	tests := make([]generatedTest, 0, len(script.Tests))
+	for i, inv := range script.Tests {
+		test, err := generateTest(inv, generators[inv.Generator], validator, solution, graders, timeLimit)
+		if err != nil {
+			finishGeneration(generationID, "failed", fmt.Sprintf("test %d (%s): %v", i+1, test.Invocation, err), nil, 0, 0)
+			return
+		}
+		tests = append(tests, test)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		finishGeneration(generationID, "failed", "failed to save testcases", nil, 0, 0)
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := editableVersion(tx, problemID)
+	if err != nil {
+		finishGeneration(generationID, "failed", "failed to save testcases", nil, 0, 0)
+		return
+	}
+	removed := 0
+	if replace {
+		if removed, err = removeVersionTestcases(tx, problemID, version, true); err != nil {
+			finishGeneration(generationID, "failed", "failed to replace generated testcases", nil, 0, 0)
+			return
+		}
+	}
+	for _, test := range tests {
+		if _, err := insertGeneratedTestcase(tx, problemID, version, test.Input, test.Output, test.Sample, test.Invocation); err != nil {
+			finishGeneration(generationID, "failed", "failed to save testcases", nil, 0, 0)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		finishGeneration(generationID, "failed", "failed to save testcases", nil, 0, 0)
+		return
+	}
+	finishGeneration(generationID, "done", "", &version, len(tests), removed)
+}
+
+// generateTest runs one generator invocation, validates the input and runs
+// the reference solution on it, with its grader for function-style problems,
+// to get the expected output
+func generateTest(inv models.GeneratorInvocation, generator, validator *runnableProgram, solution referenceSolution, graders map[string]*runnableProgram, timeLimit int) (generatedTest, error) {
+	test := generatedTest{
+		Sample:     inv.Sample,
+		Invocation: fmt.Sprintf("%s (seed %d)", strings.Join(append([]string{inv.Generator}, inv.Args...), " "), inv.Seed),
+	}
+	toolchain, ok := judge.ToolchainFor(generator.Language)
+	if !ok {
+		return test, fmt.Errorf("unsupported generator language %q", generator.Language)
+	}
+
+	quoted := make([]string, len(inv.Args))
+	for i, arg := range inv.Args {
+		quoted[i] = shellQuote(arg)
+	}
+	run := fmt.Sprintf("export SEED=%d\n%s %s", inv.Seed, toolchain.Run, strings.Join(quoted, " "))
+	result, err := judge.Default.RunMultiFile(context.Background(), judge.MultiFileRun{
+		Files:   generator.Files,
+		Compile: toolchain.Compile,
+		Run:     run,
+		Limits:  judge.Limits{CPUTime: checkerCPULimit, MaxFileSize: maxGeneratedInputKB},
+	})
+	if err != nil {
+		return test, err
+	}
+	if result.Status == nil || result.Status.ID != 3 {
+		return test, fmt.Errorf("generator failed: %s", runFailure(result))
+	}
+	input := result.Stdout
+	if input == "" {
+		return test, fmt.Errorf("generator produced no input")
+	}
+
+	if validator != nil {
+		valid, message, err := runValidator(validator, models.Testcase{Input: input})
+		if err != nil {
+			return test, err
+		}
+		if !valid {
+			return test, fmt.Errorf("invalid input: %s", message)
+		}
+	}
+
+	lang, ok := judge.LookupLanguage(solution.Language)
+	if !ok {
+		return test, fmt.Errorf("unknown language %q", solution.Language)
+	}
+	var answer *judge.Judge0Response
+	if graders != nil {
+		answer, err = runWithGrader(context.Background(), solution.Code, solution.Language, graders, input, lang.TimeLimit(timeLimit), 0)
+	} else {
+		answer, err = judge.Default.Run(lang, solution.Code, strings.NewReader(input), judge.Limits{CPUTime: float64(lang.TimeLimit(timeLimit)) / 1000})
+	}
+	if err != nil {
+		return test, err
+	}
+	if answer.Status == nil || answer.Status.ID != 3 {
+		return test, fmt.Errorf("reference solution %s failed: %s", solution.Name, runFailure(answer))
+	}
+
+	if test.Input, err = storage.PutString(input); err != nil {
+		return test, err
+	}
+	if test.Output, err = storage.PutString(answer.Stdout); err != nil {
+		return test, err
+	}
+	return test, nil
+}
+
+// finishGeneration records the outcome of a generation run
+func finishGeneration(generationID int, status, message string, version *int, added, removed int) {
+	_, err := database.DB.Exec(`
+		UPDATE problem_generations SET status = $1, message = NULLIF($2, ''), problem_version = $3, added = $4, removed = $5,
+			finished_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+	`, status, message, version, added, removed, generationID)
+	if err != nil {
+		fmt.Printf("Failed to update generation %d: %v\n", generationID, err)
+	}
+}
+
+// runFailure describes why a Judge0 run did not succeed
+func runFailure(result *judge.Judge0Response) string {
+	if result.Status == nil {
+		return "no status"
+	}
+	detail := strings.TrimSpace(result.CompileOutput + "\n" + result.Stderr)
+	if len(detail) > maxValidatorMessage {
+		detail = detail[:maxValidatorMessage]
+	}
+	if detail == "" {
+		return result.Status.Description
+	}
+	return result.Status.Description + ": " + detail
+}
+
+// shellQuote quotes an argument for the run script
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -3,13 +3,16 @@ package handlers
 import (
 	"codesprint/database"
 	"codesprint/models"
+	"codesprint/storage"
 	"codesprint/utils"
 	"encoding/json"
 	"net/http"
 	"strconv"
+
+	"github.com/gorilla/mux"
 )
 
-// CreateTestcase handles testcase creation (admin only)
+// CreateTestcase adds a testcase to the current version of a problem (author or admin only)
 func CreateTestcase(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -39,26 +42,134 @@ func CreateTestcase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorizeProblem(w, userID, req.ProblemID, "add testcases to") {
+		return
+	}
+
+	input, err := storage.PutString(req.Input)
+	if err != nil {
+		http.Error(w, "Failed to store testcase", http.StatusInternalServerError)
+		return
+	}
+	output, err := storage.PutString(req.ExpectedOutput)
+	if err != nil {
+		http.Error(w, "Failed to store testcase", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create testcase", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := editableVersion(tx, req.ProblemID)
+	if err != nil {
+		http.Error(w, "Failed to create testcase", http.StatusInternalServerError)
+		return
+	}
+
 	// Create testcase
-	var testcaseID int
-	err := database.DB.QueryRow(
-		"INSERT INTO testcases (problem_id, input, expected_output, is_sample) VALUES ($1, $2, $3, $4) RETURNING id",
-		req.ProblemID, req.Input, req.ExpectedOutput, req.IsSample,
-	).Scan(&testcaseID)
+	testcaseID, err := insertTestcase(tx, req.ProblemID, version, input, output, req.IsSample)
 	if err != nil {
 		http.Error(w, "Failed to create testcase", http.StatusInternalServerError)
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to create testcase", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":             testcaseID,
-		"problem_id":     req.ProblemID,
-		"is_sample":      req.IsSample,
+		"id":              testcaseID,
+		"problem_id":      req.ProblemID,
+		"is_sample":       req.IsSample,
+		"problem_version": version,
 	})
 }
 
-// GetTestcases returns testcases for a problem (only sample ones for users)
+// DeleteTestcase removes a testcase from the current version of its problem
+// (author or admin only). Earlier versions keep it.
+func DeleteTestcase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	testcaseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid testcase ID", http.StatusBadRequest)
+		return
+	}
+
+	var problemID int
+	err = database.DB.QueryRow(
+		"SELECT problem_id FROM testcases WHERE id = $1 AND removed_in_version IS NULL",
+		testcaseID,
+	).Scan(&problemID)
+	if err != nil {
+		http.Error(w, "Testcase not found", http.StatusNotFound)
+		return
+	}
+	if !authorizeProblem(w, userID, problemID, "remove testcases from") {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete testcase", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	version, err := editableVersion(tx, problemID)
+	if err != nil {
+		http.Error(w, "Failed to delete testcase", http.StatusInternalServerError)
+		return
+	}
+
+	// A testcase that only ever belonged to the unjudged current version can go for good
+	res, err := tx.Exec(
+		"DELETE FROM testcases WHERE id = $1 AND added_in_version = $2",
+		testcaseID, version,
+	)
+	if err != nil {
+		http.Error(w, "Failed to delete testcase", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_, err = tx.Exec(
+			"UPDATE testcases SET removed_in_version = $1 WHERE id = $2 AND removed_in_version IS NULL",
+			version, testcaseID,
+		)
+		if err != nil {
+			http.Error(w, "Failed to delete testcase", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete testcase", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":              testcaseID,
+		"deleted":         true,
+		"problem_version": version,
+	})
+}
+
+// GetTestcases returns the testcases of a problem's current version (only sample ones for users)
 func GetTestcases(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -74,7 +185,13 @@ func GetTestcases(w http.ResponseWriter, r *http.Request) {
 
 	// For MVP, only return sample testcases
 	rows, err := database.DB.Query(
-		"SELECT id, problem_id, input, expected_output, is_sample FROM testcases WHERE problem_id = $1 AND is_sample = true ORDER BY id",
+		`SELECT t.id, t.problem_id, COALESCE(t.input, ''), COALESCE(t.expected_output, ''),
+			COALESCE(t.input_hash, ''), COALESCE(t.output_hash, ''), t.is_sample
+		FROM testcases t
+		JOIN problems p ON p.id = t.problem_id
+		WHERE t.problem_id = $1 AND t.is_sample = true
+			AND t.added_in_version <= p.version AND (t.removed_in_version IS NULL OR t.removed_in_version > p.version)
+		ORDER BY t.id`,
 		problemID,
 	)
 	if err != nil {
@@ -86,14 +203,17 @@ func GetTestcases(w http.ResponseWriter, r *http.Request) {
 	var testcases []models.Testcase
 	for rows.Next() {
 		var tc models.Testcase
-		err := rows.Scan(&tc.ID, &tc.ProblemID, &tc.Input, &tc.ExpectedOutput, &tc.IsSample)
+		err := rows.Scan(&tc.ID, &tc.ProblemID, &tc.Input, &tc.ExpectedOutput, &tc.InputHash, &tc.OutputHash, &tc.IsSample)
 		if err != nil {
 			continue
 		}
+		if err := fillTestcaseData(&tc); err != nil {
+			http.Error(w, "Failed to load testcase data", http.StatusInternalServerError)
+			return
+		}
 		testcases = append(testcases, tc)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(testcases)
 }
-
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetUpsolve returns which problems of a contest a user solved during the
+// contest, which in a virtual participation and which later in practice. Defaults to the caller;
+// pass user_id to view someone else's.
+func GetUpsolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		userID, err = strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var exists bool
+	err = database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM contests WHERE id = $1)", contestID).Scan(&exists)
+	if err != nil || !exists {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT p.id, cp.label, p.title,
+			COALESCE(BOOL_OR(s.status = 'accepted' AND NOT s.is_practice AND s.virtual_participation_id IS NULL), FALSE),
+			COALESCE(BOOL_OR(s.status = 'accepted' AND s.virtual_participation_id IS NOT NULL), FALSE),
+			COUNT(s.id) FILTER (WHERE s.is_practice),
+			MIN(s.created_at) FILTER (WHERE s.is_practice AND s.status = 'accepted')
+		FROM contest_problems cp
+		JOIN problems p ON p.id = cp.problem_id
+		LEFT JOIN submissions s ON s.problem_id = p.id AND s.contest_id = $1 AND s.user_id = $2
+		WHERE cp.contest_id = $1
+		GROUP BY p.id, cp.label, p.title, cp.position
+		ORDER BY cp.position, cp.label
+	`, contestID, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch upsolve progress", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	view := models.UpsolveView{ContestID: contestID, UserID: userID}
+	for rows.Next() {
+		var problem models.UpsolveProblem
+		var upsolvedAt sql.NullTime
+		if err := rows.Scan(&problem.ProblemID, &problem.Label, &problem.Title, &problem.SolvedInContest, &problem.SolvedVirtually, &problem.Attempts, &upsolvedAt); err != nil {
+			http.Error(w, "Failed to fetch upsolve progress", http.StatusInternalServerError)
+			return
+		}
+		if problem.SolvedInContest {
+			view.SolvedCount++
+			view.Problems = append(view.Problems, problem)
+			continue
+		}
+		if problem.SolvedVirtually {
+			view.VirtualSolvedCount++
+		}
+		if upsolvedAt.Valid {
+			at := upsolvedAt.Time
+			problem.Upsolved = true
+			problem.UpsolvedAt = &at
+			view.UpsolvedCount++
+		}
+		view.Problems = append(view.Problems, problem)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
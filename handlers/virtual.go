@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/standings"
+	"codesprint/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// StartVirtualParticipation starts the caller's personal timer for an ended contest
+func StartVirtualParticipation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start virtual participation", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the contest, as submissions do, so the checks below and the new
+	// participation are seen together
+	var ended bool
+	err = tx.QueryRow(
+		"SELECT end_time < CURRENT_TIMESTAMP FROM contests WHERE id = $1 FOR SHARE",
+		contestID,
+	).Scan(&ended)
+	if err != nil {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+	if !ended {
+		http.Error(w, "Virtual participation is only available after the contest has ended", http.StatusConflict)
+		return
+	}
+
+	// Someone who took part live already knows the problems
+	var participated bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM submissions WHERE contest_id = $1 AND user_id = $2 AND virtual_participation_id IS NULL)",
+		contestID, userID,
+	).Scan(&participated)
+	if err != nil {
+		http.Error(w, "Failed to start virtual participation", http.StatusInternalServerError)
+		return
+	}
+	if participated {
+		http.Error(w, "You already have submissions in this contest", http.StatusConflict)
+		return
+	}
+
+	// A concurrent start waits here on the unique (contest_id, user_id) row
+	// and then inserts nothing
+	res, err := tx.Exec(
+		"INSERT INTO virtual_participations (contest_id, user_id) VALUES ($1, $2) ON CONFLICT (contest_id, user_id) DO NOTHING",
+		contestID, userID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to start virtual participation", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Virtual participation already started", http.StatusConflict)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to start virtual participation", http.StatusInternalServerError)
+		return
+	}
+
+	participation, err := loadVirtualParticipation(userID, contestID)
+	if err != nil {
+		http.Error(w, "Failed to start virtual participation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(participation)
+}
+
+// GetVirtualParticipation returns the caller's virtual participation in a contest
+func GetVirtualParticipation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := utils.GetUserIDFromRequest(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	participation, err := loadVirtualParticipation(userID, contestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No virtual participation in this contest", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch virtual participation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(participation)
+}
+
+// GetVirtualLeaderboard returns a contest's standings with virtual participants
+// merged in, everyone shown as of the same elapsed time since their start.
+// elapsed is in minutes and defaults to the whole contest.
+func GetVirtualLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	contestID, err := strconv.Atoi(vars["contest_id"])
+	if err != nil {
+		http.Error(w, "Invalid contest ID", http.StatusBadRequest)
+		return
+	}
+
+	var startTime, endTime time.Time
+	err = database.DB.QueryRow(
+		"SELECT start_time, end_time FROM contests WHERE id = $1",
+		contestID,
+	).Scan(&startTime, &endTime)
+	if err != nil {
+		http.Error(w, "Contest not found", http.StatusNotFound)
+		return
+	}
+
+	elapsed := endTime.Sub(startTime)
+	if elapsedStr := r.URL.Query().Get("elapsed"); elapsedStr != "" {
+		minutes, err := strconv.Atoi(elapsedStr)
+		if err != nil || minutes < 0 {
+			http.Error(w, "Invalid elapsed time", http.StatusBadRequest)
+			return
+		}
+		if e := time.Duration(minutes) * time.Minute; e < elapsed {
+			elapsed = e
+		}
+	}
+
+	leaderboard, err := standings.ComputeVirtual(contestID, elapsed)
+	if err != nil {
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
+// loadVirtualParticipation returns a user's virtual participation in a
+// contest, or sql.ErrNoRows if they never started one
+func loadVirtualParticipation(userID, contestID int) (*models.VirtualParticipation, error) {
+	var vp models.VirtualParticipation
+	err := database.DB.QueryRow(`
+		SELECT vp.id, vp.contest_id, vp.user_id, vp.started_at,
+			vp.started_at + (c.end_time - c.start_time),
+			CURRENT_TIMESTAMP < vp.started_at + (c.end_time - c.start_time)
+		FROM virtual_participations vp
+		JOIN contests c ON c.id = vp.contest_id
+		WHERE vp.contest_id = $1 AND vp.user_id = $2
+	`, contestID, userID).Scan(&vp.ID, &vp.ContestID, &vp.UserID, &vp.StartedAt, &vp.EndsAt, &vp.Active)
+	if err != nil {
+		return nil, err
+	}
+	return &vp, nil
+}
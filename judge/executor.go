@@ -0,0 +1,208 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrUnsupported is returned for runs an executor cannot perform
+var ErrUnsupported = errors.New("not supported by this executor")
+
+// Program is a program to build and run: its source under the toolchain's
+// source name, plus any support files it is built with
+type Program struct {
+	Language string
+	Files    []File
+}
+
+// Input opens one stdin of a batch run. Inputs are opened only when their
+// run starts, so a large batch does not hold every file open.
+type Input func() (io.ReadCloser, error)
+
+// Limits are the resource limits of a run; zero values keep the executor's
+// defaults
+type Limits struct {
+	CPUTime     float64 // seconds
+	Memory      int     // KB
+	MaxFileSize int     // KB, caps stdout and files written
+}
+
+// Batch is a submission run on several inputs. Inputs start in order, at
+// most Parallelism at a time.
+type Batch struct {
+	Inputs      []Input
+	Limits      Limits
+	Parallelism int // zero for the configured parallelism
+	// Skip, when set, is asked before an input starts; skipped inputs get
+	// no result
+	Skip func(i int) bool
+	// Done receives each result as its run finishes, one call at a time
+	Done func(i int, result *Judge0Response)
+}
+
+func (b Batch) parallelism() int {
+	if b.Parallelism > 0 {
+		return b.Parallelism
+	}
+	return Parallelism
+}
+
+func (b Batch) skip(i int) bool {
+	return b.Skip != nil && b.Skip(i)
+}
+
+// Parallelism is how many runs of a batch are in progress at once, from
+// JUDGE_PARALLELISM
+var Parallelism = getParallelism()
+
+func getParallelism() int {
+	if n, err := strconv.Atoi(os.Getenv("JUDGE_PARALLELISM")); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// InteractiveRun describes one testcase of an interactive problem. The
+// solution's stdout is piped to the interactor's stdin and the interactor's
+// stdout to the solution's stdin; the interactor reads the test data from its
+// files and decides the verdict by its exit code.
+type InteractiveRun struct {
+	Solution            Program
+	Interactor          Program
+	InteractorArgs      []string
+	TimeLimit           float64 // solution CPU time, seconds
+	MemoryLimit         int     // solution memory, KB; zero for none
+	InteractorTimeLimit float64 // interactor wall time, seconds
+}
+
+// InteractiveResult is the outcome of an interactive run
+type InteractiveResult struct {
+	CompileOutput    string // set when the solution failed to build; nothing ran then
+	SolutionExit     int    // -1 when the solution was killed
+	TimedOut         bool   // the solution ran out of time
+	Runtime          int    // solution CPU time, milliseconds
+	Memory           int    // solution peak memory, kilobytes; 0 when not measured
+	InteractorExit   int    // -1 when the interactor was killed
+	InteractorStderr string
+}
+
+// Executor runs the programs of a judging run
+type Executor interface {
+	// CanRun reports whether the executor can run submissions in a language
+	CanRun(l Language) bool
+	// Run runs a submission on one input within limits. Results carry
+	// Judge0 status IDs whichever executor produced them.
+	Run(l Language, code string, stdin io.Reader, limits Limits) (*Judge0Response, error)
+	// RunBatch runs a submission on the inputs of a batch. Cancelling ctx
+	// starts no more runs, abandons those in progress and returns ctx.Err().
+	RunBatch(ctx context.Context, l Language, code string, batch Batch) error
+	// Interactive reports whether the executor can run interactive problems
+	Interactive() bool
+	// RunInteractive runs a solution against an interactor. Build failures
+	// of the interactor and failures of the executor itself are errors.
+	// Cancelling ctx kills both programs and returns ctx.Err().
+	RunInteractive(ctx context.Context, run InteractiveRun) (*InteractiveResult, error)
+	// Toolchain returns how the executor builds and starts problem programs,
+	// such as checkers and generators, written in a language
+	Toolchain(language string) (Toolchain, bool)
+	// GraderToolchain returns how the executor builds a solution in a
+	// language together with a grader
+	GraderToolchain(language string) (Toolchain, bool)
+	// RunMultiFile builds a program from a set of files and runs its script
+	// on one input; one that fails to build gets a Compilation Error result.
+	// Cancelling ctx abandons the run and returns ctx.Err().
+	RunMultiFile(ctx context.Context, run MultiFileRun) (*Judge0Response, error)
+	// Judge0For returns the Judge0 server submissions in a language are run
+	// on, or nil when the executor runs them itself
+	Judge0For(l Language) *Judge0Client
+}
+
+// Default is the executor selected by JUDGE_EXECUTOR: "local" runs programs
+// in languages with local commands as processes on this host, anything else
+// leaves everything to Judge0
+var Default = getExecutor()
+
+func getExecutor() Executor {
+	if os.Getenv("JUDGE_EXECUTOR") == "local" {
+		return &LocalExecutor{WorkDir: os.Getenv("JUDGE_WORK_DIR")}
+	}
+	return Judge0Executor{}
+}
+
+// Judge0Executor runs programs in Judge0. Judge0 runs a single process per
+// submission, so it cannot connect a solution to an interactor.
+type Judge0Executor struct {
+	Client *Judge0Client // nil for the default server
+}
+
+func (e Judge0Executor) client() *Judge0Client {
+	if e.Client == nil {
+		return Judge0
+	}
+	return e.Client
+}
+
+// CanRun reports whether Judge0 has the language
+func (Judge0Executor) CanRun(l Language) bool { return l.Judge0ID != 0 }
+
+// Run submits the program to Judge0 and polls for its result
+func (e Judge0Executor) Run(l Language, code string, stdin io.Reader, limits Limits) (*Judge0Response, error) {
+	if l.Judge0ID == 0 {
+		return nil, ErrUnsupported
+	}
+	submitted, err := e.client().SubmitCodeStream(l.PrepareSource(code), l.Judge0ID, stdin, limits)
+	if err != nil {
+		return nil, err
+	}
+	return e.client().PollSubmissionResult(submitted.Token, 30, 2*time.Second)
+}
+
+// RunBatch submits the program once per input in Judge0 batch requests
+func (e Judge0Executor) RunBatch(ctx context.Context, l Language, code string, batch Batch) error {
+	if l.Judge0ID == 0 {
+		return ErrUnsupported
+	}
+	return e.client().RunBatch(ctx, l.Judge0ID, l.PrepareSource(code), batch)
+}
+
+// Interactive reports that Judge0 cannot run interactive problems
+func (Judge0Executor) Interactive() bool { return false }
+
+// RunInteractive always fails with ErrUnsupported
+func (Judge0Executor) RunInteractive(ctx context.Context, run InteractiveRun) (*InteractiveResult, error) {
+	return nil, ErrUnsupported
+}
+
+// Toolchain returns the Judge0 image toolchain for a language: Judge0 builds
+// problem programs in c, cpp and python3 only
+func (Judge0Executor) Toolchain(language string) (Toolchain, bool) {
+	l, ok := LookupLanguage(language)
+	if !ok {
+		return Toolchain{}, false
+	}
+	t, ok := toolchains[l.Name]
+	return t, ok
+}
+
+// GraderToolchain returns the Judge0 image toolchain that builds a solution
+// together with a grader
+func (Judge0Executor) GraderToolchain(language string) (Toolchain, bool) {
+	l, ok := LookupLanguage(language)
+	if !ok {
+		return Toolchain{}, false
+	}
+	t, ok := graderToolchains[l.Name]
+	return t, ok
+}
+
+// RunMultiFile runs the program as a Judge0 multi-file program
+func (e Judge0Executor) RunMultiFile(ctx context.Context, run MultiFileRun) (*Judge0Response, error) {
+	return e.client().RunMultiFile(ctx, run)
+}
+
+// Judge0For returns the executor's Judge0 server
+func (e Judge0Executor) Judge0For(l Language) *Judge0Client { return e.client() }
@@ -0,0 +1,217 @@
+package judge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned for calls that could not reach Judge0 and, while
+// the circuit breaker is open, for calls that were not attempted
+var ErrUnavailable = errors.New("judge unavailable")
+
+const (
+	// breakerThreshold is how many calls in a row must fail to open the breaker
+	breakerThreshold = 5
+	// breakerCooldown is how long the breaker stays open before a trial call
+	breakerCooldown = 30 * time.Second
+	// probeTimeout bounds one health probe
+	probeTimeout = 10 * time.Second
+)
+
+// Health is the state of a Judge0 server as seen by its client's circuit
+// breaker and health probe
+type Health struct {
+	URL                 string     `json:"url"`
+	State               string     `json:"state"` // closed, open or half_open
+	Available           bool       `json:"available"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastProbeAt         *time.Time `json:"last_probe_at,omitempty"`
+	LastProbeLatency    int        `json:"last_probe_latency_ms"`
+	Version             string     `json:"version,omitempty"` // as Judge0 reports it
+}
+
+// breaker is a circuit breaker: after breakerThreshold failed calls in a row
+// it opens and fails calls fast for breakerCooldown, then lets a single
+// trial call through, which closes it again on success
+type breaker struct {
+	mu          sync.Mutex
+	failures    int
+	openUntil   time.Time
+	trial       bool // the half-open trial call is in progress
+	lastError   string
+	lastFailure time.Time
+	lastProbe   time.Time
+	latency     time.Duration
+	version     string
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerThreshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failed(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	b.lastError = err.Error()
+	b.lastFailure = time.Now()
+	if b.failures >= breakerThreshold {
+		b.openUntil = b.lastFailure.Add(breakerCooldown)
+	}
+}
+
+// send performs a request through the circuit breaker. Requests that fail
+// to reach Judge0 or meet a server error count as failures and come back
+// wrapping ErrUnavailable.
+func (c *Judge0Client) send(req *http.Request) (*http.Response, error) {
+	if !c.breaker.allow(time.Now()) {
+		return nil, ErrUnavailable
+	}
+	resp, err := c.HTTP.Do(req)
+	if err == nil && resp.StatusCode >= 500 {
+		resp.Body.Close()
+		err = fmt.Errorf("Judge0 returned status %d", resp.StatusCode)
+	}
+	if err != nil {
+		c.breaker.failed(err)
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	c.breaker.succeeded()
+	return resp, nil
+}
+
+func (c *Judge0Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req)
+}
+
+func (c *Judge0Client) post(url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.send(req)
+}
+
+// Probe checks that Judge0 answers, whatever the state of the breaker, and
+// closes the breaker when it does
+func (c *Judge0Client) Probe() error {
+	client := *c.HTTP
+	client.Timeout = probeTimeout
+	start := time.Now()
+	resp, err := client.Get(c.URL + "/about")
+	latency := time.Since(start)
+	var about struct {
+		Version string `json:"version"`
+	}
+	if err == nil {
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("Judge0 returned status %d", resp.StatusCode)
+		} else {
+			json.NewDecoder(resp.Body).Decode(&about)
+		}
+		resp.Body.Close()
+	}
+
+	c.breaker.mu.Lock()
+	c.breaker.lastProbe = start
+	c.breaker.latency = latency
+	if err == nil {
+		c.breaker.version = about.Version
+	}
+	c.breaker.mu.Unlock()
+	if err != nil {
+		c.breaker.failed(err)
+		return err
+	}
+	c.breaker.succeeded()
+	return nil
+}
+
+// StartHealthChecks probes Judge0 every interval in the background
+func (c *Judge0Client) StartHealthChecks(interval time.Duration) {
+	go func() {
+		for {
+			c.Probe()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Available reports whether calls to Judge0 are attempted: the breaker is
+// closed, or due a trial call
+func (c *Judge0Client) Available() bool {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.failures < breakerThreshold || !time.Now().Before(c.breaker.openUntil)
+}
+
+// WaitAvailable sleeps for delay and then until calls to Judge0 are
+// attempted again
+func (c *Judge0Client) WaitAvailable(delay time.Duration) {
+	time.Sleep(delay)
+	for !c.Available() {
+		time.Sleep(time.Second)
+	}
+}
+
+// Health reports the state of the breaker and the last probe
+func (c *Judge0Client) Health() Health {
+	b := &c.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := Health{
+		URL:                 c.URL,
+		State:               "closed",
+		Available:           true,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+		LastProbeLatency:    int(b.latency.Milliseconds()),
+		Version:             b.version,
+	}
+	if b.failures >= breakerThreshold {
+		h.State = "half_open"
+		if time.Now().Before(b.openUntil) {
+			openUntil := b.openUntil
+			h.State, h.Available, h.OpenUntil = "open", false, &openUntil
+		}
+	}
+	if !b.lastFailure.IsZero() {
+		lastFailure := b.lastFailure
+		h.LastFailureAt = &lastFailure
+	}
+	if !b.lastProbe.IsZero() {
+		lastProbe := b.lastProbe
+		h.LastProbeAt = &lastProbe
+	}
+	return h
+}
@@ -1,22 +1,79 @@
 package judge
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
-var judge0URL = getJudge0URL()
+// Judge0Client talks to a Judge0 server
+type Judge0Client struct {
+	URL  string
+	HTTP *http.Client
 
-func getJudge0URL() string {
+	// CallbackURL, when set together with CallbackSecret, is where Judge0
+	// reports each finished batch submission. Batches are polled as well, in
+	// case a callback is lost or reaches another server.
+	CallbackURL    string
+	CallbackSecret string
+
+	BatchSize        int           // submissions per batch request; Judge0 accepts 20 by default
+	PollInterval     time.Duration // between polls of a batch without callbacks
+	CallbackInterval time.Duration // between polls of a batch with callbacks
+	StallTimeout     time.Duration // how long a batch run may go without a submission finishing
+	MaxCPUTimeLimit  float64       // seconds; Judge0's max_cpu_time_limit, which longer limits are lowered to
+	MaxMemoryLimit   int           // KB; Judge0's max_memory_limit, which larger limits are lowered to
+
+	mu      sync.Mutex
+	waiting map[string]chan *Judge0Response // by batch id, for callbacks
+	breaker breaker
+}
+
+// NewJudge0Client returns a client for the Judge0 server at url
+func NewJudge0Client(url string) *Judge0Client {
+	return &Judge0Client{
+		URL:              url,
+		HTTP:             &http.Client{Timeout: 2 * time.Minute},
+		BatchSize:        20,
+		PollInterval:     2 * time.Second,
+		CallbackInterval: 10 * time.Second,
+		StallTimeout:     2 * time.Minute,
+		MaxCPUTimeLimit:  15,
+		MaxMemoryLimit:   512000,
+	}
+}
+
+// Judge0 is the client for the server at JUDGE0_URL, with callbacks to
+// JUDGE0_CALLBACK_URL signed with JUDGE0_CALLBACK_SECRET and the server's
+// JUDGE0_MAX_CPU_TIME_LIMIT and JUDGE0_MAX_MEMORY_LIMIT
+var Judge0 = getJudge0Client()
+
+func getJudge0Client() *Judge0Client {
 	url := os.Getenv("JUDGE0_URL")
 	if url == "" {
-		return "http://localhost:2358"
+		url = "http://localhost:2358"
+	}
+	c := NewJudge0Client(url)
+	c.CallbackURL = os.Getenv("JUDGE0_CALLBACK_URL")
+	c.CallbackSecret = os.Getenv("JUDGE0_CALLBACK_SECRET")
+	if n, err := strconv.Atoi(os.Getenv("JUDGE0_BATCH_SIZE")); err == nil && n > 0 {
+		c.BatchSize = n
+	}
+	if s, err := strconv.ParseFloat(os.Getenv("JUDGE0_MAX_CPU_TIME_LIMIT"), 64); err == nil && s > 0 {
+		c.MaxCPUTimeLimit = s
 	}
-	return url
+	if n, err := strconv.Atoi(os.Getenv("JUDGE0_MAX_MEMORY_LIMIT")); err == nil && n > 0 {
+		c.MaxMemoryLimit = n
+	}
+	return c
 }
 
 // Language IDs for Judge0
@@ -24,13 +81,23 @@ const (
 	LanguageC      = 50 // C (GCC 9.2.0)
 	LanguageCPP    = 54 // C++ (GCC 9.2.0)
 	LanguagePython = 92 // Python (3.8.1)
+
+	LanguageJava       = 62 // Java (OpenJDK 13.0.1)
+	LanguageGo         = 60 // Go (1.13.5)
+	LanguageRust       = 73 // Rust (1.40.0)
+	LanguageJavaScript = 63 // JavaScript (Node.js 12.14.0)
+	LanguageKotlin     = 78 // Kotlin (1.3.70)
 )
 
 // Judge0Submission represents a submission to Judge0
 type Judge0Submission struct {
-	SourceCode string `json:"source_code"`
-	LanguageID int    `json:"language_id"`
-	Stdin      string `json:"stdin,omitempty"`
+	SourceCode      string  `json:"source_code,omitempty"`
+	LanguageID      int     `json:"language_id"`
+	Stdin           string  `json:"stdin,omitempty"`
+	AdditionalFiles string  `json:"additional_files,omitempty"` // base64 zip, for multi-file programs
+	CPUTimeLimit    float64 `json:"cpu_time_limit,omitempty"`   // seconds
+	MemoryLimit     int     `json:"memory_limit,omitempty"`     // KB
+	MaxFileSize     int     `json:"max_file_size,omitempty"`    // KB
 }
 
 // Judge0Response represents a response from Judge0
@@ -40,8 +107,11 @@ type Judge0Response struct {
 	Stdout        string        `json:"stdout,omitempty"`
 	Stderr        string        `json:"stderr,omitempty"`
 	Time          string        `json:"time,omitempty"`
-	Memory        int           `json:"memory,omitempty"`
+	Memory        int           `json:"memory,omitempty"` // peak, kilobytes
 	CompileOutput string        `json:"compile_output,omitempty"`
+	Message       string        `json:"message,omitempty"`     // Judge0's note on a failed run
+	ExitCode      *int          `json:"exit_code,omitempty"`   // of a program that exited
+	ExitSignal    *int          `json:"exit_signal,omitempty"` // of a program killed by a signal
 }
 
 // Judge0Status represents the status of a submission
@@ -52,22 +122,26 @@ type Judge0Status struct {
 
 // SubmitCode submits code to Judge0
 func SubmitCode(code string, languageID int, input string) (*Judge0Response, error) {
-	submission := Judge0Submission{
-		SourceCode: code,
-		LanguageID: languageID,
-		Stdin:      input,
-	}
+	return SubmitCodeStream(code, languageID, strings.NewReader(input), Limits{})
+}
 
-	jsonData, err := json.Marshal(submission)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal submission: %w", err)
-	}
+// SubmitCodeStream submits code to the default Judge0 server
+func SubmitCodeStream(code string, languageID int, stdin io.Reader, limits Limits) (*Judge0Response, error) {
+	return Judge0.SubmitCodeStream(code, languageID, stdin, limits)
+}
+
+// SubmitCodeStream submits code to Judge0, streaming stdin into the request
+// body so large inputs are never held in memory as a whole. Zero limits
+// keep Judge0's defaults.
+func (c *Judge0Client) SubmitCodeStream(code string, languageID int, stdin io.Reader, limits Limits) (*Judge0Response, error) {
+	limits = c.clamp(limits)
+	body, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeSubmission(pw, code, languageID, stdin, limits, ""))
+	}()
+	defer body.Close()
 
-	resp, err := http.Post(
-		fmt.Sprintf("%s/submissions?base64_encoded=false&wait=false", judge0URL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	resp, err := c.post(fmt.Sprintf("%s/submissions?base64_encoded=false&wait=false", c.URL), body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to submit to Judge0: %w", err)
 	}
@@ -85,9 +159,99 @@ func SubmitCode(code string, languageID int, input string) (*Judge0Response, err
 	return &result, nil
 }
 
-// GetSubmissionResult retrieves the result of a submission from Judge0
+// clamp lowers limits to the most Judge0 accepts, which would otherwise
+// reject the submission. A program over the problem's memory limit is still
+// caught by its peak memory; one given more time than Judge0 allows is cut
+// off at Judge0's limit.
+func (c *Judge0Client) clamp(limits Limits) Limits {
+	if c.MaxCPUTimeLimit > 0 && limits.CPUTime > c.MaxCPUTimeLimit {
+		limits.CPUTime = c.MaxCPUTimeLimit
+	}
+	if c.MaxMemoryLimit > 0 && limits.Memory > c.MaxMemoryLimit {
+		limits.Memory = c.MaxMemoryLimit
+	}
+	return limits
+}
+
+// writeSubmission writes a Judge0Submission as JSON, escaping stdin as it
+// is read. An empty callbackURL asks for no callback.
+func writeSubmission(w io.Writer, code string, languageID int, stdin io.Reader, limits Limits, callbackURL string) error {
+	bw := bufio.NewWriter(w)
+	source, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("failed to marshal submission: %w", err)
+	}
+	fmt.Fprintf(bw, `{"source_code":%s,"language_id":%d,`, source, languageID)
+	if limits.CPUTime > 0 {
+		fmt.Fprintf(bw, `"cpu_time_limit":%g,`, limits.CPUTime)
+	}
+	if limits.Memory > 0 {
+		fmt.Fprintf(bw, `"memory_limit":%d,`, limits.Memory)
+	}
+	if limits.MaxFileSize > 0 {
+		fmt.Fprintf(bw, `"max_file_size":%d,`, limits.MaxFileSize)
+	}
+	if callbackURL != "" {
+		callback, err := json.Marshal(callbackURL)
+		if err != nil {
+			return fmt.Errorf("failed to marshal submission: %w", err)
+		}
+		fmt.Fprintf(bw, `"callback_url":%s,`, callback)
+	}
+	bw.WriteString(`"stdin":"`)
+	if err := writeJSONStringBody(bw, bufio.NewReader(stdin)); err != nil {
+		return err
+	}
+	bw.WriteString(`"}`)
+	return bw.Flush()
+}
+
+// writeJSONStringBody writes the escaped contents of a JSON string, without
+// the quotes. Invalid UTF-8 becomes U+FFFD, as with encoding/json.
+func writeJSONStringBody(w *bufio.Writer, r *bufio.Reader) error {
+	const hexDigits = "0123456789abcdef"
+	for {
+		c, size, err := r.ReadRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '"' || c == '\\':
+			w.WriteByte('\\')
+			w.WriteRune(c)
+		case c == '\n':
+			w.WriteString(`\n`)
+		case c == '\r':
+			w.WriteString(`\r`)
+		case c == '\t':
+			w.WriteString(`\t`)
+		case c < 0x20:
+			w.WriteString(`\u00`)
+			w.WriteByte(hexDigits[c>>4])
+			w.WriteByte(hexDigits[c&0xF])
+		case c == utf8.RuneError && size == 1:
+			w.WriteString(`\ufffd`)
+		default:
+			w.WriteRune(c)
+		}
+	}
+}
+
+// resultFields are the submission fields fetched from Judge0
+const resultFields = "token,status,stdout,stderr,time,memory,compile_output,message,exit_code,exit_signal"
+
+// GetSubmissionResult retrieves the result of a submission from the default
+// Judge0 server
 func GetSubmissionResult(token string) (*Judge0Response, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/submissions/%s?base64_encoded=false", judge0URL, token))
+	return Judge0.GetSubmissionResult(token)
+}
+
+// GetSubmissionResult retrieves the result of a submission from Judge0
+func (c *Judge0Client) GetSubmissionResult(token string) (*Judge0Response, error) {
+	resp, err := c.get(fmt.Sprintf("%s/submissions/%s?base64_encoded=false&fields=%s", c.URL, token, resultFields))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get result from Judge0: %w", err)
 	}
@@ -105,16 +269,21 @@ func GetSubmissionResult(token string) (*Judge0Response, error) {
 	return &result, nil
 }
 
-// PollSubmissionResult polls Judge0 until the submission is complete
+// PollSubmissionResult polls the default Judge0 server until the submission
+// is complete
 func PollSubmissionResult(token string, maxAttempts int, delay time.Duration) (*Judge0Response, error) {
+	return Judge0.PollSubmissionResult(token, maxAttempts, delay)
+}
+
+// PollSubmissionResult polls Judge0 until the submission is complete
+func (c *Judge0Client) PollSubmissionResult(token string, maxAttempts int, delay time.Duration) (*Judge0Response, error) {
 	for i := 0; i < maxAttempts; i++ {
-		result, err := GetSubmissionResult(token)
+		result, err := c.GetSubmissionResult(token)
 		if err != nil {
 			return nil, err
 		}
 
-		// Status ID 1-2 means in queue or processing, 3 means completed
-		if result.Status != nil && result.Status.ID >= 3 {
+		if result.Finished() {
 			return result, nil
 		}
 
@@ -124,36 +293,8 @@ func PollSubmissionResult(token string, maxAttempts int, delay time.Duration) (*
 	return nil, fmt.Errorf("submission timed out after %d attempts", maxAttempts)
 }
 
-// MapJudge0StatusToInternal maps Judge0 status to internal status
-func MapJudge0StatusToInternal(judge0StatusID int) string {
-	switch judge0StatusID {
-	case 3: // Accepted
-		return "accepted"
-	case 4: // Wrong Answer
-		return "wrong_answer"
-	case 5: // Time Limit Exceeded
-		return "time_limit_exceeded"
-	case 6: // Compilation Error
-		return "compilation_error"
-	case 7: // Runtime Error
-		return "runtime_error"
-	case 8: // Memory Limit Exceeded
-		return "memory_limit_exceeded"
-	default:
-		return "pending"
-	}
-}
-
-// GetLanguageID maps language string to Judge0 language ID
-func GetLanguageID(language string) int {
-	switch language {
-	case "c":
-		return LanguageC
-	case "cpp", "c++":
-		return LanguageCPP
-	case "python", "python3":
-		return LanguagePython
-	default:
-		return LanguageC // default to C
-	}
+// Finished reports whether Judge0 is done with a submission: status 1 is
+// in queue, 2 processing, and everything from 3 on a final result
+func (r *Judge0Response) Finished() bool {
+	return r.Status != nil && r.Status.ID >= StatusAccepted
 }
@@ -0,0 +1,301 @@
+package judge
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCallback is returned for callbacks that are not signed for a
+// batch this client is waiting on
+var ErrInvalidCallback = errors.New("invalid Judge0 callback")
+
+// RunBatch runs a program on the inputs of a batch, sending them to Judge0
+// in batch requests while keeping at most the batch's parallelism in flight.
+// Results arrive by callback when callbacks are configured; unfinished
+// submissions are polled in batches either way. Judge0 cannot stop a
+// submission it has queued, so cancelling ctx only stops submitting and
+// waiting.
+func (c *Judge0Client) RunBatch(ctx context.Context, languageID int, code string, batch Batch) error {
+	var batchID string
+	var callbacks chan *Judge0Response
+	if c.CallbackURL != "" && c.CallbackSecret != "" {
+		var err error
+		if batchID, err = newBatchID(); err != nil {
+			return err
+		}
+		callbacks = c.listen(batchID, len(batch.Inputs))
+		defer c.stopListening(batchID)
+	}
+
+	size := c.BatchSize
+	if size <= 0 {
+		size = 20
+	}
+	parallelism := batch.parallelism()
+	index := map[string]int{} // input of each submission in flight
+	next := 0
+
+	// submit fills the free places in flight with the next inputs
+	submit := func() error {
+		for next < len(batch.Inputs) && len(index) < parallelism {
+			var chunk []int
+			for next < len(batch.Inputs) && len(chunk) < size && len(index)+len(chunk) < parallelism {
+				if !batch.skip(next) {
+					chunk = append(chunk, next)
+				}
+				next++
+			}
+			if len(chunk) == 0 {
+				continue
+			}
+			inputs := make([]Input, len(chunk))
+			for k, i := range chunk {
+				inputs[k] = batch.Inputs[i]
+			}
+			tokens, err := c.submitBatch(languageID, code, inputs, batch.Limits, c.callbackURL(batchID))
+			if err != nil {
+				return err
+			}
+			for k, token := range tokens {
+				index[token] = chunk[k]
+			}
+		}
+		return nil
+	}
+	record := func(result *Judge0Response) {
+		if i, ok := index[result.Token]; ok && result.Finished() && ctx.Err() == nil {
+			delete(index, result.Token)
+			batch.Done(i, result)
+		}
+	}
+
+	if err := submit(); err != nil {
+		return err
+	}
+	interval := c.PollInterval
+	if callbacks != nil {
+		interval = c.CallbackInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	stall := time.NewTimer(c.StallTimeout)
+	defer stall.Stop()
+	for len(index) > 0 {
+		inFlight := len(index)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case result := <-callbacks:
+			record(result)
+		case <-ticker.C:
+			var unfinished []string
+			for token := range index {
+				unfinished = append(unfinished, token)
+			}
+			for start := 0; start < len(unfinished); start += size {
+				end := start + size
+				if end > len(unfinished) {
+					end = len(unfinished)
+				}
+				polled, err := c.getBatch(unfinished[start:end])
+				if err != nil {
+					return err
+				}
+				for _, result := range polled {
+					record(result)
+				}
+			}
+		case <-stall.C:
+			return fmt.Errorf("batch stalled with %d submissions unfinished", len(index))
+		}
+		if len(index) < inFlight {
+			stall.Reset(c.StallTimeout)
+			if ctx.Err() == nil {
+				if err := submit(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// submitBatch creates one batch of submissions and returns their tokens in
+// order, streaming the inputs into the request body
+func (c *Judge0Client) submitBatch(languageID int, code string, inputs []Input, limits Limits, callbackURL string) ([]string, error) {
+	limits = c.clamp(limits)
+	body, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeBatch(pw, code, languageID, inputs, limits, callbackURL))
+	}()
+	defer body.Close()
+
+	resp, err := c.post(fmt.Sprintf("%s/submissions/batch?base64_encoded=false", c.URL), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit batch to Judge0: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Judge0 returned status %d", resp.StatusCode)
+	}
+
+	var created []Judge0Response
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(created) != len(inputs) {
+		return nil, fmt.Errorf("Judge0 created %d of %d submissions", len(created), len(inputs))
+	}
+	tokens := make([]string, len(created))
+	for i, submission := range created {
+		// Judge0 reports a rejected submission in place of its token
+		if submission.Token == "" {
+			return nil, fmt.Errorf("Judge0 rejected submission %d of the batch", i+1)
+		}
+		tokens[i] = submission.Token
+	}
+	return tokens, nil
+}
+
+// writeBatch writes a batch request body, one submission per input
+func writeBatch(w io.Writer, code string, languageID int, inputs []Input, limits Limits, callbackURL string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"submissions":[`)
+	for i, open := range inputs {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		stdin, err := open()
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i+1, err)
+		}
+		err = writeSubmission(bw, code, languageID, stdin, limits, callbackURL)
+		stdin.Close()
+		if err != nil {
+			return err
+		}
+	}
+	bw.WriteString(`]}`)
+	return bw.Flush()
+}
+
+// getBatch fetches the current state of several submissions
+func (c *Judge0Client) getBatch(tokens []string) ([]*Judge0Response, error) {
+	resp, err := c.get(fmt.Sprintf(
+		"%s/submissions/batch?tokens=%s&base64_encoded=false&fields=%s",
+		c.URL, url.QueryEscape(strings.Join(tokens, ",")), resultFields,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get results from Judge0: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Judge0 returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Submissions []*Judge0Response `json:"submissions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Submissions, nil
+}
+
+// HandleCallback takes a finished submission Judge0 reported for a batch.
+// The batch id and signature come from the callback URL; Judge0 sends the
+// output fields and the message base64 encoded.
+func (c *Judge0Client) HandleCallback(batch, signature string, body io.Reader) error {
+	if c.CallbackSecret == "" || !hmac.Equal([]byte(signature), []byte(c.sign(batch))) {
+		return ErrInvalidCallback
+	}
+	var result Judge0Response
+	if err := json.NewDecoder(body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode callback: %w", err)
+	}
+	for _, field := range []*string{&result.Stdout, &result.Stderr, &result.CompileOutput, &result.Message} {
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(*field, "\n", ""))
+		if err != nil {
+			return fmt.Errorf("failed to decode callback: %w", err)
+		}
+		*field = string(decoded)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results, ok := c.waiting[batch]
+	if !ok {
+		// The batch finished or gave up already
+		return nil
+	}
+	select {
+	case results <- &result:
+	default:
+		// A repeated callback; the poll picks up anything dropped
+	}
+	return nil
+}
+
+// callbackURL is the URL Judge0 reports a batch's submissions to, or empty
+// without callbacks
+func (c *Judge0Client) callbackURL(batch string) string {
+	if batch == "" {
+		return ""
+	}
+	u, err := url.Parse(c.CallbackURL)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	query.Set("batch", batch)
+	query.Set("signature", c.sign(batch))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (c *Judge0Client) sign(batch string) string {
+	mac := hmac.New(sha256.New, []byte(c.CallbackSecret))
+	mac.Write([]byte(batch))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// listen registers a batch for callbacks
+func (c *Judge0Client) listen(batch string, size int) chan *Judge0Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.waiting == nil {
+		c.waiting = map[string]chan *Judge0Response{}
+	}
+	results := make(chan *Judge0Response, size)
+	c.waiting[batch] = results
+	return results
+}
+
+func (c *Judge0Client) stopListening(batch string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.waiting, batch)
+}
+
+func newBatchID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,267 @@
+package judge
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJudge0 is a Judge0 server that runs every submission by echoing its
+// stdin, reporting results by callback and to batch polls
+type fakeJudge0 struct {
+	t      *testing.T
+	client *Judge0Client
+
+	callbacks bool // deliver results by callback
+	finish    bool // report submissions as finished when polled
+
+	mu      sync.Mutex
+	next    int
+	stdin   map[string]string
+	limits  []Judge0Submission
+	polls   int
+	batches int
+}
+
+func newFakeJudge0(t *testing.T) (*fakeJudge0, *Judge0Client) {
+	f := &fakeJudge0{t: t, finish: true, stdin: map[string]string{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	f.client = NewJudge0Client(server.URL)
+	f.client.PollInterval = 10 * time.Millisecond
+	f.client.CallbackInterval = time.Hour
+	f.client.StallTimeout = 5 * time.Second
+	return f, f.client
+}
+
+func (f *fakeJudge0) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/submissions/batch":
+		f.create(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/submissions/batch":
+		f.poll(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeJudge0) create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Submissions []struct {
+			Judge0Submission
+			CallbackURL string `json:"callback_url"`
+		} `json:"submissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.t.Errorf("batch request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.batches++
+	created := make([]Judge0Response, len(req.Submissions))
+	for i, s := range req.Submissions {
+		f.next++
+		token := fmt.Sprintf("token-%d", f.next)
+		f.stdin[token] = s.Stdin
+		f.limits = append(f.limits, s.Judge0Submission)
+		created[i].Token = token
+	}
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+
+	if f.callbacks {
+		for i, s := range req.Submissions {
+			go f.callback(s.CallbackURL, created[i].Token, s.Stdin)
+		}
+	}
+}
+
+// callback reports a finished submission the way Judge0 does, with its
+// output fields base64 encoded
+func (f *fakeJudge0) callback(callbackURL, token, stdin string) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		f.t.Errorf("callback URL %q: %v", callbackURL, err)
+		return
+	}
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	body, _ := json.Marshal(map[string]interface{}{
+		"token":   token,
+		"status":  map[string]interface{}{"id": StatusAccepted, "description": "Accepted"},
+		"stdout":  encode(stdin),
+		"stderr":  encode("note\n"),
+		"message": encode("from callback"),
+		"time":    "0.010",
+		"memory":  1024,
+	})
+	query := u.Query()
+	if err := f.client.HandleCallback(query.Get("batch"), query.Get("signature"), bytes.NewReader(body)); err != nil {
+		f.t.Errorf("callback: %v", err)
+	}
+}
+
+func (f *fakeJudge0) poll(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls++
+	var result struct {
+		Submissions []Judge0Response `json:"submissions"`
+	}
+	for _, token := range strings.Split(r.URL.Query().Get("tokens"), ",") {
+		response := Judge0Response{Token: token, Status: newStatus(StatusProcessing)}
+		if f.finish {
+			response.Status = newStatus(StatusAccepted)
+			response.Stdout = f.stdin[token]
+			response.Time = "0.010"
+		}
+		result.Submissions = append(result.Submissions, response)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// runBatch runs a batch of the given inputs and returns the results by input
+func runBatch(t *testing.T, c *Judge0Client, inputs []string, limits Limits) (map[int]*Judge0Response, error) {
+	batch := Batch{Limits: limits, Parallelism: 3}
+	for _, input := range inputs {
+		input := input
+		batch.Inputs = append(batch.Inputs, func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(input)), nil
+		})
+	}
+	results := map[int]*Judge0Response{}
+	batch.Done = func(i int, result *Judge0Response) {
+		if _, ok := results[i]; ok {
+			t.Errorf("input %d finished twice", i)
+		}
+		results[i] = result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := c.RunBatch(ctx, LanguagePython, "print(input())", batch)
+	return results, err
+}
+
+func testInputs(n int) []string {
+	inputs := make([]string, n)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("input %d\n\"quoted\"\t\x01", i)
+	}
+	return inputs
+}
+
+func checkEchoed(t *testing.T, inputs []string, results map[int]*Judge0Response) {
+	t.Helper()
+	if len(results) != len(inputs) {
+		t.Fatalf("got %d results, want %d", len(results), len(inputs))
+	}
+	for i, input := range inputs {
+		if results[i].Status.ID != StatusAccepted || results[i].Stdout != input {
+			t.Errorf("input %d: got status %d and stdout %q, want accepted and %q", i, results[i].Status.ID, results[i].Stdout, input)
+		}
+	}
+}
+
+func TestRunBatchPolls(t *testing.T) {
+	f, c := newFakeJudge0(t)
+	c.BatchSize = 2
+	inputs := testInputs(7)
+
+	results, err := runBatch(t, c, inputs, Limits{CPUTime: 1.5, Memory: 262144})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, inputs, results)
+	if f.batches < 4 {
+		t.Errorf("sent %d batch requests, want at least 4 of at most 2 submissions", f.batches)
+	}
+	for _, s := range f.limits {
+		if s.LanguageID != LanguagePython || s.CPUTimeLimit != 1.5 || s.MemoryLimit != 262144 {
+			t.Errorf("submitted language %d, cpu_time_limit %g and memory_limit %d", s.LanguageID, s.CPUTimeLimit, s.MemoryLimit)
+		}
+	}
+}
+
+func TestRunBatchLimitsClamped(t *testing.T) {
+	f, c := newFakeJudge0(t)
+	c.MaxCPUTimeLimit = 15
+	c.MaxMemoryLimit = 512000
+
+	if _, err := runBatch(t, c, testInputs(1), Limits{CPUTime: 20, Memory: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.limits[0]; got.CPUTimeLimit != 15 || got.MemoryLimit != 512000 {
+		t.Errorf("submitted cpu_time_limit %g and memory_limit %d, want 15 and 512000", got.CPUTimeLimit, got.MemoryLimit)
+	}
+}
+
+func TestRunBatchCallbacks(t *testing.T) {
+	f, c := newFakeJudge0(t)
+	c.CallbackURL = "http://judge.example/api/judge0/callback"
+	c.CallbackSecret = "secret"
+	f.callbacks = true
+	f.finish = false // only callbacks can finish the batch
+	inputs := testInputs(5)
+
+	results, err := runBatch(t, c, inputs, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, inputs, results)
+	for i, result := range results {
+		if result.Stderr != "note\n" || result.Message != "from callback" {
+			t.Errorf("input %d: got stderr %q and message %q, want them decoded", i, result.Stderr, result.Message)
+		}
+	}
+	if f.polls != 0 {
+		t.Errorf("polled %d times while callbacks arrived", f.polls)
+	}
+}
+
+func TestRunBatchPollsWhenCallbacksAreLost(t *testing.T) {
+	_, c := newFakeJudge0(t)
+	c.CallbackURL = "http://judge.example/api/judge0/callback"
+	c.CallbackSecret = "secret"
+	c.CallbackInterval = 10 * time.Millisecond
+	inputs := testInputs(4)
+
+	results, err := runBatch(t, c, inputs, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, inputs, results)
+}
+
+func TestRunBatchStalls(t *testing.T) {
+	f, c := newFakeJudge0(t)
+	f.finish = false
+	c.StallTimeout = 50 * time.Millisecond
+
+	_, err := runBatch(t, c, testInputs(2), Limits{})
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("got error %v, want a stalled batch", err)
+	}
+}
+
+func TestHandleCallbackRejectsBadSignature(t *testing.T) {
+	_, c := newFakeJudge0(t)
+	c.CallbackSecret = "secret"
+
+	err := c.HandleCallback("batch", c.sign("other"), strings.NewReader("{}"))
+	if err != ErrInvalidCallback {
+		t.Fatalf("got %v, want ErrInvalidCallback", err)
+	}
+}
@@ -0,0 +1,329 @@
+package judge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Language is a language submissions can be written in
+type Language struct {
+	Name           string   `json:"name"`
+	DisplayName    string   `json:"display_name"`
+	Aliases        []string `json:"aliases,omitempty"`   // other names submissions may use
+	Judge0ID       int      `json:"judge0_id,omitempty"` // zero when only the local executor runs it
+	Compile        string   `json:"compile,omitempty"`   // local executor build command, empty for interpreted languages
+	Run            string   `json:"run,omitempty"`       // local executor start command, empty when only Judge0 runs it
+	Extension      string   `json:"extension"`
+	SourceFile     string   `json:"source_file,omitempty"` // file name the local executor stores the source under; default prog plus the extension
+	MainClass      string   `json:"main_class,omitempty"`  // JVM class the program is started from, for Java-style languages
+	TimeMultiplier float64  `json:"time_multiplier"`       // scales the problem's time limit
+	Enabled        bool     `json:"enabled"`
+}
+
+// Source is the file name a program in the language is stored under for the
+// local executor
+func (l Language) Source() string {
+	if l.SourceFile != "" {
+		return l.SourceFile
+	}
+	return "prog" + l.Extension
+}
+
+var (
+	javaTypePattern       = regexp.MustCompile(`((?:\b(?:public|final|abstract|strictfp|static|sealed|non-sealed)\s+)*)\b(?:class|interface|enum|record)\s+([A-Za-z_$][\w$]*)`)
+	javaMainMethodPattern = regexp.MustCompile(`\bstatic\s+void\s+main\s*\(`)
+)
+
+// PrepareSource adapts a submission to how the language is run. Java is
+// started from MainClass, so when main is declared in a class, interface,
+// enum or record with another name, the top-level type holding it loses its
+// public modifier (a public type must match its file name) and a MainClass
+// launcher that calls it is appended.
+func (l Language) PrepareSource(code string) string {
+	if l.MainClass == "" {
+		return code
+	}
+	// declarations are looked for in the code with its comments and literals
+	// blanked out, whose offsets are those of the code
+	masked := maskJava(code)
+	main := javaMainMethodPattern.FindStringIndex(masked)
+	if main == nil {
+		return code
+	}
+	// main belongs to the types declared before it whose bodies are still
+	// open there, outermost first
+	var hosts [][]int
+	for _, m := range javaTypePattern.FindAllStringSubmatchIndex(masked, -1) {
+		if m[0] > main[0] {
+			break
+		}
+		if start := m[3]; m[2] == m[3] && start > 0 && (masked[start-1] == '.' || masked[start-1] == '@') {
+			continue // Foo.class or an @interface
+		}
+		if open := strings.IndexByte(masked[m[1]:main[0]], '{'); open >= 0 && stillOpen(masked[m[1]+open:main[0]]) {
+			hosts = append(hosts, m)
+		}
+	}
+	if len(hosts) == 0 || code[hosts[0][4]:hosts[0][5]] == l.MainClass {
+		return code
+	}
+	// a nested host is called through the types enclosing it; only the
+	// top-level one has to lose public
+	names := make([]string, len(hosts))
+	for i, m := range hosts {
+		names[i] = code[m[4]:m[5]]
+	}
+	decl := hosts[0]
+	modifiers := regexp.MustCompile(`\bpublic\s+`).ReplaceAllString(code[decl[2]:decl[3]], "")
+	return code[:decl[2]] + modifiers + code[decl[3]:] + fmt.Sprintf(
+		"\n\nclass %s {\n    public static void main(String[] args) throws Exception {\n        %s.main(args);\n    }\n}\n",
+		l.MainClass, strings.Join(names, "."),
+	)
+}
+
+// stillOpen reports whether the brace that starts body is not closed within it
+func stillOpen(body string) bool {
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// maskJava returns Java source with its comments and string, text block and
+// character literals replaced by spaces, keeping line breaks and offsets
+func maskJava(code string) string {
+	b := []byte(code)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(b); i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	// end returns the offset just past the quote that closes a literal
+	// opened before from, skipping escapes
+	end := func(from int, quote string) int {
+		for i := from; i < len(code); i++ {
+			if code[i] == '\\' {
+				i++
+			} else if strings.HasPrefix(code[i:], quote) {
+				return i + len(quote)
+			} else if code[i] == '\n' && len(quote) == 1 {
+				return i // unterminated
+			}
+		}
+		return len(code)
+	}
+	for i := 0; i < len(code); {
+		switch {
+		case strings.HasPrefix(code[i:], "//"):
+			j := strings.IndexByte(code[i:], '\n')
+			if j < 0 {
+				j = len(code) - i
+			}
+			blank(i, i+j)
+			i += j
+		case strings.HasPrefix(code[i:], "/*"):
+			j := strings.Index(code[i+2:], "*/")
+			if j < 0 {
+				j = len(code) - i - 4
+			}
+			blank(i, i+j+4)
+			i += j + 4
+		case strings.HasPrefix(code[i:], `"""`):
+			j := end(i+3, `"""`)
+			blank(i, j)
+			i = j
+		case code[i] == '"' || code[i] == '\'':
+			j := end(i+1, code[i:i+1])
+			blank(i, j)
+			i = j
+		default:
+			i++
+		}
+	}
+	return string(b)
+}
+
+// TimeLimit scales a problem's time limit, in milliseconds, for the language
+func (l Language) TimeLimit(ms int) int {
+	return int(float64(ms) * l.TimeMultiplier)
+}
+
+// defaultLanguages are used when no language file is configured
+var defaultLanguages = []Language{
+	{
+		Name:           "c",
+		DisplayName:    "C (GCC 9.2.0)",
+		Judge0ID:       LanguageC,
+		Compile:        "gcc -O2 -std=c11 -o prog prog.c -lm",
+		Run:            "./prog",
+		Extension:      ".c",
+		TimeMultiplier: 1,
+		Enabled:        true,
+	},
+	{
+		Name:           "cpp",
+		DisplayName:    "C++ (GCC 9.2.0)",
+		Aliases:        []string{"c++"},
+		Judge0ID:       LanguageCPP,
+		Compile:        "g++ -O2 -std=c++17 -o prog prog.cpp",
+		Run:            "./prog",
+		Extension:      ".cpp",
+		TimeMultiplier: 1,
+		Enabled:        true,
+	},
+	{
+		Name:           "python3",
+		DisplayName:    "Python (3.8.1)",
+		Aliases:        []string{"python"},
+		Judge0ID:       LanguagePython,
+		Run:            "python3 prog.py",
+		Extension:      ".py",
+		TimeMultiplier: 1,
+		Enabled:        true,
+	},
+	{
+		Name:           "java",
+		DisplayName:    "Java (OpenJDK 13.0.1)",
+		Judge0ID:       LanguageJava,
+		Compile:        "javac -encoding UTF-8 Main.java",
+		Run:            "java -Xss64m -cp . Main",
+		Extension:      ".java",
+		SourceFile:     "Main.java",
+		MainClass:      "Main",
+		TimeMultiplier: 2,
+		Enabled:        true,
+	},
+	{
+		Name:           "go",
+		DisplayName:    "Go (1.13.5)",
+		Aliases:        []string{"golang"},
+		Judge0ID:       LanguageGo,
+		Compile:        "go build -o prog prog.go",
+		Run:            "./prog",
+		Extension:      ".go",
+		TimeMultiplier: 1,
+		Enabled:        true,
+	},
+	{
+		Name:           "rust",
+		DisplayName:    "Rust (1.40.0)",
+		Judge0ID:       LanguageRust,
+		Compile:        "rustc -O -o prog prog.rs",
+		Run:            "./prog",
+		Extension:      ".rs",
+		TimeMultiplier: 1,
+		Enabled:        true,
+	},
+	{
+		Name:           "javascript",
+		DisplayName:    "JavaScript (Node.js 12.14.0)",
+		Aliases:        []string{"js", "node"},
+		Judge0ID:       LanguageJavaScript,
+		Run:            "node prog.js",
+		Extension:      ".js",
+		TimeMultiplier: 2,
+		Enabled:        true,
+	},
+	{
+		Name:           "kotlin",
+		DisplayName:    "Kotlin (1.3.70)",
+		Judge0ID:       LanguageKotlin,
+		Compile:        "kotlinc prog.kt -include-runtime -d prog.jar",
+		Run:            "java -Xss64m -jar prog.jar",
+		Extension:      ".kt",
+		TimeMultiplier: 2,
+		Enabled:        true,
+	},
+}
+
+// languages is the registry, by name and alias
+var languages = indexLanguages(defaultLanguages)
+
+// LoadLanguages replaces the built-in languages with those of a JSON file
+// holding an array of languages. An empty path keeps the built-in ones.
+func LoadLanguages(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var list []Language
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range list {
+		l := &list[i]
+		if l.Name == "" || l.Extension == "" {
+			return fmt.Errorf("%s: language %d needs a name and an extension", path, i+1)
+		}
+		if l.Judge0ID == 0 && l.Run == "" {
+			return fmt.Errorf("%s: language %s needs a judge0_id or a run command", path, l.Name)
+		}
+		if l.DisplayName == "" {
+			l.DisplayName = l.Name
+		}
+		if l.TimeMultiplier <= 0 {
+			l.TimeMultiplier = 1
+		}
+	}
+	index := indexLanguages(list)
+	if len(index) != countNames(list) {
+		return fmt.Errorf("%s: language names and aliases must be unique", path)
+	}
+	languages = index
+	return nil
+}
+
+func indexLanguages(list []Language) map[string]Language {
+	index := map[string]Language{}
+	for _, l := range list {
+		index[l.Name] = l
+		for _, alias := range l.Aliases {
+			index[alias] = l
+		}
+	}
+	return index
+}
+
+func countNames(list []Language) int {
+	n := 0
+	for _, l := range list {
+		n += 1 + len(l.Aliases)
+	}
+	return n
+}
+
+// LookupLanguage finds a language by name or alias, enabled or not
+func LookupLanguage(name string) (Language, bool) {
+	l, ok := languages[name]
+	return l, ok
+}
+
+// Languages lists the enabled languages the default executor can run, by name
+func Languages() []Language {
+	list := []Language{}
+	for name, l := range languages {
+		if name == l.Name && l.Enabled && Default.CanRun(l) {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
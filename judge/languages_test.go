@@ -0,0 +1,213 @@
+package judge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // empty when unknown
+	}{
+		{"cpp", "cpp"},
+		{"c++", "cpp"},
+		{"python", "python3"},
+		{"python3", "python3"},
+		{"golang", "go"},
+		{"js", "javascript"},
+		{"node", "javascript"},
+		{"Java", ""},
+		{"brainfuck", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		l, ok := LookupLanguage(tt.name)
+		if ok != (tt.want != "") || l.Name != tt.want {
+			t.Errorf("LookupLanguage(%q) = %q, %v; want %q", tt.name, l.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestTimeLimit(t *testing.T) {
+	java, _ := LookupLanguage("java")
+	cpp, _ := LookupLanguage("cpp")
+	if got := java.TimeLimit(1500); got != 3000 {
+		t.Errorf("java: got %d ms, want 3000", got)
+	}
+	if got := cpp.TimeLimit(1500); got != 1500 {
+		t.Errorf("cpp: got %d ms, want 1500", got)
+	}
+}
+
+func TestLoadLanguages(t *testing.T) {
+	saved := languages
+	t.Cleanup(func() { languages = saved })
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "languages.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if err := LoadLanguages(""); err != nil || len(languages) != len(saved) {
+		t.Fatalf("empty path: %v, %d names", err, len(languages))
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		err     string // empty when the file loads
+	}{
+		{"defaults filled in", `[{"name": "pypy", "aliases": ["pypy3"], "extension": ".py", "run": "pypy3 prog.py", "enabled": true}]`, ""},
+		{"not json", `[{`, "unexpected end of JSON input"},
+		{"no extension", `[{"name": "pypy", "run": "pypy3 prog.py"}]`, "language 1 needs a name and an extension"},
+		{"no way to run", `[{"name": "pypy", "extension": ".py"}]`, "language pypy needs a judge0_id or a run command"},
+		{"alias taken", `[{"name": "c", "extension": ".c", "judge0_id": 50}, {"name": "cpp", "aliases": ["c"], "extension": ".cpp", "judge0_id": 54}]`, "language names and aliases must be unique"},
+	}
+	for _, tt := range tests {
+		languages = saved
+		err := LoadLanguages(write(tt.content))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got %v, want an error with %q", tt.name, err, tt.err)
+			}
+			if len(languages) != len(saved) {
+				t.Errorf("%s: the registry changed on error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		l, ok := LookupLanguage("pypy3")
+		if !ok || l.Name != "pypy" || l.DisplayName != "pypy" || l.TimeMultiplier != 1 {
+			t.Errorf("%s: got %+v, %v", tt.name, l, ok)
+		}
+		if _, ok := LookupLanguage("cpp"); ok {
+			t.Errorf("%s: built-in languages kept", tt.name)
+		}
+	}
+}
+
+// launcher is the class PrepareSource appends to start Java from host
+func launcher(host string) string {
+	return "\n\nclass Main {\n    public static void main(String[] args) throws Exception {\n        " + host + ".main(args);\n    }\n}\n"
+}
+
+func TestPrepareSource(t *testing.T) {
+	java, ok := LookupLanguage("java")
+	if !ok {
+		t.Fatal("java is not registered")
+	}
+	tests := []struct {
+		name string
+		code string
+		want string // empty when the code is unchanged
+	}{
+		{
+			name: "already Main",
+			code: "public class Main {\n    public static void main(String[] args) {}\n}\n",
+		},
+		{
+			name: "no main",
+			code: "public class Solution {\n    static int solve() { return 1; }\n}\n",
+		},
+		{
+			name: "public class",
+			code: "public class Solution {\n    public static void main(String[] args) {}\n}\n",
+			want: "class Solution {\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "non-public class",
+			code: "import java.util.*;\n\nfinal class Solution {\n    public static void main(String[] args) {}\n}\n",
+			want: "import java.util.*;\n\nfinal class Solution {\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "after a helper class",
+			code: "class Pair { int a, b; }\npublic final class Solution {\n    public static void main(String[] args) {}\n}\n",
+			want: "class Pair { int a, b; }\nfinal class Solution {\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "nested class",
+			code: "public class Outer {\n    static class Inner {\n        public static void main(String[] args) {}\n    }\n}\n",
+			want: "class Outer {\n    static class Inner {\n        public static void main(String[] args) {}\n    }\n}\n" + launcher("Outer.Inner"),
+		},
+		{
+			name: "after a closed nested class",
+			code: "public class Solution {\n    static class Edge { int to; }\n    public static void main(String[] args) {}\n}\n",
+			want: "class Solution {\n    static class Edge { int to; }\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "braces and class in comments and strings",
+			code: "// class Fake {\n/* public class Other { */\npublic class Solution {\n    static String s = \"class X { {\";\n    static char c = '{';\n    static String t = \"\"\"\n        class Y {\n        \"\"\";\n    public static void main(String[] args) {}\n}\n",
+			want: "// class Fake {\n/* public class Other { */\nclass Solution {\n    static String s = \"class X { {\";\n    static char c = '{';\n    static String t = \"\"\"\n        class Y {\n        \"\"\";\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "main in a comment only",
+			code: "public class Solution {\n    // public static void main(String[] args) {}\n}\n",
+		},
+		{
+			name: "class literal before main",
+			code: "public class Solution {\n    static Object o = String.class;\n    public static void main(String[] args) {}\n}\n",
+			want: "class Solution {\n    static Object o = String.class;\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "interface",
+			code: "public interface Solution {\n    static void main(String[] args) {}\n}\n",
+			want: "interface Solution {\n    static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "enum",
+			code: "public enum Solution {\n    A, B;\n    public static void main(String[] args) {}\n}\n",
+			want: "enum Solution {\n    A, B;\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+		{
+			name: "record",
+			code: "public record Solution(int x) {\n    public static void main(String[] args) {}\n}\n",
+			want: "record Solution(int x) {\n    public static void main(String[] args) {}\n}\n" + launcher("Solution"),
+		},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want == "" {
+			want = tt.code
+		}
+		if got := java.PrepareSource(tt.code); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+
+	cpp, _ := LookupLanguage("cpp")
+	code := "class Solution { public: static void main() {} };"
+	if got := cpp.PrepareSource(code); got != code {
+		t.Errorf("cpp source changed:\n%s", got)
+	}
+}
+
+func TestMaskJava(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"int a; // {\nint b;", "int a;     \nint b;"},
+		{"a /* { \n } */ b", "a      \n      b"},
+		{`s = "a\"{"; t`, `s =       ; t`},
+		{`c = '\''; d = '{';`, `c =     ; d =    ;`},
+		{"t = \"\"\"\n{ \"x\" }\n\"\"\"; u", "t =    \n       \n   ; u"},
+		{"s = \"open\nclass A {", "s =      \nclass A {"},
+		{"/* never closed {", "                 "},
+	}
+	for _, tt := range tests {
+		got := maskJava(tt.code)
+		if got != tt.want {
+			t.Errorf("maskJava(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+		if len(got) != len(tt.code) || strings.Count(got, "\n") != strings.Count(tt.code, "\n") {
+			t.Errorf("maskJava(%q) moved offsets or line breaks", tt.code)
+		}
+	}
+}
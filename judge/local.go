@@ -0,0 +1,477 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// localCompileTimeout bounds one build
+	localCompileTimeout = time.Minute
+	// localDefaultCPULimit applies to runs without a time limit, in seconds
+	localDefaultCPULimit = 5
+	// maxLocalOutput caps the compiler output and stderr kept
+	maxLocalOutput = 64 << 10
+	// maxLocalStdout caps the program output kept for checking
+	maxLocalStdout = 64 << 20
+	// localMemoryHeadroom scales the memory limit into the data segment
+	// limit a run gets. The data limit stops runaway allocations; above the
+	// memory limit, it lets a program that goes over be measured and get
+	// memory_limit_exceeded rather than fail to allocate.
+	localMemoryHeadroom = 2
+)
+
+// LocalExecutor runs programs as processes on this host. Programs get a
+// private working directory and a time limit, but no other sandbox: use it
+// for development, or on a host dedicated to judging.
+type LocalExecutor struct {
+	WorkDir string // where working directories are made; empty for the system default
+}
+
+// CanRun reports whether the language has local commands or, failing that,
+// runs in Judge0
+func (*LocalExecutor) CanRun(l Language) bool { return l.Run != "" || l.Judge0ID != 0 }
+
+// Run builds and runs a program on this host; languages without local
+// commands are passed on to Judge0
+func (e *LocalExecutor) Run(l Language, code string, stdin io.Reader, limits Limits) (*Judge0Response, error) {
+	if l.Run == "" {
+		return Judge0Executor{}.Run(l, code, stdin, limits)
+	}
+	program, failed, err := e.buildSubmission(l, code)
+	if failed != nil || err != nil {
+		return failed, err
+	}
+	defer os.RemoveAll(program.Dir)
+	return program.run(context.Background(), stdin, limits)
+}
+
+// RunBatch builds a program once and runs it on the inputs in parallel;
+// languages without local commands are passed on to Judge0
+func (e *LocalExecutor) RunBatch(ctx context.Context, l Language, code string, batch Batch) error {
+	if l.Run == "" {
+		return Judge0Executor{}.RunBatch(ctx, l, code, batch)
+	}
+	program, failed, err := e.buildSubmission(l, code)
+	if err != nil {
+		return err
+	}
+	if failed != nil {
+		for i := range batch.Inputs {
+			if !batch.skip(i) {
+				batch.Done(i, failed)
+			}
+		}
+		return nil
+	}
+	defer os.RemoveAll(program.Dir)
+
+	var (
+		mu       sync.Mutex // serializes Done and guards next and firstErr
+		next     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	// take hands out the next input to run, or -1 when there is none
+	take := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		for firstErr == nil && ctx.Err() == nil && next < len(batch.Inputs) {
+			i := next
+			next++
+			if !batch.skip(i) {
+				return i
+			}
+		}
+		return -1
+	}
+	for w := 0; w < batch.parallelism(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := take(); i >= 0; i = take() {
+				result, err := runInput(ctx, program, batch.Inputs[i], batch.Limits)
+				mu.Lock()
+				switch {
+				case ctx.Err() != nil:
+				case err != nil:
+					if firstErr == nil {
+						firstErr = fmt.Errorf("input %d: %w", i+1, err)
+					}
+				default:
+					batch.Done(i, result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+func runInput(ctx context.Context, program *localBuild, open Input, limits Limits) (*Judge0Response, error) {
+	stdin, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer stdin.Close()
+	return program.run(ctx, stdin, limits)
+}
+
+// buildSubmission builds a submission; one that fails to compile comes back
+// as a Compilation Error result instead
+func (e *LocalExecutor) buildSubmission(l Language, code string) (*localBuild, *Judge0Response, error) {
+	program, err := e.build(Program{Language: l.Name, Files: []File{{Name: l.Source(), Data: []byte(l.PrepareSource(code))}}})
+	var compileErr *compileError
+	if errors.As(err, &compileErr) {
+		return nil, &Judge0Response{Status: newStatus(StatusCompilationError), CompileOutput: compileErr.Output}, nil
+	}
+	return program, nil, err
+}
+
+// run runs a built submission on one input; cancelling parent kills it.
+// Memory is limited through the data segment, and a run whose peak memory
+// is over the limit still comes back as it ended, for the caller to judge.
+func (b *localBuild) run(parent context.Context, stdin io.Reader, limits Limits) (*Judge0Response, error) {
+	cpuLimit := limits.CPUTime
+	if cpuLimit <= 0 {
+		cpuLimit = localDefaultCPULimit
+	}
+	ctx, cancel := context.WithTimeout(parent, time.Duration(2*cpuLimit*float64(time.Second))+time.Second)
+	defer cancel()
+	cmd := b.command(ctx, limits.Memory)
+	maxStdout := maxLocalStdout
+	if limits.MaxFileSize > 0 {
+		maxStdout = limits.MaxFileSize << 10
+	}
+	stdout, stderr := &limitedBuffer{max: maxStdout}, &limitedBuffer{max: maxLocalOutput}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	if err := waitError(cmd.Run()); err != nil {
+		return nil, err
+	}
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+
+	cpu := cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	result := &Judge0Response{
+		Status: newStatus(StatusAccepted),
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+		Time:   fmt.Sprintf("%.3f", cpu.Seconds()),
+		Memory: peakMemory(cmd.ProcessState),
+	}
+	switch {
+	case ctx.Err() != nil || cpu.Seconds() > cpuLimit:
+		result.Status = newStatus(StatusTimeLimitExceeded)
+	case stdout.dropped:
+		// Judge0 reports output over its limit as SIGXFSZ
+		result.Status = newStatus(StatusSIGXFSZ)
+	default:
+		setExitStatus(result, cmd.ProcessState)
+	}
+	return result, nil
+}
+
+// setExitStatus sets the status of a run that ended on its own from how its
+// process exited, the way Judge0 reports it
+func setExitStatus(result *Judge0Response, state *os.ProcessState) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		signal := int(ws.Signal())
+		result.ExitSignal = &signal
+		switch ws.Signal() {
+		case syscall.SIGSEGV:
+			result.Status = newStatus(StatusSIGSEGV)
+		case syscall.SIGFPE:
+			result.Status = newStatus(StatusSIGFPE)
+		case syscall.SIGABRT:
+			result.Status = newStatus(StatusSIGABRT)
+		default:
+			result.Status = newStatus(StatusRuntimeError)
+		}
+		return
+	}
+	if code := state.ExitCode(); code != 0 {
+		result.ExitCode = &code
+		result.Status = newStatus(StatusNZEC)
+	}
+}
+
+// Judge0For returns the default Judge0 server for languages without local
+// commands, which are passed on to it
+func (*LocalExecutor) Judge0For(l Language) *Judge0Client {
+	if l.Run == "" {
+		return Judge0
+	}
+	return nil
+}
+
+// Toolchain builds problem programs with the local commands of their
+// language from the registry
+func (*LocalExecutor) Toolchain(language string) (Toolchain, bool) {
+	return localToolchain(language)
+}
+
+// GraderToolchain builds a solution together with a grader with the
+// compilers on this host
+func (*LocalExecutor) GraderToolchain(language string) (Toolchain, bool) {
+	l, ok := LookupLanguage(language)
+	if !ok {
+		return Toolchain{}, false
+	}
+	t, ok := localGraderToolchains[l.Name]
+	return t, ok
+}
+
+// RunMultiFile builds a program from its files on this host and runs its
+// script with sh
+func (e *LocalExecutor) RunMultiFile(ctx context.Context, run MultiFileRun) (*Judge0Response, error) {
+	program, err := e.buildFiles(run.Files, run.Compile, []string{"sh", "-c", run.Run})
+	var compileErr *compileError
+	if errors.As(err, &compileErr) {
+		return &Judge0Response{Status: newStatus(StatusCompilationError), CompileOutput: compileErr.Output}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(program.Dir)
+	return program.run(ctx, strings.NewReader(run.Stdin), run.Limits)
+}
+
+// Interactive reports that the local executor can run interactive problems
+func (*LocalExecutor) Interactive() bool { return true }
+
+// RunInteractive builds the solution and the interactor and runs them
+// connected by a pair of pipes
+func (e *LocalExecutor) RunInteractive(parent context.Context, run InteractiveRun) (*InteractiveResult, error) {
+	interactor, err := e.build(run.Interactor)
+	if err != nil {
+		return nil, fmt.Errorf("interactor: %w", err)
+	}
+	defer os.RemoveAll(interactor.Dir)
+
+	solution, err := e.build(run.Solution)
+	var compileErr *compileError
+	if errors.As(err, &compileErr) {
+		return &InteractiveResult{CompileOutput: compileErr.Output}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("solution: %w", err)
+	}
+	defer os.RemoveAll(solution.Dir)
+
+	// The solution gets twice its CPU time in wall time, as it spends part of
+	// it waiting for the interactor
+	solutionWall := time.Duration(2*run.TimeLimit*float64(time.Second)) + time.Second
+	interactorWall := time.Duration(run.InteractorTimeLimit * float64(time.Second))
+	ctx, cancel := context.WithTimeout(parent, solutionWall+interactorWall)
+	defer cancel()
+
+	solutionCmd := solution.command(ctx, run.MemoryLimit)
+	interactorCmd := interactor.command(ctx, 0, run.InteractorArgs...)
+
+	// toInteractor carries the solution's output, toSolution the interactor's
+	toInteractorR, toInteractorW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	toSolutionR, toSolutionW, err := os.Pipe()
+	if err != nil {
+		toInteractorR.Close()
+		toInteractorW.Close()
+		return nil, err
+	}
+	solutionCmd.Stdin, solutionCmd.Stdout = toSolutionR, toInteractorW
+	interactorCmd.Stdin, interactorCmd.Stdout = toInteractorR, toSolutionW
+	stderr := &limitedBuffer{max: maxLocalOutput}
+	interactorCmd.Stderr = stderr
+
+	err = interactorCmd.Start()
+	if err == nil {
+		if err = solutionCmd.Start(); err != nil {
+			interactorCmd.Process.Kill()
+			interactorCmd.Wait()
+		}
+	}
+	// The children hold their own ends now; closing ours lets each side see
+	// end of file once the other exits
+	for _, f := range []*os.File{toInteractorR, toInteractorW, toSolutionR, toSolutionW} {
+		f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start: %w", err)
+	}
+
+	var killed atomic.Bool
+	timer := time.AfterFunc(solutionWall, func() {
+		killed.Store(true)
+		solutionCmd.Process.Kill()
+	})
+	solutionErr := solutionCmd.Wait()
+	timer.Stop()
+	interactorErr := interactorCmd.Wait()
+	if err := waitError(solutionErr); err != nil {
+		return nil, fmt.Errorf("solution: %w", err)
+	}
+	if err := waitError(interactorErr); err != nil {
+		return nil, fmt.Errorf("interactor: %w", err)
+	}
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+
+	cpu := solutionCmd.ProcessState.UserTime() + solutionCmd.ProcessState.SystemTime()
+	return &InteractiveResult{
+		SolutionExit:     solutionCmd.ProcessState.ExitCode(),
+		TimedOut:         killed.Load() || cpu.Seconds() > run.TimeLimit,
+		Runtime:          int(cpu.Milliseconds()),
+		Memory:           peakMemory(solutionCmd.ProcessState),
+		InteractorExit:   interactorCmd.ProcessState.ExitCode(),
+		InteractorStderr: stderr.String(),
+	}, nil
+}
+
+// localBuild is a program built in its own working directory
+type localBuild struct {
+	Dir     string
+	Command []string // how to start it, relative to Dir
+}
+
+// compileError reports a program that failed to build
+type compileError struct {
+	Output string
+}
+
+func (e *compileError) Error() string {
+	return "compilation failed: " + e.Output
+}
+
+// build writes a program's files into a fresh working directory and compiles
+// it there with the local commands of its language
+func (e *LocalExecutor) build(p Program) (*localBuild, error) {
+	toolchain, ok := localToolchain(p.Language)
+	if !ok {
+		return nil, fmt.Errorf("language %q cannot run locally", p.Language)
+	}
+	return e.buildFiles(p.Files, toolchain.Compile, strings.Fields(toolchain.Run))
+}
+
+// buildFiles writes files into a fresh working directory and runs a compile
+// command there, if any; command is how the result is started
+func (e *LocalExecutor) buildFiles(files []File, compile string, command []string) (*localBuild, error) {
+	dir, err := os.MkdirTemp(e.WorkDir, "judge-")
+	if err != nil {
+		return nil, err
+	}
+	b := &localBuild{Dir: dir, Command: command}
+
+	for _, f := range files {
+		name := filepath.Clean(filepath.FromSlash(f.Name))
+		if !filepath.IsLocal(name) {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("invalid file name %q", f.Name)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), f.Data, 0o644); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	if compile != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), localCompileTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", compile)
+		cmd.Dir = dir
+		cmd.Env = localEnv()
+		output := &limitedBuffer{max: maxLocalOutput}
+		cmd.Stdout, cmd.Stderr = output, output
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.RemoveAll(dir)
+			return nil, &compileError{Output: output.String()}
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// localToolchain builds a language with its local commands from the registry
+func localToolchain(language string) (Toolchain, bool) {
+	l, ok := LookupLanguage(language)
+	if !ok || l.Run == "" {
+		return Toolchain{}, false
+	}
+	return Toolchain{Source: l.Source(), Compile: l.Compile, Run: l.Run}, true
+}
+
+// command prepares a built program to run with the given arguments. A
+// memory limit, in KB, is applied by a shell that sets the data segment
+// limit and then execs the program, so the program keeps its process.
+func (b *localBuild) command(ctx context.Context, memoryLimit int, args ...string) *exec.Cmd {
+	argv := append(append([]string{}, b.Command...), args...)
+	if memoryLimit > 0 {
+		limit := fmt.Sprintf(`ulimit -d %d && exec "$@"`, memoryLimit*localMemoryHeadroom)
+		argv = append([]string{"sh", "-c", limit, "sh"}, argv...)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = b.Dir
+	cmd.Env = localEnv()
+	return cmd
+}
+
+// localEnv is the environment programs run with; the server's own variables
+// hold secrets and are not passed on
+func localEnv() []string {
+	return []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.TempDir()}
+}
+
+// waitError filters out the exit errors of a finished program, whose exit
+// code is read from its process state
+func waitError(err error) error {
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		return nil
+	}
+	return err
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest
+type limitedBuffer struct {
+	max     int
+	buf     []byte
+	dropped bool // more than max bytes were written
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - len(b.buf); n > room {
+		p, b.dropped = p[:room], true
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+func (b *limitedBuffer) String() string {
+	return string(b.buf)
+}
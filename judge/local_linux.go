@@ -0,0 +1,15 @@
+package judge
+
+import (
+	"os"
+	"syscall"
+)
+
+// peakMemory returns the peak resident memory of a finished process and the
+// children it waited for, in kilobytes
+func peakMemory(state *os.ProcessState) int {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return int(usage.Maxrss) // Linux reports kilobytes
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package judge
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		want    string
+		dropped bool
+	}{
+		{"nothing written", nil, "", false},
+		{"under the limit", []string{"ab", "c"}, "abc", false},
+		{"exactly the limit", []string{"abc", "de"}, "abcde", false},
+		{"over in one write", []string{"abcdefg"}, "abcde", true},
+		{"over across writes", []string{"abc", "def", "gh"}, "abcde", true},
+		{"full before a write", []string{"abcde", "f"}, "abcde", true},
+	}
+	for _, tt := range tests {
+		b := &limitedBuffer{max: 5}
+		for _, w := range tt.writes {
+			// The writer of a pipe must not see a short write
+			if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", tt.name, w, n, err)
+			}
+		}
+		if b.String() != tt.want || b.dropped != tt.dropped {
+			t.Errorf("%s: got %q, dropped %v; want %q, %v", tt.name, b.String(), b.dropped, tt.want, tt.dropped)
+		}
+	}
+}
+
+func TestWaitError(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	if _, ok := exitErr.(*exec.ExitError); !ok {
+		t.Skipf("sh did not exit with an exit error: %v", exitErr)
+	}
+	failed := errors.New("pipe closed")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"success", nil, nil},
+		{"non-zero exit", exitErr, nil},
+		{"wrapped exit", &exec.Error{Name: "x", Err: exitErr}, nil},
+		{"other failure", failed, failed},
+	}
+	for _, tt := range tests {
+		if got := waitError(tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package judge
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// LanguageMultiFile is Judge0's "Multi-file program" language: the submission
+// is a zip holding the files plus a compile and a run script
+const LanguageMultiFile = 89
+
+// File is a file placed in the working directory of a multi-file run
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Toolchain describes how to build and start a program written in one
+// language inside a multi-file run
+type Toolchain struct {
+	Source  string // file name the source is stored under
+	Grader  string // file name a grader is stored under, for grader toolchains
+	Compile string // build command, empty for interpreted languages
+	Run     string // command that starts the program
+}
+
+// toolchains cover the languages setters can write checkers and other
+// problem programs in on Judge0; paths are those of the Judge0 image
+var toolchains = map[string]Toolchain{
+	"c": {
+		Source:  "prog.c",
+		Compile: "/usr/local/gcc-9.2.0/bin/gcc -O2 -std=c11 -o prog prog.c -lm",
+		Run:     "./prog",
+	},
+	"cpp": {
+		Source:  "prog.cpp",
+		Compile: "/usr/local/gcc-9.2.0/bin/g++ -O2 -std=c++17 -o prog prog.cpp",
+		Run:     "./prog",
+	},
+	"python3": {
+		Source: "prog.py",
+		Run:    "/usr/local/python-3.8.1/bin/python3 prog.py",
+	},
+}
+
+// graderToolchains build a contestant's solution together with a setter's
+// grader, which holds the entry point and calls the contestant's functions.
+// Graders are written in c, cpp or python3 whichever executor runs them.
+var graderToolchains = map[string]Toolchain{
+	"c": {
+		Source:  "solution.c",
+		Grader:  "grader.c",
+		Compile: "/usr/local/gcc-9.2.0/bin/gcc -O2 -std=c11 -o prog grader.c solution.c -lm",
+		Run:     "./prog",
+	},
+	"cpp": {
+		Source:  "solution.cpp",
+		Grader:  "grader.cpp",
+		Compile: "/usr/local/gcc-9.2.0/bin/g++ -O2 -std=c++17 -o prog grader.cpp solution.cpp",
+		Run:     "./prog",
+	},
+	"python3": {
+		Source: "solution.py",
+		Grader: "grader.py",
+		Run:    "/usr/local/python-3.8.1/bin/python3 grader.py",
+	},
+}
+
+// ToolchainFor returns the default executor's toolchain for a program
+// language
+func ToolchainFor(language string) (Toolchain, bool) {
+	return Default.Toolchain(language)
+}
+
+// localGraderToolchains are graderToolchains with the commands of the
+// local executor
+var localGraderToolchains = map[string]Toolchain{
+	"c": {
+		Source:  "solution.c",
+		Grader:  "grader.c",
+		Compile: "gcc -O2 -std=c11 -o prog grader.c solution.c -lm",
+		Run:     "./prog",
+	},
+	"cpp": {
+		Source:  "solution.cpp",
+		Grader:  "grader.cpp",
+		Compile: "g++ -O2 -std=c++17 -o prog grader.cpp solution.cpp",
+		Run:     "./prog",
+	},
+	"python3": {
+		Source: "solution.py",
+		Grader: "grader.py",
+		Run:    "python3 grader.py",
+	},
+}
+
+// GraderToolchainFor returns the default executor's toolchain that builds a
+// solution in a language together with a grader
+func GraderToolchainFor(language string) (Toolchain, bool) {
+	return Default.GraderToolchain(language)
+}
+
+// MultiFileRun is a program built from a set of files by a compile command
+// and started by a run script, on one input
+type MultiFileRun struct {
+	Files   []File
+	Compile string // empty when nothing is built
+	Run     string
+	Stdin   string
+	Limits  Limits
+}
+
+// RunMultiFile runs a compile and a run script over a set of files in
+// Judge0 and waits for the result
+func (c *Judge0Client) RunMultiFile(ctx context.Context, run MultiFileRun) (*Judge0Response, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	scripts := []File{
+		{Name: "compile", Data: []byte("#!/bin/bash\n" + run.Compile + "\n")},
+		{Name: "run", Data: []byte("#!/bin/bash\n" + run.Run + "\n")},
+	}
+	for _, f := range append(scripts, run.Files...) {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	limits := c.clamp(run.Limits)
+	jsonData, err := json.Marshal(Judge0Submission{
+		LanguageID:      LanguageMultiFile,
+		Stdin:           run.Stdin,
+		AdditionalFiles: base64.StdEncoding.EncodeToString(buf.Bytes()),
+		CPUTimeLimit:    limits.CPUTime,
+		MemoryLimit:     limits.Memory,
+		MaxFileSize:     limits.MaxFileSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal submission: %w", err)
+	}
+
+	resp, err := c.post(fmt.Sprintf("%s/submissions?base64_encoded=false&wait=false", c.URL), bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit to Judge0: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Judge0 returned status %d", resp.StatusCode)
+	}
+
+	var created Judge0Response
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	for i := 0; i < 60; i++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+		result, err := c.GetSubmissionResult(created.Token)
+		if err != nil {
+			return nil, err
+		}
+		if result.Finished() {
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("submission timed out after %d attempts", 60)
+}
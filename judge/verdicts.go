@@ -0,0 +1,124 @@
+package judge
+
+import "fmt"
+
+// Verdicts of a submission or of a run on one testcase
+const (
+	VerdictPending             = "pending"
+	VerdictRunning             = "running"
+	VerdictAccepted            = "accepted"
+	VerdictWrongAnswer         = "wrong_answer"
+	VerdictPresentationError   = "presentation_error" // right tokens, wrong layout
+	VerdictTimeLimitExceeded   = "time_limit_exceeded"
+	VerdictMemoryLimitExceeded = "memory_limit_exceeded"
+	VerdictOutputLimitExceeded = "output_limit_exceeded"
+	VerdictRuntimeError        = "runtime_error"
+	VerdictCompilationError    = "compilation_error"
+	VerdictJudgeError          = "judge_error" // the judge failed, not the program
+)
+
+// Judge0 status IDs
+const (
+	StatusInQueue           = 1
+	StatusProcessing        = 2
+	StatusAccepted          = 3
+	StatusWrongAnswer       = 4
+	StatusTimeLimitExceeded = 5
+	StatusCompilationError  = 6
+	StatusSIGSEGV           = 7  // Runtime Error (SIGSEGV)
+	StatusSIGXFSZ           = 8  // Runtime Error (SIGXFSZ): output too large
+	StatusSIGFPE            = 9  // Runtime Error (SIGFPE)
+	StatusSIGABRT           = 10 // Runtime Error (SIGABRT)
+	StatusNZEC              = 11 // Runtime Error (NZEC): non-zero exit code
+	StatusRuntimeError      = 12 // Runtime Error (Other)
+	StatusInternalError     = 13
+	StatusExecFormatError   = 14
+)
+
+// statusDescriptions are Judge0's descriptions of its statuses
+var statusDescriptions = map[int]string{
+	StatusInQueue:           "In Queue",
+	StatusProcessing:        "Processing",
+	StatusAccepted:          "Accepted",
+	StatusWrongAnswer:       "Wrong Answer",
+	StatusTimeLimitExceeded: "Time Limit Exceeded",
+	StatusCompilationError:  "Compilation Error",
+	StatusSIGSEGV:           "Runtime Error (SIGSEGV)",
+	StatusSIGXFSZ:           "Runtime Error (SIGXFSZ)",
+	StatusSIGFPE:            "Runtime Error (SIGFPE)",
+	StatusSIGABRT:           "Runtime Error (SIGABRT)",
+	StatusNZEC:              "Runtime Error (NZEC)",
+	StatusRuntimeError:      "Runtime Error (Other)",
+	StatusInternalError:     "Internal Error",
+	StatusExecFormatError:   "Exec Format Error",
+}
+
+// newStatus returns the Judge0 status with an ID
+func newStatus(id int) *Judge0Status {
+	return &Judge0Status{ID: id, Description: statusDescriptions[id]}
+}
+
+// MapJudge0StatusToInternal maps Judge0 status to internal status. Judge0
+// reports an output over its limit as SIGXFSZ; its own failures, and statuses
+// this server does not know, are judge errors.
+func MapJudge0StatusToInternal(judge0StatusID int) string {
+	switch judge0StatusID {
+	case StatusInQueue:
+		return VerdictPending
+	case StatusProcessing:
+		return VerdictRunning
+	case StatusAccepted:
+		return VerdictAccepted
+	case StatusWrongAnswer:
+		return VerdictWrongAnswer
+	case StatusTimeLimitExceeded:
+		return VerdictTimeLimitExceeded
+	case StatusCompilationError:
+		return VerdictCompilationError
+	case StatusSIGXFSZ:
+		return VerdictOutputLimitExceeded
+	case StatusSIGSEGV, StatusSIGFPE, StatusSIGABRT, StatusNZEC, StatusRuntimeError:
+		return VerdictRuntimeError
+	default:
+		return VerdictJudgeError
+	}
+}
+
+// Verdict returns the verdict of a run and, for runtime errors and judge
+// errors, what went wrong: the signal or exit code, or Judge0's message
+func (r *Judge0Response) Verdict() (verdict, detail string) {
+	if r.Status == nil {
+		return VerdictJudgeError, "no status"
+	}
+	verdict = MapJudge0StatusToInternal(r.Status.ID)
+	switch r.Status.ID {
+	case StatusSIGSEGV:
+		detail = "SIGSEGV"
+	case StatusSIGFPE:
+		detail = "SIGFPE"
+	case StatusSIGABRT:
+		detail = "SIGABRT"
+	case StatusNZEC:
+		if r.ExitCode != nil {
+			detail = fmt.Sprintf("exit code %d", *r.ExitCode)
+		} else {
+			detail = "non-zero exit code"
+		}
+	case StatusRuntimeError:
+		if r.ExitSignal != nil {
+			detail = fmt.Sprintf("signal %d", *r.ExitSignal)
+		} else {
+			detail = r.Message
+		}
+	case StatusInternalError, StatusExecFormatError:
+		detail = r.Status.Description
+		if r.Message != "" {
+			detail += ": " + r.Message
+		}
+	default:
+		if verdict == VerdictJudgeError {
+			detail = fmt.Sprintf("unknown Judge0 status %d", r.Status.ID)
+		}
+	}
+	return verdict, detail
+}
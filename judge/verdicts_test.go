@@ -0,0 +1,64 @@
+package judge
+
+import "testing"
+
+func TestMapJudge0StatusToInternal(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{StatusInQueue, VerdictPending},
+		{StatusProcessing, VerdictRunning},
+		{StatusAccepted, VerdictAccepted},
+		{StatusWrongAnswer, VerdictWrongAnswer},
+		{StatusTimeLimitExceeded, VerdictTimeLimitExceeded},
+		{StatusCompilationError, VerdictCompilationError},
+		{StatusSIGSEGV, VerdictRuntimeError},
+		{StatusSIGXFSZ, VerdictOutputLimitExceeded},
+		{StatusSIGFPE, VerdictRuntimeError},
+		{StatusSIGABRT, VerdictRuntimeError},
+		{StatusNZEC, VerdictRuntimeError},
+		{StatusRuntimeError, VerdictRuntimeError},
+		{StatusInternalError, VerdictJudgeError},
+		{StatusExecFormatError, VerdictJudgeError},
+		{0, VerdictJudgeError},
+		{15, VerdictJudgeError},
+		{99, VerdictJudgeError},
+	}
+	for _, tt := range tests {
+		if got := MapJudge0StatusToInternal(tt.status); got != tt.want {
+			t.Errorf("status %d: got %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	code, signal := 3, 9
+	tests := []struct {
+		name     string
+		response Judge0Response
+		verdict  string
+		detail   string
+	}{
+		{"no status", Judge0Response{}, VerdictJudgeError, "no status"},
+		{"accepted", Judge0Response{Status: newStatus(StatusAccepted)}, VerdictAccepted, ""},
+		{"wrong answer", Judge0Response{Status: newStatus(StatusWrongAnswer)}, VerdictWrongAnswer, ""},
+		{"output limit", Judge0Response{Status: newStatus(StatusSIGXFSZ)}, VerdictOutputLimitExceeded, ""},
+		{"segfault", Judge0Response{Status: newStatus(StatusSIGSEGV)}, VerdictRuntimeError, "SIGSEGV"},
+		{"division by zero", Judge0Response{Status: newStatus(StatusSIGFPE)}, VerdictRuntimeError, "SIGFPE"},
+		{"abort", Judge0Response{Status: newStatus(StatusSIGABRT)}, VerdictRuntimeError, "SIGABRT"},
+		{"exit code", Judge0Response{Status: newStatus(StatusNZEC), ExitCode: &code}, VerdictRuntimeError, "exit code 3"},
+		{"exit code unknown", Judge0Response{Status: newStatus(StatusNZEC)}, VerdictRuntimeError, "non-zero exit code"},
+		{"other signal", Judge0Response{Status: newStatus(StatusRuntimeError), ExitSignal: &signal, Message: "killed"}, VerdictRuntimeError, "signal 9"},
+		{"other message", Judge0Response{Status: newStatus(StatusRuntimeError), Message: "killed"}, VerdictRuntimeError, "killed"},
+		{"internal error", Judge0Response{Status: newStatus(StatusInternalError), Message: "box busy"}, VerdictJudgeError, "Internal Error: box busy"},
+		{"exec format error", Judge0Response{Status: newStatus(StatusExecFormatError)}, VerdictJudgeError, "Exec Format Error"},
+		{"unknown status", Judge0Response{Status: newStatus(42)}, VerdictJudgeError, "unknown Judge0 status 42"},
+	}
+	for _, tt := range tests {
+		verdict, detail := tt.response.Verdict()
+		if verdict != tt.verdict || detail != tt.detail {
+			t.Errorf("%s: got %s %q, want %s %q", tt.name, verdict, detail, tt.verdict, tt.detail)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"codesprint/database"
+	"codesprint/events"
 	"codesprint/handlers"
+	"codesprint/judge"
 	"codesprint/middleware"
+	"codesprint/storage"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -24,6 +28,35 @@ func main() {
 	}
 	defer database.CloseDB()
 
+	// Blob storage for testcase data
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize blob storage: %v", err)
+	}
+
+	// Submission languages, from LANGUAGES_FILE when set
+	if err := judge.LoadLanguages(os.Getenv("LANGUAGES_FILE")); err != nil {
+		log.Fatalf("Failed to load languages: %v", err)
+	}
+
+	// Maintenance commands, e.g. `./main rebuild-standings 3`
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
+	// Watch the judge, and pick up the submissions still queued for it
+	judge.Judge0.StartHealthChecks(15 * time.Second)
+	handlers.StartResumingQueuedSubmissions()
+
+	// Relay live events between backend instances when configured
+	if os.Getenv("EVENTS_BACKEND") == "postgres" {
+		if err := events.ListenPostgres(database.ConnString()); err != nil {
+			log.Fatalf("Failed to start event relay: %v", err)
+		}
+	}
+
 	// Create router
 	r := mux.NewRouter()
 
@@ -41,23 +74,77 @@ func main() {
 	api.HandleFunc("/contests", handlers.GetContests).Methods("GET")
 	api.HandleFunc("/contest/{id:[0-9]+}", handlers.GetContest).Methods("GET")
 	api.HandleFunc("/contests", middleware.AuthMiddleware(handlers.CreateContest)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}", middleware.AuthMiddleware(handlers.UpdateContest)).Methods("PUT", "PATCH")
+	api.HandleFunc("/contest/{id:[0-9]+}", middleware.AuthMiddleware(handlers.DeleteContest)).Methods("DELETE")
+	api.HandleFunc("/contest/{id:[0-9]+}/clone", middleware.AuthMiddleware(handlers.CloneContest)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}/virtual", middleware.AuthMiddleware(handlers.StartVirtualParticipation)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}/virtual", middleware.AuthMiddleware(handlers.GetVirtualParticipation)).Methods("GET")
+	api.HandleFunc("/contest/{id:[0-9]+}/upsolve", middleware.AuthMiddleware(handlers.GetUpsolve)).Methods("GET")
+	api.HandleFunc("/contest/{id:[0-9]+}/finalize", middleware.AuthMiddleware(handlers.FinalizeContest)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}/rejudge", middleware.AuthMiddleware(handlers.RejudgeContest)).Methods("POST")
+
+	// Announcement and clarification routes
+	api.HandleFunc("/contest/{id:[0-9]+}/announcements", handlers.GetAnnouncements).Methods("GET")
+	api.HandleFunc("/contest/{id:[0-9]+}/announcements", middleware.AuthMiddleware(handlers.CreateAnnouncement)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}/clarifications", middleware.AuthMiddleware(handlers.GetClarifications)).Methods("GET")
+	api.HandleFunc("/contest/{id:[0-9]+}/clarifications", middleware.AuthMiddleware(handlers.CreateClarification)).Methods("POST")
+	api.HandleFunc("/clarification/{id:[0-9]+}/answer", middleware.AuthMiddleware(handlers.AnswerClarification)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}/messages/unread", middleware.AuthMiddleware(handlers.GetUnreadMessages)).Methods("GET")
+	api.HandleFunc("/contest/{id:[0-9]+}/messages/read", middleware.AuthMiddleware(handlers.MarkMessagesRead)).Methods("POST")
 
 	// Problem routes
 	api.HandleFunc("/problems", middleware.AuthMiddleware(handlers.GetContestProblems)).Methods("GET")
 	api.HandleFunc("/problem/{id:[0-9]+}", handlers.GetProblem).Methods("GET")
 	api.HandleFunc("/problems", middleware.AuthMiddleware(handlers.CreateProblem)).Methods("POST")
+	api.HandleFunc("/problem/{id:[0-9]+}", middleware.AuthMiddleware(handlers.UpdateProblem)).Methods("PUT", "PATCH")
+	api.HandleFunc("/problem/{id:[0-9]+}", middleware.AuthMiddleware(handlers.DeleteProblem)).Methods("DELETE")
+	api.HandleFunc("/problem/{id:[0-9]+}/versions", middleware.AuthMiddleware(handlers.GetProblemVersions)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/versions/{version:[0-9]+}", middleware.AuthMiddleware(handlers.GetProblemVersion)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/programs", middleware.AuthMiddleware(handlers.GetProblemPrograms)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/programs", middleware.AuthMiddleware(handlers.CreateProblemProgram)).Methods("POST")
+	api.HandleFunc("/problem/{id:[0-9]+}/programs/{program_id:[0-9]+}", middleware.AuthMiddleware(handlers.DeleteProblemProgram)).Methods("DELETE")
+	api.HandleFunc("/problem/{id:[0-9]+}/verify", middleware.AuthMiddleware(handlers.VerifyProblem)).Methods("POST")
+	api.HandleFunc("/problem/{id:[0-9]+}/verifications", middleware.AuthMiddleware(handlers.GetProblemVerifications)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/verifications/{verification_id:[0-9]+}", middleware.AuthMiddleware(handlers.GetProblemVerification)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/generation-script", middleware.AuthMiddleware(handlers.GetGenerationScript)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/generation-script", middleware.AuthMiddleware(handlers.SetGenerationScript)).Methods("PUT")
+	api.HandleFunc("/problem/{id:[0-9]+}/generate", middleware.AuthMiddleware(handlers.GenerateTestcases)).Methods("POST")
+	api.HandleFunc("/problem/{id:[0-9]+}/generations", middleware.AuthMiddleware(handlers.GetProblemGenerations)).Methods("GET")
+	api.HandleFunc("/problem/{id:[0-9]+}/generations/{generation_id:[0-9]+}", middleware.AuthMiddleware(handlers.GetProblemGeneration)).Methods("GET")
+	api.HandleFunc("/problems/import", middleware.AuthMiddleware(handlers.ImportProblem)).Methods("POST")
+	api.HandleFunc("/problem/{id:[0-9]+}/rejudge", middleware.AuthMiddleware(handlers.RejudgeProblem)).Methods("POST")
+	api.HandleFunc("/problem/{id:[0-9]+}/export", middleware.AuthMiddleware(handlers.ExportProblem)).Methods("GET")
+	api.HandleFunc("/archive/problems", handlers.GetArchiveProblems).Methods("GET")
+	api.HandleFunc("/contest/{id:[0-9]+}/problems", middleware.AuthMiddleware(handlers.AttachContestProblem)).Methods("POST")
+	api.HandleFunc("/contest/{id:[0-9]+}/problems/{problem_id:[0-9]+}", middleware.AuthMiddleware(handlers.UpdateContestProblem)).Methods("PUT", "PATCH")
+	api.HandleFunc("/contest/{id:[0-9]+}/problems/{problem_id:[0-9]+}", middleware.AuthMiddleware(handlers.DetachContestProblem)).Methods("DELETE")
 
 	// Testcase routes (admin)
 	api.HandleFunc("/testcases", middleware.AuthMiddleware(handlers.CreateTestcase)).Methods("POST")
 	api.HandleFunc("/testcases", handlers.GetTestcases).Methods("GET")
+	api.HandleFunc("/testcases/{id:[0-9]+}", middleware.AuthMiddleware(handlers.DeleteTestcase)).Methods("DELETE")
+	api.HandleFunc("/problem/{id:[0-9]+}/testcases/upload", middleware.AuthMiddleware(handlers.UploadTestcases)).Methods("POST")
 
 	// Submission routes
 	api.HandleFunc("/submission", middleware.AuthMiddleware(handlers.SubmitCode)).Methods("POST")
 	api.HandleFunc("/submission/{id:[0-9]+}", handlers.GetSubmission).Methods("GET")
+	api.HandleFunc("/submission/{id:[0-9]+}/rejudge", middleware.AuthMiddleware(handlers.RejudgeSubmission)).Methods("POST")
 	api.HandleFunc("/submissions", middleware.AuthMiddleware(handlers.GetUserSubmissions)).Methods("GET")
+	api.HandleFunc("/languages", handlers.GetLanguages).Methods("GET")
+	api.HandleFunc("/judge0/callback", handlers.Judge0Callback).Methods("PUT", "POST")
+	api.HandleFunc("/judge/health", middleware.AuthMiddleware(handlers.GetJudgeHealth)).Methods("GET")
 
 	// Leaderboard routes
 	api.HandleFunc("/leaderboard/{contest_id:[0-9]+}", handlers.GetLeaderboard).Methods("GET")
+	api.HandleFunc("/leaderboard/{contest_id:[0-9]+}/virtual", handlers.GetVirtualLeaderboard).Methods("GET")
+
+	// Rating routes
+	api.HandleFunc("/ratings", handlers.GetRatings).Methods("GET")
+	api.HandleFunc("/users/{id:[0-9]+}/rating-history", handlers.GetRatingHistory).Methods("GET")
+
+	// Live update streams (Server-Sent Events)
+	api.HandleFunc("/events/submissions", middleware.StreamAuthMiddleware(handlers.StreamSubmissions)).Methods("GET")
+	api.HandleFunc("/events/contest/{contest_id:[0-9]+}", handlers.StreamContest).Methods("GET")
 
 	/*// User routes (admin only)
 	api.HandleFunc("/users", middleware.AdminMiddleware(handlers.GetUsers)).Methods("GET")
@@ -81,7 +168,7 @@ func main() {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
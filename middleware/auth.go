@@ -37,6 +37,21 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// StreamAuthMiddleware validates JWT tokens for Server-Sent Event streams.
+// Browsers' EventSource cannot set headers, so the token may also be passed
+// as the "token" query parameter.
+func StreamAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	auth := AuthMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if token := r.URL.Query().Get("token"); token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		auth(w, r)
+	}
+}
+
 // AdminMiddleware checks if user is admin (for MVP, we'll use created_by check)
 func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
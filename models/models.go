@@ -8,62 +8,364 @@ type User struct {
 	Name         string    `json:"name" db:"name"`
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	IsAdmin      bool      `json:"is_admin" db:"is_admin"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
 // Contest represents a programming contest
 type Contest struct {
-	ID        int       `json:"id" db:"id"`
-	Title     string    `json:"title" db:"title"`
-	StartTime time.Time `json:"start_time" db:"start_time"`
-	EndTime   time.Time `json:"end_time" db:"end_time"`
-	CreatedBy int       `json:"created_by" db:"created_by"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID               int        `json:"id" db:"id"`
+	Title            string     `json:"title" db:"title"`
+	StartTime        time.Time  `json:"start_time" db:"start_time"`
+	EndTime          time.Time  `json:"end_time" db:"end_time"`
+	CreatedBy        int        `json:"created_by" db:"created_by"`
+	IsDraft          bool       `json:"is_draft" db:"is_draft"`
+	IsRated          bool       `json:"is_rated" db:"is_rated"`
+	FinalizedAt      *time.Time `json:"finalized_at" db:"finalized_at"`
+	AllowedLanguages []string   `json:"allowed_languages" db:"allowed_languages"` // nil allows every language
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+
+	Announcements []Announcement `json:"announcements,omitempty"`
 }
 
 // Problem represents a problem in a contest
 type Problem struct {
-	ID          int       `json:"id" db:"id"`
-	ContestID   int       `json:"contest_id" db:"contest_id"`
-	Title       string    `json:"title" db:"title"`
-	Statement   string    `json:"statement" db:"statement"`
-	TimeLimit   int       `json:"time_limit" db:"time_limit"`   // milliseconds
-	MemoryLimit int       `json:"memory_limit" db:"memory_limit"` // MB
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID            int               `json:"id" db:"id"`
+	ContestID     int               `json:"contest_id,omitempty" db:"contest_id"` // set when listed as part of a contest
+	Label         string            `json:"label,omitempty" db:"label"`
+	Points        int               `json:"points,omitempty" db:"points"`
+	Position      int               `json:"position" db:"position"`
+	Title         string            `json:"title" db:"title"`
+	Statement     string            `json:"statement" db:"statement"`
+	TimeLimit     int               `json:"time_limit" db:"time_limit"`     // milliseconds
+	MemoryLimit   int               `json:"memory_limit" db:"memory_limit"` // MB
+	IsPublic      bool              `json:"is_public" db:"is_public"`
+	JudgingPolicy string            `json:"judging_policy" db:"judging_policy"` // stop_at_first_failure or run_all
+	Version       int               `json:"version" db:"version"`
+	Interactive   bool              `json:"interactive"`         // the current version has an interactor
+	Languages     []string          `json:"languages,omitempty"` // for function-style problems, the languages with a grader
+	Templates     map[string]string `json:"templates,omitempty"` // signature templates by language
+	CreatedBy     *int              `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+}
+
+// ProblemVersion represents a snapshot of a problem's statement, limits and testcase set
+type ProblemVersion struct {
+	ProblemID     int       `json:"problem_id" db:"problem_id"`
+	Version       int       `json:"version" db:"version"`
+	Title         string    `json:"title" db:"title"`
+	Statement     string    `json:"statement,omitempty" db:"statement"`
+	TimeLimit     int       `json:"time_limit" db:"time_limit"`
+	MemoryLimit   int       `json:"memory_limit" db:"memory_limit"`
+	JudgingPolicy string    `json:"judging_policy" db:"judging_policy"`
+	TestcaseCount int       `json:"testcase_count"`
+	Current       bool      `json:"current"`
+	CreatedBy     *int      `json:"created_by" db:"created_by"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// ProblemProgram represents a program or support file that comes with a problem
+type ProblemProgram struct {
+	ID               int       `json:"id" db:"id"`
+	ProblemID        int       `json:"problem_id" db:"problem_id"`
+	Role             string    `json:"role" db:"role"` // checker, validator, solution, generator, script or resource
+	Name             string    `json:"name" db:"name"`
+	Language         string    `json:"language,omitempty" db:"language"`                 // empty for resources
+	Kind             string    `json:"kind,omitempty" db:"kind"`                         // checker/validator protocol: testlib or kattis
+	ExpectedVerdict  string    `json:"expected_verdict,omitempty" db:"expected_verdict"` // for solutions
+	SourceHash       string    `json:"source_hash" db:"source_hash"`
+	SourceSize       int64     `json:"source_size" db:"source_size"`
+	Source           string    `json:"source,omitempty"`
+	AddedInVersion   int       `json:"added_in_version" db:"added_in_version"`
+	RemovedInVersion *int      `json:"removed_in_version,omitempty" db:"removed_in_version"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// ProblemVerification represents a run of a problem's validator and
+// reference solutions over its testcases
+type ProblemVerification struct {
+	ID             int                 `json:"id" db:"id"`
+	ProblemID      int                 `json:"problem_id" db:"problem_id"`
+	ProblemVersion int                 `json:"problem_version" db:"problem_version"`
+	Status         string              `json:"status" db:"status"` // running, passed, failed or error
+	Report         *VerificationReport `json:"report,omitempty"`
+	CreatedBy      *int                `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
+	FinishedAt     *time.Time          `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// VerificationReport lists what a verification found
+type VerificationReport struct {
+	Validator *ValidatorReport `json:"validator,omitempty"`
+	Solutions []SolutionReport `json:"solutions"`
+	Errors    []string         `json:"errors,omitempty"`
+}
+
+// ValidatorReport lists the testcases the input validator rejected
+type ValidatorReport struct {
+	Name    string         `json:"name"`
+	Checked int            `json:"checked"`
+	Invalid []InvalidInput `json:"invalid"`
+}
+
+// InvalidInput is a testcase whose input failed validation
+type InvalidInput struct {
+	TestcaseID int    `json:"testcase_id"`
+	Message    string `json:"message"`
+}
+
+// SolutionReport is the outcome of one reference solution
+type SolutionReport struct {
+	ProgramID       int                  `json:"program_id"`
+	Name            string               `json:"name"`
+	Language        string               `json:"language"`
+	ExpectedVerdict string               `json:"expected_verdict"`
+	Verdict         string               `json:"verdict"` // first verdict other than accepted, if any
+	MaxRuntime      int                  `json:"max_runtime"`
+	MaxMemory       int                  `json:"max_memory"` // kilobytes
+	Matches         bool                 `json:"matches"`
+	Tests           []SolutionTestResult `json:"tests"`
+}
+
+// SolutionTestResult is a reference solution's verdict on one testcase
+type SolutionTestResult struct {
+	TestcaseID int    `json:"testcase_id"`
+	Verdict    string `json:"verdict"`
+	Runtime    int    `json:"runtime"`
+	Memory     int    `json:"memory"` // kilobytes
+	Error      string `json:"error,omitempty"`
+}
+
+// GenerationScript lists the generator invocations that produce a problem's generated testcases
+type GenerationScript struct {
+	Tests []GeneratorInvocation `json:"tests"`
+}
+
+// GeneratorInvocation produces one testcase input
+type GeneratorInvocation struct {
+	Generator string   `json:"generator"` // generator program name, with or without extension
+	Args      []string `json:"args"`
+	Seed      int64    `json:"seed"` // passed in $SEED; defaults to the test's position
+	Sample    bool     `json:"sample"`
+}
+
+// ProblemGeneration represents a run of a problem's generation script
+type ProblemGeneration struct {
+	ID             int        `json:"id" db:"id"`
+	ProblemID      int        `json:"problem_id" db:"problem_id"`
+	Status         string     `json:"status" db:"status"` // running, done or failed
+	Message        string     `json:"message,omitempty" db:"message"`
+	ProblemVersion *int       `json:"problem_version,omitempty" db:"problem_version"` // version the testcases went to
+	Added          int        `json:"added" db:"added"`
+	Removed        int        `json:"removed" db:"removed"`
+	CreatedBy      *int       `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// ContestProblem represents a problem's place in a contest
+type ContestProblem struct {
+	ContestID int    `json:"contest_id" db:"contest_id"`
+	ProblemID int    `json:"problem_id" db:"problem_id"`
+	Label     string `json:"label" db:"label"`
+	Points    int    `json:"points" db:"points"`
+	Position  int    `json:"position" db:"position"`
 }
 
 // Testcase represents a test case for a problem
 type Testcase struct {
-	ID            int    `json:"id" db:"id"`
-	ProblemID     int    `json:"problem_id" db:"problem_id"`
-	Input         string `json:"input" db:"input"`
-	ExpectedOutput string `json:"expected_output" db:"expected_output"`
-	IsSample      bool   `json:"is_sample" db:"is_sample"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	ID               int       `json:"id" db:"id"`
+	ProblemID        int       `json:"problem_id" db:"problem_id"`
+	Input            string    `json:"input" db:"input"`
+	ExpectedOutput   string    `json:"expected_output" db:"expected_output"`
+	IsSample         bool      `json:"is_sample" db:"is_sample"`
+	InputHash        string    `json:"input_hash,omitempty" db:"input_hash"`   // blob holding the input; empty for inline rows
+	OutputHash       string    `json:"output_hash,omitempty" db:"output_hash"` // blob holding the expected output
+	InputSize        int64     `json:"input_size" db:"input_size"`
+	OutputSize       int64     `json:"output_size" db:"output_size"`
+	AddedInVersion   int       `json:"added_in_version" db:"added_in_version"`
+	RemovedInVersion *int      `json:"removed_in_version,omitempty" db:"removed_in_version"`
+	GeneratedBy      string    `json:"generated_by,omitempty" db:"generated_by"` // generator invocation, for generated testcases
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 }
 
 // Submission represents a code submission
 type Submission struct {
-	ID          int       `json:"id" db:"id"`
-	UserID      int       `json:"user_id" db:"user_id"`
-	ProblemID   int       `json:"problem_id" db:"problem_id"`
-	ContestID   int       `json:"contest_id" db:"contest_id"`
-	Language    string    `json:"language" db:"language"`
-	Code        string    `json:"code" db:"code"`
-	Status      string    `json:"status" db:"status"`
-	Score       int       `json:"score" db:"score"`
-	Runtime     int       `json:"runtime" db:"runtime"` // milliseconds
-	Judge0Token string    `json:"judge0_token" db:"judge0_token"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID           int       `json:"id" db:"id"`
+	UserID       int       `json:"user_id" db:"user_id"`
+	ProblemID    int       `json:"problem_id" db:"problem_id"`
+	ContestID    int       `json:"contest_id" db:"contest_id"`
+	Language     string    `json:"language" db:"language"`
+	Code         string    `json:"code" db:"code"`
+	Status       string    `json:"status" db:"status"`
+	StatusDetail string    `json:"status_detail,omitempty" db:"status_detail"` // e.g. the signal of a runtime error
+	Score        int       `json:"score" db:"score"`
+	Runtime      int       `json:"runtime" db:"runtime"` // milliseconds
+	Memory       int       `json:"memory" db:"memory"`   // peak, kilobytes
+	Judge0Token  string    `json:"judge0_token" db:"judge0_token"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+
+	VirtualParticipationID *int `json:"virtual_participation_id,omitempty" db:"virtual_participation_id"`
+	IsPractice             bool `json:"is_practice" db:"is_practice"` // submitted after the contest ended
+	ProblemVersion         *int `json:"problem_version" db:"problem_version"`
+
+	Results []SubmissionResult  `json:"results,omitempty"` // per testcase, in testcase order
+	History []SubmissionVerdict `json:"history,omitempty"` // verdicts replaced by rejudges, oldest first
+}
+
+// SubmissionResult is a submission's verdict on one testcase
+type SubmissionResult struct {
+	Position     int    `json:"position" db:"position"` // 1-based, in testcase order
+	TestcaseID   *int   `json:"testcase_id" db:"testcase_id"`
+	Status       string `json:"status" db:"status"`
+	StatusDetail string `json:"status_detail,omitempty" db:"status_detail"`
+	Runtime      int    `json:"runtime" db:"runtime"` // milliseconds
+	Memory       int    `json:"memory" db:"memory"`   // peak, kilobytes
+}
+
+// SubmissionVerdict is a verdict a submission had before it was rejudged
+type SubmissionVerdict struct {
+	ID             int       `json:"id" db:"id"`
+	SubmissionID   int       `json:"submission_id" db:"submission_id"`
+	RejudgeID      *int      `json:"rejudge_id" db:"rejudge_id"`
+	Status         string    `json:"status" db:"status"`
+	StatusDetail   string    `json:"status_detail,omitempty" db:"status_detail"`
+	Score          int       `json:"score" db:"score"`
+	Runtime        int       `json:"runtime" db:"runtime"`
+	Memory         int       `json:"memory" db:"memory"`
+	ProblemVersion *int      `json:"problem_version" db:"problem_version"`
+	ReplacedAt     time.Time `json:"replaced_at" db:"replaced_at"`
+}
+
+// Rejudge represents a rejudge of one submission, or of a problem's or a
+// contest's submissions
+type Rejudge struct {
+	ID              int       `json:"id" db:"id"`
+	SubmissionID    *int      `json:"submission_id,omitempty" db:"submission_id"`
+	ProblemID       *int      `json:"problem_id,omitempty" db:"problem_id"`
+	ContestID       *int      `json:"contest_id,omitempty" db:"contest_id"`
+	Statuses        []string  `json:"statuses" db:"statuses"`
+	SubmissionCount int       `json:"submission_count" db:"submission_count"`
+	SubmissionIDs   []int     `json:"submission_ids"`
+	CreatedBy       int       `json:"created_by" db:"created_by"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// VirtualParticipation represents a user taking an ended contest on their own timer
+type VirtualParticipation struct {
+	ID        int       `json:"id" db:"id"`
+	ContestID int       `json:"contest_id" db:"contest_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	StartedAt time.Time `json:"started_at" db:"started_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Active    bool      `json:"active"`
+}
+
+// UpsolveProblem represents a user's progress on a contest problem, split
+// between the contest itself, virtual participations and practice after it
+// ended
+type UpsolveProblem struct {
+	ProblemID       int        `json:"problem_id"`
+	Label           string     `json:"label"`
+	Title           string     `json:"title"`
+	SolvedInContest bool       `json:"solved_in_contest"` // live, during the contest
+	SolvedVirtually bool       `json:"solved_virtually"`  // during a virtual participation
+	Upsolved        bool       `json:"upsolved"`          // first solved in practice after the contest
+	Attempts        int        `json:"attempts"`          // practice submissions
+	UpsolvedAt      *time.Time `json:"upsolved_at,omitempty"`
+}
+
+// UpsolveView represents which problems of a contest a user solved after it ended
+type UpsolveView struct {
+	ContestID          int              `json:"contest_id"`
+	UserID             int              `json:"user_id"`
+	SolvedCount        int              `json:"solved_count"`
+	VirtualSolvedCount int              `json:"virtual_solved_count"` // solved virtually but not in the contest
+	UpsolvedCount      int              `json:"upsolved_count"`
+	Problems           []UpsolveProblem `json:"problems"`
 }
 
 // LeaderboardEntry represents a leaderboard entry
 type LeaderboardEntry struct {
-	UserID            int       `json:"user_id" db:"user_id"`
-	UserName          string    `json:"user_name" db:"user_name"`
-	SolvedCount       int       `json:"solved_count" db:"solved_count"`
-	Penalty           int       `json:"penalty" db:"penalty"`
-	LastSubmissionTime *time.Time `json:"last_submission_time" db:"last_submission_time"`
+	UserID             int               `json:"user_id" db:"user_id"`
+	UserName           string            `json:"user_name" db:"user_name"`
+	SolvedCount        int               `json:"solved_count" db:"solved_count"`
+	Penalty            int               `json:"penalty" db:"penalty"`
+	LastSubmissionTime *time.Time        `json:"last_submission_time" db:"last_submission_time"`
+	Problems           []LeaderboardCell `json:"problems"`
+	IsVirtual          bool              `json:"is_virtual,omitempty"`
+}
+
+// LeaderboardCell represents a user's state on a single problem of a contest
+type LeaderboardCell struct {
+	ProblemID    int        `json:"problem_id"`
+	Solved       bool       `json:"solved"`
+	Attempts     int        `json:"attempts"` // submissions up to and including the first accepted one
+	SolvedAt     *time.Time `json:"solved_at,omitempty"`
+	SolveMinute  int        `json:"solve_minute"` // minutes from contest start to the first accepted submission
+	Pending      bool       `json:"pending"`
+	FirstToSolve bool       `json:"first_to_solve"`
+
+	AcceptedSubmissionID int `json:"-"` // breaks first-to-solve ties between equal solve times
+}
+
+// LeaderboardProblemSummary represents the per-problem summary row of a leaderboard
+type LeaderboardProblemSummary struct {
+	ProblemID     int    `json:"problem_id"`
+	Label         string `json:"label"`
+	Title         string `json:"title"`
+	Attempts      int    `json:"attempts"`
+	AcceptedCount int    `json:"accepted_count"`
+}
+
+// Leaderboard represents the full standings of a contest
+type Leaderboard struct {
+	ContestID int                         `json:"contest_id"`
+	Problems  []LeaderboardProblemSummary `json:"problems"`
+	Entries   []LeaderboardEntry          `json:"entries"`
+}
+
+// Clarification represents a participant's question about a contest and its answer
+type Clarification struct {
+	ID         int        `json:"id" db:"id"`
+	ContestID  int        `json:"contest_id" db:"contest_id"`
+	ProblemID  *int       `json:"problem_id" db:"problem_id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	UserName   string     `json:"user_name,omitempty"`
+	Question   string     `json:"question" db:"question"`
+	Answer     *string    `json:"answer" db:"answer"`
+	IsPublic   bool       `json:"is_public" db:"is_public"`
+	AnsweredAt *time.Time `json:"answered_at" db:"answered_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Announcement represents a message broadcast to all participants of a contest
+type Announcement struct {
+	ID        int       `json:"id" db:"id"`
+	ContestID int       `json:"contest_id" db:"contest_id"`
+	ProblemID *int      `json:"problem_id" db:"problem_id"`
+	Message   string    `json:"message" db:"message"`
+	CreatedBy int       `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// RatingChange represents a user's rating change from one contest
+type RatingChange struct {
+	ContestID    int       `json:"contest_id" db:"contest_id"`
+	ContestTitle string    `json:"contest_title"`
+	Rank         float64   `json:"rank" db:"rank"`
+	OldRating    int       `json:"old_rating" db:"old_rating"`
+	NewRating    int       `json:"new_rating" db:"new_rating"`
+	Delta        int       `json:"delta" db:"delta"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// RatingEntry represents a user's row in the global ratings leaderboard
+type RatingEntry struct {
+	UserID       int    `json:"user_id"`
+	UserName     string `json:"user_name"`
+	Rating       int    `json:"rating"`
+	ContestCount int    `json:"contest_count"`
 }
 
 // LoginRequest represents a login request
@@ -81,18 +383,86 @@ type SignupRequest struct {
 
 // CreateContestRequest represents a request to create a contest
 type CreateContestRequest struct {
-	Title     string    `json:"title"`
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
+	Title            string    `json:"title"`
+	StartTime        time.Time `json:"start_time"`
+	EndTime          time.Time `json:"end_time"`
+	IsDraft          bool      `json:"is_draft"`
+	IsRated          bool      `json:"is_rated"`
+	AllowedLanguages []string  `json:"allowed_languages"` // empty allows every language
+}
+
+// UpdateContestRequest represents a request to update a contest.
+// Omitted fields are left unchanged by PATCH and required by PUT.
+type UpdateContestRequest struct {
+	Title            *string    `json:"title"`
+	StartTime        *time.Time `json:"start_time"`
+	EndTime          *time.Time `json:"end_time"`
+	IsDraft          *bool      `json:"is_draft"`
+	IsRated          *bool      `json:"is_rated"`
+	AllowedLanguages *[]string  `json:"allowed_languages"` // an empty list allows every language
+}
+
+// CloneContestRequest represents a request to clone a contest into a new draft.
+// Omitted fields default to those of the source contest.
+type CloneContestRequest struct {
+	Title     string     `json:"title"`
+	StartTime *time.Time `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
 }
 
 // CreateProblemRequest represents a request to create a problem
 type CreateProblemRequest struct {
-	ContestID   int    `json:"contest_id"`
-	Title       string `json:"title"`
-	Statement   string `json:"statement"`
-	TimeLimit   int    `json:"time_limit"`
-	MemoryLimit int    `json:"memory_limit"`
+	ContestID     int    `json:"contest_id"` // optional; attaches the new problem to this contest
+	Label         string `json:"label"`
+	Points        *int   `json:"points"` // defaults to 100
+	Title         string `json:"title"`
+	Statement     string `json:"statement"`
+	TimeLimit     int    `json:"time_limit"`
+	MemoryLimit   int    `json:"memory_limit"`
+	IsPublic      bool   `json:"is_public"`
+	JudgingPolicy string `json:"judging_policy"` // default stop_at_first_failure
+}
+
+// UpdateProblemRequest represents a partial update of a library problem
+type UpdateProblemRequest struct {
+	Title         *string `json:"title"`
+	Statement     *string `json:"statement"`
+	TimeLimit     *int    `json:"time_limit"`
+	MemoryLimit   *int    `json:"memory_limit"`
+	IsPublic      *bool   `json:"is_public"`
+	JudgingPolicy *string `json:"judging_policy"`
+}
+
+// CreateProgramRequest represents a request to add a program to a problem
+type CreateProgramRequest struct {
+	Role            string `json:"role"` // checker, validator, solution, generator or resource
+	Name            string `json:"name"`
+	Language        string `json:"language"`         // required for programs: c, cpp or python3
+	Kind            string `json:"kind"`             // checker/validator protocol; defaults to testlib
+	ExpectedVerdict string `json:"expected_verdict"` // for solutions; defaults to accepted
+	Source          string `json:"source"`
+}
+
+// GenerateTestcasesRequest represents a request to run a problem's generation script
+type GenerateTestcasesRequest struct {
+	Solution string `json:"solution"` // reference solution producing the answers; defaults to the first accepted one
+	Replace  bool   `json:"replace"`  // remove previously generated testcases first
+}
+
+// AttachProblemRequest represents a request to add a library problem to a contest
+type AttachProblemRequest struct {
+	ProblemID int    `json:"problem_id"`
+	Label     string `json:"label"`    // defaults to the next free letter
+	Points    *int   `json:"points"`   // defaults to 100
+	Position  *int   `json:"position"` // defaults to the end
+}
+
+// UpdateContestProblemRequest represents a partial update of a problem's
+// label, points or position within a contest
+type UpdateContestProblemRequest struct {
+	Label    *string `json:"label"`
+	Points   *int    `json:"points"`
+	Position *int    `json:"position"`
 }
 
 // SubmitCodeRequest represents a code submission request
@@ -103,3 +473,26 @@ type SubmitCodeRequest struct {
 	Code      string `json:"code"`
 }
 
+// RejudgeRequest narrows a rejudge of a problem's or a contest's submissions
+type RejudgeRequest struct {
+	Statuses  []string `json:"statuses"`   // verdicts to rejudge; defaults to every verdict
+	ProblemID int      `json:"problem_id"` // for contest rejudges, only this problem
+}
+
+// CreateClarificationRequest represents a participant's question
+type CreateClarificationRequest struct {
+	ProblemID *int   `json:"problem_id"`
+	Question  string `json:"question"`
+}
+
+// AnswerClarificationRequest represents a judge's answer to a clarification
+type AnswerClarificationRequest struct {
+	Answer    string `json:"answer"`
+	Broadcast bool   `json:"broadcast"` // make question and answer visible to all participants
+}
+
+// CreateAnnouncementRequest represents a request to post a contest announcement
+type CreateAnnouncementRequest struct {
+	ProblemID *int   `json:"problem_id"`
+	Message   string `json:"message"`
+}
@@ -0,0 +1,232 @@
+package problempkg
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kattisStatementFiles are the statement files tried, in order of preference
+var kattisStatementFiles = []string{
+	"statement/problem.en.md", "problem_statement/problem.en.md", "problem_statement/problem.md",
+	"statement/problem.en.tex", "problem_statement/problem.en.tex", "problem_statement/problem.tex",
+}
+
+var problemNamePattern = regexp.MustCompile(`\\problemname\{([^}]*)\}`)
+
+// readKattis reads a package in the Kattis/ICPC problem package layout:
+// problem.yaml, problem_statement/, data/sample, data/secret and
+// output_validators/
+func readKattis(archive *zip.Reader, root string) (*Package, error) {
+	files := archiveFiles(archive, root)
+	meta, err := readSmall(files["problem.yaml"])
+	if err != nil {
+		return nil, err
+	}
+	doc := parseYAML(string(meta))
+
+	pkg := &Package{ShortName: path.Base(root), TimeLimit: 1000, MemoryLimit: 256}
+	if pkg.ShortName == "." || pkg.ShortName == "" {
+		pkg.ShortName = "problem"
+	}
+
+	validation := yamlString(doc, "validation") + " " + yamlString(doc, "type")
+	if strings.Contains(validation, "interactive") {
+		return nil, fmt.Errorf("interactive problems are not supported")
+	}
+
+	// Limits: limits.time_limit in seconds, or the .timelimit file DOMjudge uses
+	if tl := yamlString(doc, "limits", "time_limit"); tl != "" {
+		if seconds, err := strconv.ParseFloat(tl, 64); err == nil && seconds > 0 {
+			pkg.TimeLimit = int(math.Round(seconds * 1000))
+		}
+	} else if f, ok := files[".timelimit"]; ok {
+		if data, err := readSmall(f); err == nil {
+			if seconds, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64); err == nil && seconds > 0 {
+				pkg.TimeLimit = int(math.Round(seconds * 1000))
+			}
+		}
+	}
+	if mem := yamlString(doc, "limits", "memory"); mem != "" {
+		if mb, err := strconv.Atoi(mem); err == nil && mb > 0 {
+			pkg.MemoryLimit = mb
+		}
+	}
+
+	for _, name := range kattisStatementFiles {
+		if f, ok := files[name]; ok {
+			data, err := readSmall(f)
+			if err != nil {
+				return nil, err
+			}
+			pkg.Statement = string(data)
+			if m := problemNamePattern.FindStringSubmatch(pkg.Statement); m != nil {
+				pkg.Title = m[1]
+			}
+			break
+		}
+	}
+
+	// name is a plain string or a map of languages
+	if name := yamlString(doc, "name"); name != "" {
+		pkg.Title = name
+	} else if name := yamlString(doc, "name", "en"); name != "" {
+		pkg.Title = name
+	}
+	if pkg.Title == "" {
+		pkg.Title = pkg.ShortName
+	}
+	if pkg.Statement == "" {
+		return nil, fmt.Errorf("package has no problem statement")
+	}
+
+	if pkg.Tests, err = kattisTests(files); err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(validation, "custom") {
+		if err := readKattisValidator(pkg, files); err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
+
+// kattisTests pairs the .in and .ans files under data/sample and data/secret
+func kattisTests(files map[string]*zip.File) ([]Test, error) {
+	var tests []Test
+	for _, group := range []string{"data/sample/", "data/secret/"} {
+		var names []string
+		for name := range files {
+			if strings.HasPrefix(name, group) && strings.HasSuffix(name, ".in") {
+				names = append(names, name)
+			}
+		}
+		sort.Slice(names, func(i, j int) bool { return NaturalLess(names[i], names[j]) })
+		for _, name := range names {
+			base := strings.TrimSuffix(name, ".in")
+			answer, ok := files[base+".ans"]
+			if !ok {
+				return nil, fmt.Errorf("test %s has no .ans file", base)
+			}
+			tests = append(tests, Test{
+				Name:     strings.TrimPrefix(base, "data/"),
+				IsSample: group == "data/sample/",
+				Input:    opener(files[name]),
+				Answer:   opener(answer),
+			})
+		}
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("package has no tests under data/sample or data/secret")
+	}
+	return tests, nil
+}
+
+// readKattisValidator reads the custom output validator: the source with a
+// main function, the other files of its directory becoming support files
+func readKattisValidator(pkg *Package, files map[string]*zip.File) error {
+	var dir string
+	var names []string
+	for name := range files {
+		for _, prefix := range []string{"output_validators/", "output_validator/"} {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+				if dir == "" || len(path.Dir(name)) < len(dir) {
+					dir = path.Dir(name)
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("package uses custom validation but has no output validator")
+	}
+	sort.Strings(names)
+
+	var main *Program
+	for _, name := range names {
+		if path.Dir(name) != dir {
+			continue
+		}
+		data, err := readSmall(files[name])
+		if err != nil {
+			return err
+		}
+		language := LanguageFromExt(name)
+		if main == nil && language != "" && hasMain(data) {
+			main = &Program{Name: path.Base(name), Language: language, Kind: CheckerKattis, Source: data}
+			continue
+		}
+		pkg.Resources = append(pkg.Resources, File{Name: path.Base(name), Data: data})
+	}
+	if main == nil {
+		return fmt.Errorf("no C, C++ or Python output validator found in %s", dir)
+	}
+	pkg.Checker = main
+	return nil
+}
+
+var mainPattern = regexp.MustCompile(`\bmain\s*\(|__name__`)
+
+// hasMain reports whether a source file looks like a program entry point
+func hasMain(source []byte) bool {
+	return mainPattern.Match(source)
+}
+
+// writeKattis writes a package in the Kattis/ICPC layout
+func writeKattis(w io.Writer, pkg *Package) error {
+	zw := zip.NewWriter(w)
+
+	var meta strings.Builder
+	fmt.Fprintf(&meta, "name: %s\n", quoteYAML(pkg.Title))
+	meta.WriteString("source: codesprint\n")
+	if pkg.Checker != nil {
+		meta.WriteString("validation: custom\n")
+	}
+	meta.WriteString("limits:\n")
+	fmt.Fprintf(&meta, "  time_limit: %s\n", strconv.FormatFloat(float64(pkg.TimeLimit)/1000, 'f', -1, 64))
+	fmt.Fprintf(&meta, "  memory: %d\n", pkg.MemoryLimit)
+	if err := writeFile(zw, "problem.yaml", []byte(meta.String())); err != nil {
+		return err
+	}
+	if err := writeFile(zw, "problem_statement/problem.en.md", []byte(pkg.Statement)); err != nil {
+		return err
+	}
+
+	samples, secrets := 0, 0
+	for _, test := range pkg.Tests {
+		var base string
+		if test.IsSample {
+			samples++
+			base = fmt.Sprintf("data/sample/%02d", samples)
+		} else {
+			secrets++
+			base = fmt.Sprintf("data/secret/%02d", secrets)
+		}
+		if err := copyFile(zw, base+".in", test.Input); err != nil {
+			return err
+		}
+		if err := copyFile(zw, base+".ans", test.Answer); err != nil {
+			return err
+		}
+	}
+
+	if pkg.Checker != nil {
+		dir := "output_validators/checker/"
+		if err := writeFile(zw, dir+"validate"+sourceExt(pkg.Checker.Language), pkg.Checker.Source); err != nil {
+			return err
+		}
+		for _, f := range pkg.Resources {
+			if err := writeFile(zw, dir+f.Name, f.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,38 @@
+package problempkg
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NaturalLess orders names so that embedded numbers compare by value (2 before 10)
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ra, rb := rune(a[0]), rune(b[0])
+		if unicode.IsDigit(ra) && unicode.IsDigit(rb) {
+			na, restA := leadingNumber(a)
+			nb, restB := leadingNumber(b)
+			if na != nb {
+				return na < nb
+			}
+			a, b = restA, restB
+			continue
+		}
+		if ra != rb {
+			return ra < rb
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// leadingNumber splits the leading run of digits off s
+func leadingNumber(s string) (uint64, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.ParseUint(strings.TrimLeft(s[:i], "0"), 10, 64)
+	return n, s[i:]
+}
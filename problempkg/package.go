@@ -0,0 +1,212 @@
+// Package problempkg reads and writes problem packages in the Kattis/ICPC
+// problem package layout and in Polygon's package layout.
+package problempkg
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Formats understood by Read and Write
+const (
+	FormatKattis  = "kattis"
+	FormatPolygon = "polygon"
+)
+
+// Checker protocols
+const (
+	// CheckerTestlib checkers run as `checker input output answer` and exit 0 on success
+	CheckerTestlib = "testlib"
+	// CheckerKattis output validators run as `validator input answer feedback_dir < output`
+	// and exit 42 on success, 43 on a wrong answer
+	CheckerKattis = "kattis"
+)
+
+// ErrUnknownFormat is returned when an archive is neither a Kattis nor a Polygon package
+var ErrUnknownFormat = errors.New("archive is not a Kattis/ICPC or Polygon problem package")
+
+// ErrIncompatibleChecker is returned by Write when the problem's checker uses a
+// protocol the target format cannot express
+var ErrIncompatibleChecker = errors.New("checker protocol is not supported by this format")
+
+// Opener opens the content of a file in a package
+type Opener func() (io.ReadCloser, error)
+
+// Test is one testcase of a package
+type Test struct {
+	Name     string
+	IsSample bool
+	Input    Opener
+	Answer   Opener
+}
+
+// Program is a program that comes with a problem, such as its checker
+type Program struct {
+	Name     string
+	Language string // c, cpp or python3
+	Kind     string // checker protocol, for checkers
+	Source   []byte
+}
+
+// File is a support file that programs need, such as testlib.h
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Package is a problem in a format-neutral form
+type Package struct {
+	ShortName   string
+	Title       string
+	Statement   string
+	TimeLimit   int // milliseconds
+	MemoryLimit int // MB
+	Tests       []Test
+	Checker     *Program // nil means exact output comparison
+	Resources   []File
+}
+
+// Read detects the format of a package archive and reads it
+func Read(archive *zip.Reader) (*Package, error) {
+	for _, f := range archive.File {
+		switch path.Base(f.Name) {
+		case "problem.xml":
+			return readPolygon(archive, path.Dir(f.Name))
+		case "problem.yaml":
+			return readKattis(archive, path.Dir(f.Name))
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Write writes a package in the given format
+func Write(w io.Writer, pkg *Package, format string) error {
+	if err := CheckFormat(pkg, format); err != nil {
+		return err
+	}
+	switch format {
+	case FormatKattis:
+		return writeKattis(w, pkg)
+	case FormatPolygon:
+		return writePolygon(w, pkg)
+	default:
+		return fmt.Errorf("unknown package format %q", format)
+	}
+}
+
+// CheckFormat reports whether a package can be written in the given format,
+// so callers can fail before they start writing
+func CheckFormat(pkg *Package, format string) error {
+	var want string
+	switch format {
+	case FormatKattis:
+		want = CheckerKattis
+	case FormatPolygon:
+		want = CheckerTestlib
+	default:
+		return fmt.Errorf("unknown package format %q", format)
+	}
+	if pkg.Checker != nil && pkg.Checker.Kind != want {
+		return fmt.Errorf("%w: %s checkers cannot be exported in the %s format", ErrIncompatibleChecker, pkg.Checker.Kind, format)
+	}
+	return nil
+}
+
+// LanguageFromExt guesses a program's language from its file name
+func LanguageFromExt(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".c":
+		return "c"
+	case ".cpp", ".cc", ".cxx", ".c++":
+		return "cpp"
+	case ".py":
+		return "python3"
+	default:
+		return ""
+	}
+}
+
+// sourceExt is the file extension used when writing a program's source
+func sourceExt(language string) string {
+	switch language {
+	case "c":
+		return ".c"
+	case "python3":
+		return ".py"
+	default:
+		return ".cpp"
+	}
+}
+
+// archiveFiles indexes the files of an archive under root by their path relative to root
+func archiveFiles(archive *zip.Reader, root string) map[string]*zip.File {
+	files := map[string]*zip.File{}
+	prefix := ""
+	if root != "." && root != "" {
+		prefix = root + "/"
+	}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || !strings.HasPrefix(f.Name, prefix) {
+			continue
+		}
+		files[strings.TrimPrefix(f.Name, prefix)] = f
+	}
+	return files
+}
+
+// opener returns an Opener for a file of an archive
+func opener(f *zip.File) Opener {
+	return func() (io.ReadCloser, error) { return f.Open() }
+}
+
+// maxProgramSize caps programs and support files, which are read into memory
+const maxProgramSize = 8 << 20
+
+// readSmall reads a small file of an archive such as a program or a statement
+func readSmall(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxProgramSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", f.Name, maxProgramSize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxProgramSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProgramSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", f.Name, maxProgramSize>>20)
+	}
+	return data, nil
+}
+
+// writeFile adds a file to a zip archive
+func writeFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// copyFile adds a file to a zip archive, streaming its content
+func copyFile(zw *zip.Writer, name string, open Opener) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rc)
+	return err
+}
@@ -0,0 +1,400 @@
+package problempkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// zipFiles builds an archive of the given files
+func zipFiles(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		if err := writeFile(zw, name, []byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return readZip(t, buf.Bytes())
+}
+
+func readZip(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readAll(t *testing.T, open Opener) string {
+	t.Helper()
+	rc, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// testSummary lists a package's tests as name=input/answer, with * for samples
+func testSummary(t *testing.T, pkg *Package) string {
+	var parts []string
+	for _, test := range pkg.Tests {
+		part := test.Name + "=" + readAll(t, test.Input) + "/" + readAll(t, test.Answer)
+		if test.IsSample {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestReadKattis(t *testing.T) {
+	pkg, err := Read(zipFiles(t, map[string]string{
+		"hello/problem.yaml":                             "# generated\nname: \"Hello, World\"\nvalidation: custom # checker\nlimits:\n  time_limit: 2.5\n  memory: 512\n",
+		"hello/problem_statement/problem.tex":            "\\problemname{Ignored}\nSay hello.",
+		"hello/data/sample/1.in":                         "s1",
+		"hello/data/sample/1.ans":                        "a1",
+		"hello/data/secret/10.in":                        "s10",
+		"hello/data/secret/10.ans":                       "a10",
+		"hello/data/secret/2.in":                         "s2",
+		"hello/data/secret/2.ans":                        "a2",
+		"hello/output_validators/check/validate.cpp":     "#include \"util.h\"\nint main(int argc, char **argv) {}",
+		"hello/output_validators/check/util.h":           "int util();",
+		"hello/output_validators/check/README":           "notes",
+		"hello/output_validators/check/nested/ignored.h": "x",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.ShortName != "hello" || pkg.Title != "Hello, World" || pkg.TimeLimit != 2500 || pkg.MemoryLimit != 512 {
+		t.Errorf("got %q %q, %d ms, %d MB", pkg.ShortName, pkg.Title, pkg.TimeLimit, pkg.MemoryLimit)
+	}
+	if pkg.Statement != "\\problemname{Ignored}\nSay hello." {
+		t.Errorf("statement %q", pkg.Statement)
+	}
+	if got, want := testSummary(t, pkg), "sample/1=s1/a1* secret/2=s2/a2 secret/10=s10/a10"; got != want {
+		t.Errorf("tests %s, want %s", got, want)
+	}
+	if pkg.Checker == nil || pkg.Checker.Name != "validate.cpp" || pkg.Checker.Language != "cpp" || pkg.Checker.Kind != CheckerKattis {
+		t.Fatalf("checker %+v", pkg.Checker)
+	}
+	var resources []string
+	for _, f := range pkg.Resources {
+		resources = append(resources, f.Name)
+	}
+	if got := strings.Join(resources, " "); got != "README util.h" {
+		t.Errorf("resources %s, want README util.h", got)
+	}
+}
+
+func TestReadKattisDefaults(t *testing.T) {
+	pkg, err := Read(zipFiles(t, map[string]string{
+		"problem.yaml":                     "source: somewhere\n",
+		".timelimit":                       "3\n",
+		"problem_statement/problem.en.tex": "\\problemname{From the statement}\nText",
+		"data/secret/a.in":                 "i",
+		"data/secret/a.ans":                "o",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.ShortName != "problem" || pkg.Title != "From the statement" || pkg.TimeLimit != 3000 || pkg.MemoryLimit != 256 || pkg.Checker != nil {
+		t.Errorf("got %q %q, %d ms, %d MB, checker %v", pkg.ShortName, pkg.Title, pkg.TimeLimit, pkg.MemoryLimit, pkg.Checker)
+	}
+}
+
+func TestReadKattisErrors(t *testing.T) {
+	statement := "problem_statement/problem.md"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"interactive", map[string]string{"problem.yaml": "validation: custom interactive\n", statement: "x"}, "interactive problems are not supported"},
+		{"no statement", map[string]string{"problem.yaml": "name: x\n", "data/secret/1.in": "", "data/secret/1.ans": ""}, "no problem statement"},
+		{"missing answer", map[string]string{"problem.yaml": "name: x\n", statement: "x", "data/secret/1.in": ""}, "test data/secret/1 has no .ans file"},
+		{"no tests", map[string]string{"problem.yaml": "name: x\n", statement: "x"}, "no tests"},
+		{"no validator", map[string]string{"problem.yaml": "validation: custom\n", statement: "x", "data/secret/1.in": "", "data/secret/1.ans": ""}, "no output validator"},
+		{"validator without main", map[string]string{"problem.yaml": "validation: custom\n", statement: "x", "data/secret/1.in": "", "data/secret/1.ans": "", "output_validators/v/v.cpp": "int f();"}, "no C, C++ or Python output validator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(zipFiles(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+const polygonXML = `<?xml version="1.0" encoding="utf-8"?>
+<problem revision="3" short-name="a-plus-b">
+  <names>
+    <name language="russian" value="A плюс B"/>
+    <name language="english" value="A plus B"/>
+  </names>
+  <judging>
+    <testset name="pretests">
+      <test-count>1</test-count>
+      <input-path-pattern>pretests/%02d</input-path-pattern>
+      <answer-path-pattern>pretests/%02d.a</answer-path-pattern>
+      <tests><test method="manual"/></tests>
+    </testset>
+    <testset name="tests">
+      <time-limit>2000</time-limit>
+      <memory-limit>268435456</memory-limit>
+      <test-count>2</test-count>
+      <input-path-pattern>tests/%02d</input-path-pattern>
+      <answer-path-pattern>tests/%02d.a</answer-path-pattern>
+      <tests>
+        <test method="manual" sample="true"/>
+        <test method="generated"/>
+      </tests>
+    </testset>
+  </judging>
+  <files>
+    <resources>
+      <file path="files/testlib.h" type="h.g++"/>
+      <file path="files/problem.tex"/>
+    </resources>
+  </files>
+  <assets>
+    <checker name="std::ncmp.cpp" type="testlib">
+      <source path="files/check.cpp" type="cpp.g++17"/>
+    </checker>
+  </assets>
+</problem>`
+
+func TestReadPolygon(t *testing.T) {
+	pkg, err := Read(zipFiles(t, map[string]string{
+		"a-plus-b/problem.xml":                                polygonXML,
+		"a-plus-b/statements/english/problem-properties.json": `{"name": "A plus B", "legend": "Add two numbers.", "input": "Two integers.", "output": "Their sum.", "notes": ""}`,
+		"a-plus-b/tests/01":                                   "1 2",
+		"a-plus-b/tests/01.a":                                 "3",
+		"a-plus-b/tests/02":                                   "5 5",
+		"a-plus-b/tests/02.a":                                 "10",
+		"a-plus-b/files/check.cpp":                            "#include \"testlib.h\"\nint main() {}",
+		"a-plus-b/files/testlib.h":                            "// testlib",
+		"a-plus-b/files/problem.tex":                          "template",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.ShortName != "a-plus-b" || pkg.Title != "A plus B" || pkg.TimeLimit != 2000 || pkg.MemoryLimit != 256 {
+		t.Errorf("got %q %q, %d ms, %d MB", pkg.ShortName, pkg.Title, pkg.TimeLimit, pkg.MemoryLimit)
+	}
+	if want := "Add two numbers.\n\n## Input\n\nTwo integers.\n\n## Output\n\nTheir sum."; pkg.Statement != want {
+		t.Errorf("statement %q, want %q", pkg.Statement, want)
+	}
+	if got, want := testSummary(t, pkg), "tests/01=1 2/3* tests/02=5 5/10"; got != want {
+		t.Errorf("tests %s, want %s", got, want)
+	}
+	if pkg.Checker == nil || pkg.Checker.Name != "check.cpp" || pkg.Checker.Language != "cpp" || pkg.Checker.Kind != CheckerTestlib {
+		t.Fatalf("checker %+v", pkg.Checker)
+	}
+	if len(pkg.Resources) != 1 || pkg.Resources[0].Name != "testlib.h" {
+		t.Errorf("resources %+v, want testlib.h only", pkg.Resources)
+	}
+}
+
+func TestReadPolygonStatementSections(t *testing.T) {
+	pkg, err := Read(zipFiles(t, map[string]string{
+		"problem.xml":                           `<problem><names><name language="english" value="Sections"/></names><judging><testset name="tests"><input-path-pattern>tests/%02d</input-path-pattern><answer-path-pattern>tests/%02d.a</answer-path-pattern><tests><test/></tests></testset></judging></problem>`,
+		"statement-sections/english/legend.tex": "Legend.",
+		"statement-sections/english/notes.tex":  "A note.",
+		"tests/01":                              "in",
+		"tests/01.a":                            "out",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Legend.\n\n## Notes\n\nA note."; pkg.Statement != want {
+		t.Errorf("statement %q, want %q", pkg.Statement, want)
+	}
+	if pkg.TimeLimit != 1000 || pkg.MemoryLimit != 256 || pkg.Checker != nil {
+		t.Errorf("got %d ms, %d MB, checker %v; want the defaults", pkg.TimeLimit, pkg.MemoryLimit, pkg.Checker)
+	}
+}
+
+func TestReadPolygonErrors(t *testing.T) {
+	properties := "statements/english/problem-properties.json"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"invalid xml", map[string]string{"problem.xml": "<problem>"}, "invalid problem.xml"},
+		{"no statement", map[string]string{"problem.xml": polygonXML}, "no english statement"},
+		{"tests not generated", map[string]string{"problem.xml": polygonXML, properties: `{"legend": "x"}`, "tests/01": "", "tests/01.a": ""}, "package has no tests/02"},
+		{"no tests", map[string]string{"problem.xml": "<problem/>", properties: `{"legend": "x"}`}, "problem.xml has no tests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(zipFiles(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadUnknownFormat(t *testing.T) {
+	if _, err := Read(zipFiles(t, map[string]string{"tests/1.in": ""})); err != ErrUnknownFormat {
+		t.Errorf("got %v, want ErrUnknownFormat", err)
+	}
+}
+
+func testPackage(checkerKind string) *Package {
+	text := func(s string) Opener {
+		return func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(s)), nil }
+	}
+	pkg := &Package{
+		ShortName:   "sum",
+		Title:       `Sum: "quoted"`,
+		Statement:   "Add them.",
+		TimeLimit:   1500,
+		MemoryLimit: 128,
+		Tests: []Test{
+			{Name: "1", IsSample: true, Input: text("1 2"), Answer: text("3")},
+			{Name: "2", Input: text("2 2"), Answer: text("4")},
+			{Name: "3", Input: text("0 0"), Answer: text("")},
+		},
+	}
+	if checkerKind != "" {
+		pkg.Checker = &Program{Name: "check.py", Language: "python3", Kind: checkerKind, Source: []byte("if __name__ == '__main__': pass")}
+		pkg.Resources = []File{{Name: "helper.h", Data: []byte("// helper")}}
+	}
+	return pkg
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	tests := []struct {
+		format  string
+		checker string
+		tests   string
+	}{
+		{FormatKattis, CheckerKattis, "sample/01=1 2/3* secret/01=2 2/4 secret/02=0 0/"},
+		{FormatPolygon, CheckerTestlib, "tests/01=1 2/3* tests/02=2 2/4 tests/03=0 0/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, testPackage(tt.checker), tt.format); err != nil {
+				t.Fatal(err)
+			}
+			pkg, err := Read(readZip(t, buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Title != `Sum: "quoted"` || pkg.Statement != "Add them." || pkg.TimeLimit != 1500 || pkg.MemoryLimit != 128 {
+				t.Errorf("got %q %q, %d ms, %d MB", pkg.Title, pkg.Statement, pkg.TimeLimit, pkg.MemoryLimit)
+			}
+			if got := testSummary(t, pkg); got != tt.tests {
+				t.Errorf("tests %s, want %s", got, tt.tests)
+			}
+			if pkg.Checker == nil || pkg.Checker.Language != "python3" || pkg.Checker.Kind != tt.checker {
+				t.Fatalf("checker %+v", pkg.Checker)
+			}
+			if len(pkg.Resources) != 1 || pkg.Resources[0].Name != "helper.h" || string(pkg.Resources[0].Data) != "// helper" {
+				t.Errorf("resources %+v", pkg.Resources)
+			}
+		})
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		checker string
+		wantErr error
+	}{
+		{FormatKattis, "", nil},
+		{FormatKattis, CheckerKattis, nil},
+		{FormatKattis, CheckerTestlib, ErrIncompatibleChecker},
+		{FormatPolygon, CheckerTestlib, nil},
+		{FormatPolygon, CheckerKattis, ErrIncompatibleChecker},
+	}
+	for _, tt := range tests {
+		err := CheckFormat(testPackage(tt.checker), tt.format)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s with a %q checker: got %v, want %v", tt.format, tt.checker, err, tt.wantErr)
+		}
+	}
+	if err := CheckFormat(testPackage(""), "zip"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	doc := parseYAML(`---
+name: 'It''s a problem'  # a comment
+source: "Contest #1"
+limits:
+  time_limit: 2
+  memory: 1024
+rights_owner:
+  - someone
+name_map: {en: Hello, de: "Hallo"}
+validation: custom
+`)
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"name"}, "It's a problem"},
+		{[]string{"source"}, "Contest #1"},
+		{[]string{"limits", "time_limit"}, "2"},
+		{[]string{"limits", "memory"}, "1024"},
+		{[]string{"name_map", "de"}, "Hallo"},
+		{[]string{"validation"}, "custom"},
+		{[]string{"limits"}, ""},
+		{[]string{"missing", "key"}, ""},
+		{[]string{"name", "en"}, ""},
+	}
+	for _, tt := range tests {
+		if got := yamlString(doc, tt.keys...); got != tt.want {
+			t.Errorf("%s: got %q, want %q", strings.Join(tt.keys, "."), got, tt.want)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"2", "10", true},
+		{"10", "2", false},
+		{"test2", "test10", true},
+		{"a", "b", true},
+		{"007", "7a", true},
+		{"1", "1", false},
+		{"1", "1a", true},
+		{"group10/1", "group9/2", false},
+	}
+	for _, tt := range tests {
+		if got := NaturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
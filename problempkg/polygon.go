@@ -0,0 +1,288 @@
+package problempkg
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// polygonProblem is the part of Polygon's problem.xml that is read and written
+type polygonProblem struct {
+	XMLName   xml.Name         `xml:"problem"`
+	ShortName string           `xml:"short-name,attr,omitempty"`
+	Names     []polygonName    `xml:"names>name"`
+	Testsets  []polygonTestset `xml:"judging>testset"`
+	Resources []polygonFile    `xml:"files>resources>file"`
+	Checker   *polygonChecker  `xml:"assets>checker"`
+}
+
+type polygonName struct {
+	Language string `xml:"language,attr"`
+	Value    string `xml:"value,attr"`
+}
+
+type polygonFile struct {
+	Path string `xml:"path,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type polygonChecker struct {
+	Name   string      `xml:"name,attr,omitempty"`
+	Type   string      `xml:"type,attr"`
+	Source polygonFile `xml:"source"`
+}
+
+type polygonTestset struct {
+	Name              string        `xml:"name,attr"`
+	TimeLimit         int           `xml:"time-limit"`
+	MemoryLimit       int64         `xml:"memory-limit"`
+	TestCount         int           `xml:"test-count"`
+	InputPathPattern  string        `xml:"input-path-pattern"`
+	AnswerPathPattern string        `xml:"answer-path-pattern"`
+	Tests             []polygonTest `xml:"tests>test"`
+}
+
+type polygonTest struct {
+	Method string `xml:"method,attr,omitempty"`
+	Sample bool   `xml:"sample,attr,omitempty"`
+}
+
+// polygonStatement is statements/<language>/problem-properties.json
+type polygonStatement struct {
+	Name   string `json:"name"`
+	Legend string `json:"legend"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Notes  string `json:"notes"`
+}
+
+// polygonLanguages are the statement languages tried, in order of preference
+var polygonLanguages = []string{"english", "russian"}
+
+// readPolygon reads a full Polygon package (one downloaded with its
+// generated tests)
+func readPolygon(archive *zip.Reader, root string) (*Package, error) {
+	files := archiveFiles(archive, root)
+	data, err := readSmall(files["problem.xml"])
+	if err != nil {
+		return nil, err
+	}
+	var doc polygonProblem
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid problem.xml: %w", err)
+	}
+
+	pkg := &Package{ShortName: doc.ShortName, TimeLimit: 1000, MemoryLimit: 256}
+	if pkg.ShortName == "" {
+		pkg.ShortName = path.Base(root)
+	}
+	for _, language := range polygonLanguages {
+		for _, name := range doc.Names {
+			if name.Language == language && pkg.Title == "" {
+				pkg.Title = name.Value
+			}
+		}
+	}
+	if pkg.Title == "" && len(doc.Names) > 0 {
+		pkg.Title = doc.Names[0].Value
+	}
+	if pkg.Title == "" {
+		pkg.Title = pkg.ShortName
+	}
+
+	if pkg.Statement, err = polygonStatementText(files); err != nil {
+		return nil, err
+	}
+
+	// Only the main testset is judged
+	var testset *polygonTestset
+	for i := range doc.Testsets {
+		if doc.Testsets[i].Name == "tests" || testset == nil {
+			testset = &doc.Testsets[i]
+		}
+	}
+	if testset == nil || len(testset.Tests) == 0 {
+		return nil, fmt.Errorf("problem.xml has no tests")
+	}
+	if testset.TimeLimit > 0 {
+		pkg.TimeLimit = testset.TimeLimit
+	}
+	if testset.MemoryLimit > 0 {
+		pkg.MemoryLimit = int(testset.MemoryLimit >> 20)
+	}
+	for i, test := range testset.Tests {
+		inputName := fmt.Sprintf(testset.InputPathPattern, i+1)
+		answerName := fmt.Sprintf(testset.AnswerPathPattern, i+1)
+		input, ok := files[inputName]
+		if !ok {
+			return nil, fmt.Errorf("package has no %s; download the full package with generated tests from Polygon", inputName)
+		}
+		answer, ok := files[answerName]
+		if !ok {
+			return nil, fmt.Errorf("package has no %s; download the full package with generated tests from Polygon", answerName)
+		}
+		pkg.Tests = append(pkg.Tests, Test{
+			Name:     inputName,
+			IsSample: test.Sample,
+			Input:    opener(input),
+			Answer:   opener(answer),
+		})
+	}
+
+	if doc.Checker != nil && doc.Checker.Source.Path != "" {
+		f, ok := files[doc.Checker.Source.Path]
+		if !ok {
+			return nil, fmt.Errorf("package has no checker source %s", doc.Checker.Source.Path)
+		}
+		source, err := readSmall(f)
+		if err != nil {
+			return nil, err
+		}
+		language := LanguageFromExt(doc.Checker.Source.Path)
+		if language == "" {
+			return nil, fmt.Errorf("checker %s is not written in C, C++ or Python", doc.Checker.Source.Path)
+		}
+		pkg.Checker = &Program{Name: path.Base(doc.Checker.Source.Path), Language: language, Kind: CheckerTestlib, Source: source}
+
+		// Statement templates and styles are resources too, but only headers
+		// and sources are of use to the checker
+		for _, resource := range doc.Resources {
+			switch strings.ToLower(path.Ext(resource.Path)) {
+			case ".h", ".hpp", ".c", ".cpp", ".py":
+			default:
+				continue
+			}
+			f, ok := files[resource.Path]
+			if !ok {
+				continue
+			}
+			data, err := readSmall(f)
+			if err != nil {
+				return nil, err
+			}
+			pkg.Resources = append(pkg.Resources, File{Name: path.Base(resource.Path), Data: data})
+		}
+	}
+	return pkg, nil
+}
+
+// polygonStatementText assembles the statement from problem-properties.json,
+// or from the statement-sections when the package has no properties file
+func polygonStatementText(files map[string]*zip.File) (string, error) {
+	for _, language := range polygonLanguages {
+		var s polygonStatement
+		if f, ok := files["statements/"+language+"/problem-properties.json"]; ok {
+			data, err := readSmall(f)
+			if err != nil {
+				return "", err
+			}
+			if err := json.Unmarshal(data, &s); err != nil {
+				return "", fmt.Errorf("invalid %s: %w", f.Name, err)
+			}
+		} else {
+			found := false
+			for name, field := range map[string]*string{"legend": &s.Legend, "input": &s.Input, "output": &s.Output, "notes": &s.Notes} {
+				f, ok := files["statement-sections/"+language+"/"+name+".tex"]
+				if !ok {
+					continue
+				}
+				data, err := readSmall(f)
+				if err != nil {
+					return "", err
+				}
+				*field = string(data)
+				found = true
+			}
+			if !found {
+				continue
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString(strings.TrimSpace(s.Legend))
+		for _, section := range []struct{ title, text string }{{"Input", s.Input}, {"Output", s.Output}, {"Notes", s.Notes}} {
+			if text := strings.TrimSpace(section.text); text != "" {
+				fmt.Fprintf(&b, "\n\n## %s\n\n%s", section.title, text)
+			}
+		}
+		return strings.TrimSpace(b.String()), nil
+	}
+	return "", fmt.Errorf("package has no english statement")
+}
+
+// polygonSourceType is the source type Polygon records for a language
+func polygonSourceType(language string) string {
+	switch language {
+	case "c":
+		return "c.gcc"
+	case "python3":
+		return "python.3"
+	default:
+		return "cpp.g++17"
+	}
+}
+
+// writePolygon writes a package in Polygon's layout
+func writePolygon(w io.Writer, pkg *Package) error {
+	doc := polygonProblem{ShortName: pkg.ShortName}
+	doc.Names = []polygonName{{Language: "english", Value: pkg.Title}}
+	testset := polygonTestset{
+		Name:              "tests",
+		TimeLimit:         pkg.TimeLimit,
+		MemoryLimit:       int64(pkg.MemoryLimit) << 20,
+		TestCount:         len(pkg.Tests),
+		InputPathPattern:  "tests/%02d",
+		AnswerPathPattern: "tests/%02d.a",
+	}
+	for _, test := range pkg.Tests {
+		testset.Tests = append(testset.Tests, polygonTest{Method: "manual", Sample: test.IsSample})
+	}
+	doc.Testsets = []polygonTestset{testset}
+
+	zw := zip.NewWriter(w)
+	if pkg.Checker != nil {
+		for _, f := range pkg.Resources {
+			doc.Resources = append(doc.Resources, polygonFile{Path: "files/" + f.Name})
+			if err := writeFile(zw, "files/"+f.Name, f.Data); err != nil {
+				return err
+			}
+		}
+		doc.Checker = &polygonChecker{Type: CheckerTestlib, Source: polygonFile{
+			Path: "files/check" + sourceExt(pkg.Checker.Language),
+			Type: polygonSourceType(pkg.Checker.Language),
+		}}
+		if err := writeFile(zw, doc.Checker.Source.Path, pkg.Checker.Source); err != nil {
+			return err
+		}
+	}
+
+	meta, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(zw, "problem.xml", append([]byte(xml.Header), meta...)); err != nil {
+		return err
+	}
+
+	statement, err := json.MarshalIndent(polygonStatement{Name: pkg.Title, Legend: pkg.Statement}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(zw, "statements/english/problem-properties.json", statement); err != nil {
+		return err
+	}
+
+	for i, test := range pkg.Tests {
+		if err := copyFile(zw, fmt.Sprintf("tests/%02d", i+1), test.Input); err != nil {
+			return err
+		}
+		if err := copyFile(zw, fmt.Sprintf("tests/%02d.a", i+1), test.Answer); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,106 @@
+package problempkg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used by problem.yaml: nested mappings
+// of scalars, distinguished by indentation. Sequences and other constructs
+// are skipped.
+func parseYAML(data string) map[string]interface{} {
+	type frame struct {
+		indent int
+		m      map[string]interface{}
+	}
+	root := map[string]interface{}{}
+	stack := []frame{{indent: -1, m: root}}
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		key = unquoteYAML(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		for len(stack) > 1 && indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1].m
+
+		switch {
+		case value == "":
+			child := map[string]interface{}{}
+			parent[key] = child
+			stack = append(stack, frame{indent: indent, m: child})
+		case strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}"):
+			child := map[string]interface{}{}
+			for _, pair := range strings.Split(value[1:len(value)-1], ",") {
+				if k, v, ok := strings.Cut(pair, ":"); ok {
+					child[unquoteYAML(strings.TrimSpace(k))] = unquoteYAML(strings.TrimSpace(v))
+				}
+			}
+			parent[key] = child
+		default:
+			parent[key] = unquoteYAML(value)
+		}
+	}
+	return root
+}
+
+// stripYAMLComment removes a trailing # comment outside quotes
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"') {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+		return s[1 : len(s)-1]
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// yamlString returns the scalar at a dotted path, or ""
+func yamlString(doc map[string]interface{}, keys ...string) string {
+	var cur interface{} = doc
+	for _, key := range keys {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur = m[key]
+	}
+	s, _ := cur.(string)
+	return s
+}
+
+// quoteYAML quotes a scalar for writing
+func quoteYAML(s string) string {
+	return strconv.Quote(s)
+}
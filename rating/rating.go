@@ -0,0 +1,195 @@
+package rating
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"codesprint/standings"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// InitialRating is the rating of a user before their first rated contest
+const InitialRating = 1500
+
+// Participant is a contestant's standing in one contest together with the
+// rating they entered it with
+type Participant struct {
+	UserID int
+	Rating int
+	Rank   float64 // 1-based; tied users share the average of their places
+}
+
+// Result is a participant's rating change from one contest
+type Result struct {
+	UserID    int
+	Rank      float64
+	OldRating int
+	NewRating int
+	Delta     int
+}
+
+// winProbability is the Elo probability that a player rated a beats one rated b
+func winProbability(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// expectedRank is the rank a player with the given rating is expected to
+// reach among participants, not counting participants[self]
+func expectedRank(participants []Participant, rating float64, self int) float64 {
+	rank := 1.0
+	for j, p := range participants {
+		if j != self {
+			rank += winProbability(float64(p.Rating), rating)
+		}
+	}
+	return rank
+}
+
+// Calculate computes Elo-style rating changes in the manner of Codeforces:
+// each participant moves halfway towards the rating that would have made
+// their actual rank the expected one, then all changes are shifted so that
+// they sum to slightly below zero to counter rating inflation.
+func Calculate(participants []Participant) []Result {
+	results := make([]Result, len(participants))
+	for i, p := range participants {
+		results[i] = Result{UserID: p.UserID, Rank: p.Rank, OldRating: p.Rating, NewRating: p.Rating}
+	}
+	if len(participants) < 2 {
+		return results
+	}
+
+	deltas := make([]float64, len(participants))
+	sum := 0.0
+	for i, p := range participants {
+		// Aim for the geometric mean of the expected and the actual rank
+		target := math.Sqrt(expectedRank(participants, float64(p.Rating), i) * p.Rank)
+
+		// Expected rank decreases as rating grows
+		lo, hi := 1.0, 8000.0
+		for iter := 0; iter < 60; iter++ {
+			mid := (lo + hi) / 2
+			if expectedRank(participants, mid, i) < target {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		deltas[i] = (lo - float64(p.Rating)) / 2
+		sum += deltas[i]
+	}
+
+	correction := -sum/float64(len(participants)) - 1
+	for i := range results {
+		delta := int(math.Round(deltas[i] + correction))
+		results[i].Delta = delta
+		results[i].NewRating = results[i].OldRating + delta
+	}
+	return results
+}
+
+// ranks assigns 1-based ranks to sorted standings, averaging ties on solved
+// count and penalty
+func ranks(entries []models.LeaderboardEntry) []float64 {
+	result := make([]float64, len(entries))
+	for i := 0; i < len(entries); {
+		j := i
+		for j < len(entries) && entries[j].SolvedCount == entries[i].SolvedCount && entries[j].Penalty == entries[i].Penalty {
+			j++
+		}
+		// Places i+1..j share their average
+		avg := float64(i+1+j) / 2
+		for k := i; k < j; k++ {
+			result[k] = avg
+		}
+		i = j
+	}
+	return result
+}
+
+// ApplyContest computes the rating changes of a finalized contest from its
+// official standings and records them. It must run in the transaction that
+// finalizes the contest.
+func ApplyContest(tx *sql.Tx, contestID int) error {
+	leaderboard, err := standings.Compute(tx, contestID)
+	if err != nil {
+		return err
+	}
+
+	entries := leaderboard.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].SolvedCount != entries[j].SolvedCount {
+			return entries[i].SolvedCount > entries[j].SolvedCount
+		}
+		return entries[i].Penalty < entries[j].Penalty
+	})
+	entryRanks := ranks(entries)
+
+	participants := make([]Participant, 0, len(entries))
+	for i, entry := range entries {
+		var current sql.NullInt64
+		err := tx.QueryRow("SELECT rating FROM users WHERE id = $1 FOR UPDATE", entry.UserID).Scan(&current)
+		if err != nil {
+			return fmt.Errorf("failed to load rating of user %d: %w", entry.UserID, err)
+		}
+		rating := InitialRating
+		if current.Valid {
+			rating = int(current.Int64)
+		}
+		participants = append(participants, Participant{UserID: entry.UserID, Rating: rating, Rank: entryRanks[i]})
+	}
+
+	for _, result := range Calculate(participants) {
+		_, err := tx.Exec(
+			"INSERT INTO rating_changes (user_id, contest_id, rank, old_rating, new_rating, delta) VALUES ($1, $2, $3, $4, $5, $6)",
+			result.UserID, contestID, result.Rank, result.OldRating, result.NewRating, result.Delta,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE users SET rating = $1 WHERE id = $2", result.NewRating, result.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecomputeAll discards all rating history and replays every finalized rated
+// contest in the order the contests ended
+func RecomputeAll() error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM rating_changes"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET rating = NULL"); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id FROM contests WHERE is_rated AND finalized_at IS NOT NULL ORDER BY end_time, id")
+	if err != nil {
+		return err
+	}
+	var contestIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		contestIDs = append(contestIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range contestIDs {
+		if err := ApplyContest(tx, id); err != nil {
+			return fmt.Errorf("contest %d: %w", id, err)
+		}
+	}
+	return tx.Commit()
+}
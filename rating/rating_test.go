@@ -0,0 +1,123 @@
+package rating
+
+import (
+	"codesprint/models"
+	"testing"
+)
+
+func TestRanks(t *testing.T) {
+	entry := func(solved, penalty int) models.LeaderboardEntry {
+		return models.LeaderboardEntry{SolvedCount: solved, Penalty: penalty}
+	}
+	tests := []struct {
+		name    string
+		entries []models.LeaderboardEntry
+		want    []float64
+	}{
+		{"empty", nil, []float64{}},
+		{"no ties", []models.LeaderboardEntry{entry(3, 10), entry(2, 5), entry(1, 0)}, []float64{1, 2, 3}},
+		{"tie for first", []models.LeaderboardEntry{entry(3, 10), entry(3, 10), entry(1, 0)}, []float64{1.5, 1.5, 3}},
+		{"three-way tie in the middle", []models.LeaderboardEntry{entry(4, 0), entry(2, 7), entry(2, 7), entry(2, 7), entry(0, 0)}, []float64{1, 3, 3, 3, 5}},
+		{"same solved, different penalty", []models.LeaderboardEntry{entry(2, 5), entry(2, 6)}, []float64{1, 2}},
+		{"everyone tied", []models.LeaderboardEntry{entry(0, 0), entry(0, 0), entry(0, 0), entry(0, 0)}, []float64{2.5, 2.5, 2.5, 2.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ranks(tt.entries)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name         string
+		participants []Participant
+		check        func(t *testing.T, results []Result)
+	}{
+		{
+			name:         "a lone participant keeps their rating",
+			participants: []Participant{{UserID: 1, Rating: 1700, Rank: 1}},
+			check: func(t *testing.T, results []Result) {
+				if results[0].Delta != 0 || results[0].NewRating != 1700 {
+					t.Errorf("got %+v", results[0])
+				}
+			},
+		},
+		{
+			name: "equal ratings: better ranks gain more",
+			participants: []Participant{
+				{UserID: 1, Rating: 1500, Rank: 1}, {UserID: 2, Rating: 1500, Rank: 2},
+				{UserID: 3, Rating: 1500, Rank: 3}, {UserID: 4, Rating: 1500, Rank: 4},
+			},
+			check: func(t *testing.T, results []Result) {
+				if results[0].Delta <= 0 || results[3].Delta >= 0 {
+					t.Errorf("winner %+d and last %+d, want a gain and a loss", results[0].Delta, results[3].Delta)
+				}
+				for i := 1; i < len(results); i++ {
+					if results[i].Delta >= results[i-1].Delta {
+						t.Errorf("rank %g changed by %+d, not less than rank %g's %+d", results[i].Rank, results[i].Delta, results[i-1].Rank, results[i-1].Delta)
+					}
+				}
+			},
+		},
+		{
+			name: "tied ranks with equal ratings change alike",
+			participants: []Participant{
+				{UserID: 1, Rating: 1500, Rank: 2}, {UserID: 2, Rating: 1500, Rank: 2}, {UserID: 3, Rating: 1500, Rank: 2},
+			},
+			check: func(t *testing.T, results []Result) {
+				for _, r := range results {
+					if r.Delta != -1 {
+						t.Errorf("user %d changed by %+d, want the -1 correction only", r.UserID, r.Delta)
+					}
+				}
+			},
+		},
+		{
+			name: "an upset moves ratings more than an expected result",
+			participants: []Participant{
+				{UserID: 1, Rating: 1200, Rank: 1}, {UserID: 2, Rating: 2000, Rank: 2},
+				{UserID: 3, Rating: 2000, Rank: 3}, {UserID: 4, Rating: 1200, Rank: 4},
+			},
+			check: func(t *testing.T, results []Result) {
+				upset, expected := results[0].Delta, -results[3].Delta
+				if upset <= expected {
+					t.Errorf("low-rated winner gained %+d, low-rated last lost %d; want the upset to move more", upset, expected)
+				}
+				if results[1].Delta >= 0 {
+					t.Errorf("high-rated user beaten by a low-rated one changed by %+d, want a loss", results[1].Delta)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := Calculate(tt.participants)
+			if len(results) != len(tt.participants) {
+				t.Fatalf("got %d results for %d participants", len(results), len(tt.participants))
+			}
+			sum := 0
+			for i, r := range results {
+				p := tt.participants[i]
+				if r.UserID != p.UserID || r.Rank != p.Rank || r.OldRating != p.Rating || r.NewRating != r.OldRating+r.Delta {
+					t.Errorf("result %+v does not match participant %+v", r, p)
+				}
+				sum += r.Delta
+			}
+			// The correction keeps the total slightly negative: about -1 each,
+			// give or take rounding
+			if n := len(results); n > 1 && (sum > 0 || sum < -2*n) {
+				t.Errorf("deltas sum to %d for %d participants, want between %d and 0", sum, n, -2*n)
+			}
+			tt.check(t, results)
+		})
+	}
+}
@@ -0,0 +1,583 @@
+package standings
+
+import (
+	"codesprint/database"
+	"codesprint/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// foldSubmission applies one submission, taken in submission order, to a
+// user's cell. elapsed is the time since the user's start (the contest start,
+// or their own start for virtual participants).
+func foldSubmission(cell *models.LeaderboardCell, submissionID int, status string, createdAt time.Time, elapsed time.Duration) {
+	if cell.Solved {
+		// Submissions after the first accepted one do not change the cell
+		return
+	}
+	if status == "pending" || status == "running" {
+		cell.Pending = true
+		return
+	}
+	if status == "judge_error" {
+		// The judge failed, not the contestant; the submission counts once rejudged
+		return
+	}
+
+	cell.Attempts++
+	if status != "accepted" {
+		return
+	}
+
+	solvedAt := createdAt
+	cell.Solved = true
+	cell.Pending = false
+	cell.SolvedAt = &solvedAt
+	cell.SolveMinute = int(elapsed.Minutes())
+	cell.AcceptedSubmissionID = submissionID
+}
+
+// Compute recomputes the official standings of a contest from its in-contest submissions
+func Compute(q queryer, contestID int) (*models.Leaderboard, error) {
+	return compute(q, contestID, false, nil)
+}
+
+// ComputeVirtual computes the standings of a contest with virtual participants
+// merged in. Every participant is shown as of the given time elapsed since
+// their own start, and virtual solve times are mapped onto the original
+// contest timeline.
+func ComputeVirtual(contestID int, elapsed time.Duration) (*models.Leaderboard, error) {
+	return compute(database.DB, contestID, true, &elapsed)
+}
+
+func compute(q queryer, contestID int, includeVirtual bool, cutoff *time.Duration) (*models.Leaderboard, error) {
+	var contestStart time.Time
+	err := q.QueryRow(
+		"SELECT start_time FROM contests WHERE id = $1",
+		contestID,
+	).Scan(&contestStart)
+	if err != nil {
+		return nil, err
+	}
+
+	leaderboard := &models.Leaderboard{ContestID: contestID}
+	leaderboard.Problems, err = loadProblems(q, contestID)
+	if err != nil {
+		return nil, err
+	}
+	problemIndex := map[int]int{}
+	for i, problem := range leaderboard.Problems {
+		problemIndex[problem.ProblemID] = i
+	}
+
+	rows, err := q.Query(`
+		SELECT s.id, s.user_id, u.name, s.problem_id, s.status, s.created_at, vp.started_at
+		FROM submissions s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN virtual_participations vp ON vp.id = s.virtual_participation_id
+		WHERE s.contest_id = $1 AND NOT s.is_practice AND (s.virtual_participation_id IS NULL OR $2)
+		ORDER BY s.created_at, s.id
+	`, contestID, includeVirtual)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := map[int]*models.LeaderboardEntry{}
+	var order []int
+	for rows.Next() {
+		var submissionID, userID, problemID int
+		var userName, status string
+		var createdAt time.Time
+		var virtualStart sql.NullTime
+		if err := rows.Scan(&submissionID, &userID, &userName, &problemID, &status, &createdAt, &virtualStart); err != nil {
+			return nil, err
+		}
+
+		start := contestStart
+		if virtualStart.Valid {
+			start = virtualStart.Time
+		}
+		elapsed := createdAt.Sub(start)
+		if cutoff != nil && elapsed > *cutoff {
+			continue
+		}
+
+		entry, ok := entries[userID]
+		if !ok {
+			entry = newEntry(userID, userName, leaderboard.Problems)
+			entry.IsVirtual = virtualStart.Valid
+			entries[userID] = entry
+			order = append(order, userID)
+		}
+
+		idx, ok := problemIndex[problemID]
+		if !ok {
+			continue
+		}
+		// Place the submission at its equivalent time in the original contest
+		foldSubmission(&entry.Problems[idx], submissionID, status, contestStart.Add(elapsed), elapsed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	leaderboard.Entries = make([]models.LeaderboardEntry, 0, len(order))
+	for _, userID := range order {
+		entry := entries[userID]
+		totalEntry(entry)
+		leaderboard.Entries = append(leaderboard.Entries, *entry)
+	}
+	markFirstSolves(leaderboard)
+	summarize(leaderboard)
+	sortEntries(leaderboard.Entries)
+
+	return leaderboard, nil
+}
+
+// Load reads the standings of a contest from the incremental store, together
+// with the store version they correspond to
+func Load(contestID int) (*models.Leaderboard, int64, error) {
+	// Read the version and the rows from a single snapshot
+	tx, err := database.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var version int64
+	err = tx.QueryRow(
+		"SELECT version FROM leaderboard_versions WHERE contest_id = $1",
+		contestID,
+	).Scan(&version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	leaderboard := &models.Leaderboard{ContestID: contestID}
+	leaderboard.Problems, err = loadProblems(tx, contestID)
+	if err != nil {
+		return nil, 0, err
+	}
+	problemIndex := map[int]int{}
+	for i, problem := range leaderboard.Problems {
+		problemIndex[problem.ProblemID] = i
+	}
+
+	rows, err := tx.Query(`
+		SELECT lc.user_id, u.name, lc.solved_count, lc.penalty, lc.last_submission_time
+		FROM leaderboard_cache lc
+		JOIN users u ON u.id = lc.user_id
+		WHERE lc.contest_id = $1
+		ORDER BY lc.solved_count DESC, lc.penalty ASC, lc.last_submission_time ASC NULLS LAST, lc.user_id
+	`, contestID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entryIndex := map[int]int{}
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		var lastSubmissionTime sql.NullTime
+		if err := rows.Scan(&entry.UserID, &entry.UserName, &entry.SolvedCount, &entry.Penalty, &lastSubmissionTime); err != nil {
+			return nil, 0, err
+		}
+		if lastSubmissionTime.Valid {
+			entry.LastSubmissionTime = &lastSubmissionTime.Time
+		}
+		entry.Problems = newEntry(entry.UserID, entry.UserName, leaderboard.Problems).Problems
+		entryIndex[entry.UserID] = len(leaderboard.Entries)
+		leaderboard.Entries = append(leaderboard.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	cellRows, err := tx.Query(`
+		SELECT user_id, problem_id, attempts, solved, solved_at, solve_minute, pending, first_to_solve
+		FROM leaderboard_cells
+		WHERE contest_id = $1
+	`, contestID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cellRows.Close()
+
+	for cellRows.Next() {
+		var userID int
+		var cell models.LeaderboardCell
+		var solvedAt sql.NullTime
+		if err := cellRows.Scan(&userID, &cell.ProblemID, &cell.Attempts, &cell.Solved, &solvedAt, &cell.SolveMinute, &cell.Pending, &cell.FirstToSolve); err != nil {
+			return nil, 0, err
+		}
+		if solvedAt.Valid {
+			cell.SolvedAt = &solvedAt.Time
+		}
+		ei, ok := entryIndex[userID]
+		if !ok {
+			continue
+		}
+		pi, ok := problemIndex[cell.ProblemID]
+		if !ok {
+			continue
+		}
+		leaderboard.Entries[ei].Problems[pi] = cell
+	}
+	if err := cellRows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	summarize(leaderboard)
+
+	return leaderboard, version, nil
+}
+
+// Version returns the current version of a contest's stored standings.
+// It returns sql.ErrNoRows when the standings have never been built.
+func Version(contestID int) (int64, error) {
+	var version int64
+	err := database.DB.QueryRow(
+		"SELECT version FROM leaderboard_versions WHERE contest_id = $1",
+		contestID,
+	).Scan(&version)
+	return version, err
+}
+
+// ApplySubmission updates the stored standings for the user and problem of a
+// submission. It must run in the same transaction that changed the submission.
+func ApplySubmission(tx *sql.Tx, submissionID int) error {
+	var contestID, userID, problemID int
+	var official bool
+	err := tx.QueryRow(
+		"SELECT COALESCE(contest_id, 0), user_id, problem_id, contest_id IS NOT NULL AND virtual_participation_id IS NULL AND NOT is_practice FROM submissions WHERE id = $1",
+		submissionID,
+	).Scan(&contestID, &userID, &problemID, &official)
+	if err != nil {
+		return fmt.Errorf("failed to load submission %d: %w", submissionID, err)
+	}
+	if !official {
+		// Virtual participants, post-contest practice and archive submissions
+		// are not part of the official standings
+		return nil
+	}
+
+	// Bumping the version locks the contest's standings until commit, which
+	// serializes concurrent verdicts for the same contest
+	res, err := tx.Exec(
+		"UPDATE leaderboard_versions SET version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE contest_id = $1",
+		contestID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Never built for this contest: build everything, including this submission
+		return rebuildTx(tx, contestID)
+	}
+
+	var contestStart time.Time
+	err = tx.QueryRow(
+		"SELECT start_time FROM contests WHERE id = $1",
+		contestID,
+	).Scan(&contestStart)
+	if err != nil {
+		return err
+	}
+
+	// Recompute the single affected cell from the user's submissions on the problem
+	rows, err := tx.Query(
+		"SELECT id, status, created_at FROM submissions WHERE contest_id = $1 AND user_id = $2 AND problem_id = $3 AND virtual_participation_id IS NULL AND NOT is_practice ORDER BY created_at, id",
+		contestID, userID, problemID,
+	)
+	if err != nil {
+		return err
+	}
+	cell := models.LeaderboardCell{ProblemID: problemID}
+	for rows.Next() {
+		var id int
+		var status string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &status, &createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		foldSubmission(&cell, id, status, createdAt, createdAt.Sub(contestStart))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := upsertCell(tx, contestID, userID, cell); err != nil {
+		return err
+	}
+	if err := refreshFirstSolve(tx, contestID, problemID); err != nil {
+		return err
+	}
+	return refreshTotals(tx, contestID, userID)
+}
+
+// Rebuild recomputes the stored standings of a contest from scratch
+func Rebuild(contestID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := rebuildTx(tx, contestID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RebuildAll recomputes the stored standings of every contest
+func RebuildAll() error {
+	rows, err := database.DB.Query("SELECT id FROM contests ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var contestIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		contestIDs = append(contestIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range contestIDs {
+		if err := Rebuild(id); err != nil {
+			return fmt.Errorf("contest %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func rebuildTx(tx *sql.Tx, contestID int) error {
+	var exists int
+	if err := tx.QueryRow("SELECT 1 FROM contests WHERE id = $1", contestID).Scan(&exists); err != nil {
+		return err
+	}
+
+	// Take the contest's standings lock before touching any rows
+	_, err := tx.Exec(`
+		INSERT INTO leaderboard_versions (contest_id, version) VALUES ($1, 1)
+		ON CONFLICT (contest_id) DO UPDATE SET version = leaderboard_versions.version + 1, updated_at = CURRENT_TIMESTAMP
+	`, contestID)
+	if err != nil {
+		return err
+	}
+
+	leaderboard, err := Compute(tx, contestID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM leaderboard_cells WHERE contest_id = $1", contestID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM leaderboard_cache WHERE contest_id = $1", contestID); err != nil {
+		return err
+	}
+
+	for _, entry := range leaderboard.Entries {
+		for _, cell := range entry.Problems {
+			if cell.Attempts == 0 && !cell.Pending {
+				continue
+			}
+			if err := upsertCell(tx, contestID, entry.UserID, cell); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(
+			"INSERT INTO leaderboard_cache (contest_id, user_id, solved_count, penalty, last_submission_time) VALUES ($1, $2, $3, $4, $5)",
+			contestID, entry.UserID, entry.SolvedCount, entry.Penalty, entry.LastSubmissionTime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, problem := range leaderboard.Problems {
+		if err := refreshFirstSolve(tx, contestID, problem.ProblemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertCell(tx *sql.Tx, contestID, userID int, cell models.LeaderboardCell) error {
+	var acceptedSubmissionID *int
+	if cell.Solved {
+		acceptedSubmissionID = &cell.AcceptedSubmissionID
+	}
+	_, err := tx.Exec(`
+		INSERT INTO leaderboard_cells (contest_id, user_id, problem_id, attempts, solved, solved_at, solve_minute, pending, accepted_submission_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (contest_id, user_id, problem_id) DO UPDATE SET
+			attempts = EXCLUDED.attempts,
+			solved = EXCLUDED.solved,
+			solved_at = EXCLUDED.solved_at,
+			solve_minute = EXCLUDED.solve_minute,
+			pending = EXCLUDED.pending,
+			accepted_submission_id = EXCLUDED.accepted_submission_id
+	`, contestID, userID, cell.ProblemID, cell.Attempts, cell.Solved, cell.SolvedAt, cell.SolveMinute, cell.Pending, acceptedSubmissionID)
+	return err
+}
+
+// refreshFirstSolve marks the earliest accepted cell of a problem as first to solve
+func refreshFirstSolve(tx *sql.Tx, contestID, problemID int) error {
+	_, err := tx.Exec(`
+		UPDATE leaderboard_cells SET first_to_solve = COALESCE(user_id = (
+			SELECT user_id FROM leaderboard_cells
+			WHERE contest_id = $1 AND problem_id = $2 AND solved
+			ORDER BY solved_at, accepted_submission_id
+			LIMIT 1
+		), FALSE)
+		WHERE contest_id = $1 AND problem_id = $2
+	`, contestID, problemID)
+	return err
+}
+
+// refreshTotals recomputes a user's row from their cells
+func refreshTotals(tx *sql.Tx, contestID, userID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO leaderboard_cache (contest_id, user_id, solved_count, penalty, last_submission_time)
+		SELECT $1, $2,
+			COUNT(*) FILTER (WHERE solved),
+			COALESCE(SUM(solve_minute) FILTER (WHERE solved), 0),
+			MAX(solved_at)
+		FROM leaderboard_cells
+		WHERE contest_id = $1 AND user_id = $2
+		ON CONFLICT (contest_id, user_id) DO UPDATE SET
+			solved_count = EXCLUDED.solved_count,
+			penalty = EXCLUDED.penalty,
+			last_submission_time = EXCLUDED.last_submission_time
+	`, contestID, userID)
+	return err
+}
+
+// loadProblems returns the columns of a contest's board, in display order
+func loadProblems(q queryer, contestID int) ([]models.LeaderboardProblemSummary, error) {
+	rows, err := q.Query(
+		`SELECT p.id, cp.label, p.title
+		FROM contest_problems cp
+		JOIN problems p ON p.id = cp.problem_id
+		WHERE cp.contest_id = $1
+		ORDER BY cp.position, cp.label`,
+		contestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []models.LeaderboardProblemSummary
+	for rows.Next() {
+		var summary models.LeaderboardProblemSummary
+		if err := rows.Scan(&summary.ProblemID, &summary.Label, &summary.Title); err != nil {
+			return nil, err
+		}
+		problems = append(problems, summary)
+	}
+	return problems, rows.Err()
+}
+
+func newEntry(userID int, userName string, problems []models.LeaderboardProblemSummary) *models.LeaderboardEntry {
+	entry := &models.LeaderboardEntry{
+		UserID:   userID,
+		UserName: userName,
+		Problems: make([]models.LeaderboardCell, len(problems)),
+	}
+	for i, problem := range problems {
+		entry.Problems[i].ProblemID = problem.ProblemID
+	}
+	return entry
+}
+
+// totalEntry derives a user's solved count, penalty and last accepted time from their cells
+func totalEntry(entry *models.LeaderboardEntry) {
+	entry.SolvedCount = 0
+	entry.Penalty = 0
+	entry.LastSubmissionTime = nil
+	for _, cell := range entry.Problems {
+		if !cell.Solved {
+			continue
+		}
+		entry.SolvedCount++
+		entry.Penalty += cell.SolveMinute
+		if entry.LastSubmissionTime == nil || cell.SolvedAt.After(*entry.LastSubmissionTime) {
+			entry.LastSubmissionTime = cell.SolvedAt
+		}
+	}
+}
+
+// markFirstSolves flags the earliest accepted cell of every problem
+func markFirstSolves(leaderboard *models.Leaderboard) {
+	for pi := range leaderboard.Problems {
+		var first *models.LeaderboardCell
+		for ei := range leaderboard.Entries {
+			cell := &leaderboard.Entries[ei].Problems[pi]
+			cell.FirstToSolve = false
+			if !cell.Solved {
+				continue
+			}
+			if first == nil || cell.SolvedAt.Before(*first.SolvedAt) ||
+				(cell.SolvedAt.Equal(*first.SolvedAt) && cell.AcceptedSubmissionID < first.AcceptedSubmissionID) {
+				first = cell
+			}
+		}
+		if first != nil {
+			first.FirstToSolve = true
+		}
+	}
+}
+
+// summarize fills the per-problem summary row from the entries' cells
+func summarize(leaderboard *models.Leaderboard) {
+	for pi := range leaderboard.Problems {
+		leaderboard.Problems[pi].Attempts = 0
+		leaderboard.Problems[pi].AcceptedCount = 0
+		for _, entry := range leaderboard.Entries {
+			cell := entry.Problems[pi]
+			leaderboard.Problems[pi].Attempts += cell.Attempts
+			if cell.Solved {
+				leaderboard.Problems[pi].AcceptedCount++
+			}
+		}
+	}
+}
+
+// sortEntries orders entries by solved count, penalty and time of last accepted submission
+func sortEntries(entries []models.LeaderboardEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.SolvedCount != b.SolvedCount {
+			return a.SolvedCount > b.SolvedCount
+		}
+		if a.Penalty != b.Penalty {
+			return a.Penalty < b.Penalty
+		}
+		if (a.LastSubmissionTime == nil) != (b.LastSubmissionTime == nil) {
+			return a.LastSubmissionTime != nil
+		}
+		if a.LastSubmissionTime != nil && !a.LastSubmissionTime.Equal(*b.LastSubmissionTime) {
+			return a.LastSubmissionTime.Before(*b.LastSubmissionTime)
+		}
+		return a.UserID < b.UserID
+	})
+}
@@ -0,0 +1,209 @@
+package standings
+
+import (
+	"codesprint/models"
+	"testing"
+	"time"
+)
+
+var contestStart = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// submission is one submission folded into a cell, made minute minutes into
+// the contest
+type submission struct {
+	status string
+	minute int
+}
+
+func foldAll(submissions ...submission) models.LeaderboardCell {
+	var cell models.LeaderboardCell
+	for i, s := range submissions {
+		elapsed := time.Duration(s.minute)*time.Minute + 30*time.Second
+		foldSubmission(&cell, i+1, s.status, contestStart.Add(elapsed), elapsed)
+	}
+	return cell
+}
+
+func TestFoldSubmission(t *testing.T) {
+	tests := []struct {
+		name        string
+		submissions []submission
+		solved      bool
+		attempts    int
+		minute      int
+		pending     bool
+		acceptedID  int
+	}{
+		{name: "no submissions"},
+		{
+			name:        "accepted first try",
+			submissions: []submission{{"accepted", 12}},
+			solved:      true, attempts: 1, minute: 12, acceptedID: 1,
+		},
+		{
+			name:        "wrong answers before accepted",
+			submissions: []submission{{"wrong_answer", 3}, {"time_limit_exceeded", 9}, {"accepted", 40}},
+			solved:      true, attempts: 3, minute: 40, acceptedID: 3,
+		},
+		{
+			name:        "submissions after accepted ignored",
+			submissions: []submission{{"accepted", 5}, {"wrong_answer", 6}, {"pending", 7}},
+			solved:      true, attempts: 1, minute: 5, acceptedID: 1,
+		},
+		{
+			name:        "failed attempts only",
+			submissions: []submission{{"wrong_answer", 1}, {"runtime_error", 2}, {"compilation_error", 3}},
+			attempts:    3,
+		},
+		{
+			name:        "pending after a wrong answer",
+			submissions: []submission{{"wrong_answer", 1}, {"pending", 2}},
+			attempts:    1, pending: true,
+		},
+		{
+			name:        "running counts as pending",
+			submissions: []submission{{"running", 2}},
+			pending:     true,
+		},
+		{
+			name:        "accepted after pending clears pending",
+			submissions: []submission{{"pending", 1}, {"accepted", 2}},
+			solved:      true, attempts: 1, minute: 2, acceptedID: 2,
+		},
+		{
+			name:        "judge errors are not attempts",
+			submissions: []submission{{"judge_error", 1}, {"wrong_answer", 2}, {"judge_error", 3}},
+			attempts:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := foldAll(tt.submissions...)
+			if cell.Solved != tt.solved || cell.Attempts != tt.attempts || cell.Pending != tt.pending {
+				t.Fatalf("got solved %v, attempts %d, pending %v; want %v, %d, %v",
+					cell.Solved, cell.Attempts, cell.Pending, tt.solved, tt.attempts, tt.pending)
+			}
+			if !tt.solved {
+				if cell.SolvedAt != nil {
+					t.Errorf("unsolved cell has solved_at %v", cell.SolvedAt)
+				}
+				return
+			}
+			if cell.SolveMinute != tt.minute || cell.AcceptedSubmissionID != tt.acceptedID {
+				t.Errorf("got solve minute %d and accepted submission %d, want %d and %d",
+					cell.SolveMinute, cell.AcceptedSubmissionID, tt.minute, tt.acceptedID)
+			}
+			if want := contestStart.Add(time.Duration(tt.minute)*time.Minute + 30*time.Second); cell.SolvedAt == nil || !cell.SolvedAt.Equal(want) {
+				t.Errorf("got solved_at %v, want %v", cell.SolvedAt, want)
+			}
+		})
+	}
+}
+
+// solvedCell is a cell solved minute minutes into the contest by submission id
+func solvedCell(minute, id int) models.LeaderboardCell {
+	at := contestStart.Add(time.Duration(minute) * time.Minute)
+	return models.LeaderboardCell{Solved: true, Attempts: 1, SolvedAt: &at, SolveMinute: minute, AcceptedSubmissionID: id}
+}
+
+func TestMarkFirstSolves(t *testing.T) {
+	unsolved := models.LeaderboardCell{Attempts: 2}
+	leaderboard := &models.Leaderboard{
+		Problems: []models.LeaderboardProblemSummary{{Label: "A"}, {Label: "B"}, {Label: "C"}},
+		Entries: []models.LeaderboardEntry{
+			{UserID: 1, Problems: []models.LeaderboardCell{solvedCell(30, 7), solvedCell(10, 3), unsolved}},
+			{UserID: 2, Problems: []models.LeaderboardCell{solvedCell(20, 5), solvedCell(10, 2), unsolved}},
+			{UserID: 3, Problems: []models.LeaderboardCell{unsolved, unsolved, unsolved}},
+		},
+	}
+	// A stale flag is cleared
+	leaderboard.Entries[0].Problems[0].FirstToSolve = true
+
+	markFirstSolves(leaderboard)
+
+	want := [][]bool{
+		{false, false, false},
+		{true, true, false}, // B: same minute, earlier submission
+		{false, false, false},
+	}
+	for ei, entry := range leaderboard.Entries {
+		for pi, cell := range entry.Problems {
+			if cell.FirstToSolve != want[ei][pi] {
+				t.Errorf("user %d, problem %s: first to solve %v, want %v", entry.UserID, leaderboard.Problems[pi].Label, cell.FirstToSolve, want[ei][pi])
+			}
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	leaderboard := &models.Leaderboard{
+		Problems: []models.LeaderboardProblemSummary{{Label: "A", Attempts: 99}, {Label: "B"}},
+		Entries: []models.LeaderboardEntry{
+			{Problems: []models.LeaderboardCell{foldAll(submission{"wrong_answer", 1}, submission{"accepted", 2}), foldAll(submission{"wrong_answer", 1})}},
+			{Problems: []models.LeaderboardCell{foldAll(submission{"accepted", 5}), foldAll(submission{"pending", 1})}},
+		},
+	}
+
+	summarize(leaderboard)
+
+	if a := leaderboard.Problems[0]; a.Attempts != 3 || a.AcceptedCount != 2 {
+		t.Errorf("A: %d attempts and %d accepted, want 3 and 2", a.Attempts, a.AcceptedCount)
+	}
+	if b := leaderboard.Problems[1]; b.Attempts != 1 || b.AcceptedCount != 0 {
+		t.Errorf("B: %d attempts and %d accepted, want 1 and 0", b.Attempts, b.AcceptedCount)
+	}
+}
+
+func TestTotalEntry(t *testing.T) {
+	entry := &models.LeaderboardEntry{
+		SolvedCount: 9, // stale totals are replaced
+		Penalty:     999,
+		Problems: []models.LeaderboardCell{
+			solvedCell(30, 1),
+			{Attempts: 4},
+			solvedCell(75, 2),
+		},
+	}
+
+	totalEntry(entry)
+
+	last := contestStart.Add(75 * time.Minute)
+	if entry.SolvedCount != 2 || entry.Penalty != 105 || entry.LastSubmissionTime == nil || !entry.LastSubmissionTime.Equal(last) {
+		t.Errorf("got %d solved, penalty %d, last %v; want 2, 105, %v", entry.SolvedCount, entry.Penalty, entry.LastSubmissionTime, last)
+	}
+
+	unsolved := &models.LeaderboardEntry{LastSubmissionTime: &last, Problems: []models.LeaderboardCell{{Attempts: 1}}}
+	totalEntry(unsolved)
+	if unsolved.SolvedCount != 0 || unsolved.Penalty != 0 || unsolved.LastSubmissionTime != nil {
+		t.Errorf("unsolved entry: got %d solved, penalty %d, last %v", unsolved.SolvedCount, unsolved.Penalty, unsolved.LastSubmissionTime)
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	at := func(minute int) *time.Time {
+		t := contestStart.Add(time.Duration(minute) * time.Minute)
+		return &t
+	}
+	entries := []models.LeaderboardEntry{
+		{UserID: 1, SolvedCount: 1, Penalty: 50, LastSubmissionTime: at(50)},
+		{UserID: 2, SolvedCount: 2, Penalty: 90, LastSubmissionTime: at(60)},
+		{UserID: 3, SolvedCount: 2, Penalty: 90, LastSubmissionTime: at(55)}, // same penalty, solved last problem sooner
+		{UserID: 4, SolvedCount: 2, Penalty: 70, LastSubmissionTime: at(70)},
+		{UserID: 5},
+		{UserID: 6, SolvedCount: 1, Penalty: 50, LastSubmissionTime: at(50)}, // full tie, by user id
+		{UserID: 7, SolvedCount: 0, Penalty: 0},
+	}
+
+	sortEntries(entries)
+
+	want := []int{4, 3, 2, 1, 6, 5, 7}
+	for i, entry := range entries {
+		if entry.UserID != want[i] {
+			var got []int
+			for _, e := range entries {
+				got = append(got, e.UserID)
+			}
+			t.Fatalf("got order %v, want %v", got, want)
+		}
+	}
+}
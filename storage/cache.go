@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CachedStore serves blobs of a remote store from a local disk cache. Blobs
+// are content-addressed and never change, so cached copies never go stale;
+// the least recently used ones are evicted once the cache exceeds MaxBytes.
+type CachedStore struct {
+	Remote   Store
+	Local    *LocalStore
+	MaxBytes int64
+
+	mu       sync.Mutex
+	inflight map[string]*keyLock // one download per key at a time
+}
+
+// keyLock serializes the readers of one key; it is dropped from inflight
+// once no reader holds or waits for it
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewCachedStore returns a store caching remote under dir
+func NewCachedStore(remote Store, dir string, maxBytes int64) (*CachedStore, error) {
+	local, err := NewLocalStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &CachedStore{Remote: remote, Local: local, MaxBytes: maxBytes, inflight: map[string]*keyLock{}}, nil
+}
+
+// Put uploads to the remote store; the blob is cached on first read
+func (s *CachedStore) Put(key string, r io.Reader, size int64) error {
+	return s.Remote.Put(key, r, size)
+}
+
+// Exists checks the cache before asking the remote store
+func (s *CachedStore) Exists(key string) (bool, error) {
+	if ok, _ := s.Local.Exists(key); ok {
+		return true, nil
+	}
+	return s.Remote.Exists(key)
+}
+
+// Open returns the cached copy, downloading it first if needed
+func (s *CachedStore) Open(key string) (io.ReadCloser, error) {
+	if rc, err := s.Local.Open(key); err == nil {
+		s.touch(key)
+		return rc, nil
+	}
+
+	defer s.lockKey(key)()
+
+	// Another reader may have fetched it while we waited
+	if rc, err := s.Local.Open(key); err == nil {
+		s.touch(key)
+		return rc, nil
+	}
+	if err := s.fetch(key); err != nil {
+		return nil, err
+	}
+	s.evict(key)
+	return s.Local.Open(key)
+}
+
+// fetch downloads a blob into the cache, verifying its content hash
+func (s *CachedStore) fetch(key string) error {
+	rc, err := s.Remote.Open(key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	verified := &hashCheckReader{r: io.TeeReader(rc, hash), hash: func() string { return hex.EncodeToString(hash.Sum(nil)) }, want: key}
+	return s.Local.Put(key, verified, -1)
+}
+
+// lockKey waits until no other reader is downloading key and returns the
+// func that releases it
+func (s *CachedStore) lockKey(key string) func() {
+	s.mu.Lock()
+	lock, ok := s.inflight[key]
+	if !ok {
+		lock = &keyLock{}
+		s.inflight[key] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		s.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(s.inflight, key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// touch marks a cached blob as recently used
+func (s *CachedStore) touch(key string) {
+	now := time.Now()
+	os.Chtimes(s.Local.path(key), now, now)
+}
+
+// evict removes the least recently used blobs until the cache fits
+// MaxBytes, sparing keep, the blob just downloaded for a reader, even when it
+// alone is larger than MaxBytes
+func (s *CachedStore) evict(keep string) {
+	if s.MaxBytes <= 0 {
+		return
+	}
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var total int64
+	kept := s.Local.path(keep)
+	filepath.Walk(s.Local.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Base(path)[0] == '.' {
+			return nil
+		}
+		total += info.Size()
+		if path != kept {
+			entries = append(entries, entry{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	if total <= s.MaxBytes {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= s.MaxBytes {
+			break
+		}
+		if os.Remove(e.path) == nil {
+			total -= e.size
+		}
+	}
+}
+
+// hashCheckReader fails at EOF if the content read does not hash to want,
+// so a corrupt download never lands in the cache
+type hashCheckReader struct {
+	r    io.Reader
+	hash func() string
+	want string
+}
+
+func (h *hashCheckReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if err == io.EOF {
+		if got := h.hash(); got != h.want {
+			return n, fmt.Errorf("blob %s: downloaded content hashes to %s", h.want, got)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a remote store in memory that counts downloads and can
+// serve corrupt content
+type memoryStore struct {
+	mu      sync.Mutex
+	blobs   map[string]string
+	opens   map[string]int
+	corrupt int // how many downloads to corrupt
+}
+
+func newMemoryStore(contents ...string) *memoryStore {
+	m := &memoryStore{blobs: map[string]string{}, opens: map[string]int{}}
+	for _, c := range contents {
+		m.blobs[sha256Hex([]byte(c))] = c
+	}
+	return m
+}
+
+func (m *memoryStore) Put(key string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[key] = string(data)
+	return nil
+}
+
+func (m *memoryStore) Open(key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	m.opens[key]++
+	if m.corrupt > 0 {
+		m.corrupt--
+		data = "corrupt " + data
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (m *memoryStore) Exists(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.blobs[key]
+	return ok, nil
+}
+
+func newTestCache(t *testing.T, remote Store, maxBytes int64) *CachedStore {
+	s, err := NewCachedStore(remote, t.TempDir(), maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func readBlob(t *testing.T, s Store, key string) string {
+	t.Helper()
+	rc, err := s.Open(key)
+	if err != nil {
+		t.Fatalf("open %s: %v", key[:8], err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %s: %v", key[:8], err)
+	}
+	return string(data)
+}
+
+func cached(t *testing.T, s *CachedStore, key string) bool {
+	t.Helper()
+	ok, err := s.Local.Exists(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestCachedStoreMissThenHit(t *testing.T) {
+	remote := newMemoryStore("hello")
+	s := newTestCache(t, remote, 0)
+	key := sha256Hex([]byte("hello"))
+
+	for i := 0; i < 3; i++ {
+		if got := readBlob(t, s, key); got != "hello" {
+			t.Fatalf("read %q", got)
+		}
+	}
+	if remote.opens[key] != 1 {
+		t.Errorf("downloaded %d times, want once", remote.opens[key])
+	}
+	if _, err := s.Open(sha256Hex([]byte("missing"))); err != ErrNotFound {
+		t.Errorf("open of a missing blob: %v, want ErrNotFound", err)
+	}
+}
+
+func TestCachedStoreRefetchesCorruptDownload(t *testing.T) {
+	remote := newMemoryStore("hello")
+	remote.corrupt = 1
+	s := newTestCache(t, remote, 0)
+	key := sha256Hex([]byte("hello"))
+
+	if _, err := s.Open(key); err == nil {
+		t.Fatal("corrupt download was served")
+	}
+	if cached(t, s, key) {
+		t.Fatal("corrupt download was cached")
+	}
+	if got := readBlob(t, s, key); got != "hello" {
+		t.Fatalf("read %q after refetch", got)
+	}
+	if remote.opens[key] != 2 {
+		t.Errorf("downloaded %d times, want twice", remote.opens[key])
+	}
+}
+
+func TestCachedStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	a, b, c := strings.Repeat("a", 100), strings.Repeat("b", 100), strings.Repeat("c", 100)
+	s := newTestCache(t, newMemoryStore(a, b, c), 250)
+	keyA, keyB, keyC := sha256Hex([]byte(a)), sha256Hex([]byte(b)), sha256Hex([]byte(c))
+
+	readBlob(t, s, keyA)
+	readBlob(t, s, keyB)
+	// b was used after a
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(s.Local.path(keyA), old.Add(-time.Minute), old.Add(-time.Minute))
+	os.Chtimes(s.Local.path(keyB), old, old)
+
+	readBlob(t, s, keyC)
+	if cached(t, s, keyA) || !cached(t, s, keyB) || !cached(t, s, keyC) {
+		t.Errorf("cached a %v, b %v, c %v; want b and c", cached(t, s, keyA), cached(t, s, keyB), cached(t, s, keyC))
+	}
+}
+
+func TestCachedStoreKeepsBlobLargerThanCache(t *testing.T) {
+	big := strings.Repeat("x", 1000)
+	s := newTestCache(t, newMemoryStore("small", big), 100)
+	small, key := sha256Hex([]byte("small")), sha256Hex([]byte(big))
+
+	readBlob(t, s, small)
+	if got := readBlob(t, s, key); got != big {
+		t.Fatalf("read %d bytes, want %d", len(got), len(big))
+	}
+	if cached(t, s, small) {
+		t.Error("older blob kept over the limit")
+	}
+}
+
+func TestCachedStoreConcurrentReaders(t *testing.T) {
+	remote := newMemoryStore("hello")
+	s := newTestCache(t, remote, 0)
+	key := sha256Hex([]byte("hello"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := readBlob(t, s, key); got != "hello" {
+				t.Errorf("read %q", got)
+			}
+		}()
+	}
+	wg.Wait()
+	if remote.opens[key] != 1 {
+		t.Errorf("downloaded %d times, want once", remote.opens[key])
+	}
+	if len(s.inflight) != 0 {
+		t.Errorf("%d download locks left behind", len(s.inflight))
+	}
+}
+
+func TestCachedStorePutGoesToRemote(t *testing.T) {
+	remote := newMemoryStore()
+	s := newTestCache(t, remote, 0)
+	key := sha256Hex([]byte("hello"))
+
+	if err := s.Put(key, strings.NewReader("hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if cached(t, s, key) {
+		t.Error("Put cached the blob before it was read")
+	}
+	if ok, err := s.Exists(key); err != nil || !ok {
+		t.Errorf("Exists: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs as files in a directory, fanned out by key prefix
+type LocalStore struct {
+	Dir string
+}
+
+// NewLocalStore creates the directory if needed and returns a store over it
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.Dir, key[:2], key[2:4], key)
+}
+
+// Put writes the blob to a temporary file and renames it into place, so
+// readers never see a partial blob
+func (s *LocalStore) Put(key string, r io.Reader, size int64) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	dest := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("blob %s: wrote %d bytes, expected %d", key, n, size)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// Open opens the blob file
+func (s *LocalStore) Open(key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Exists reports whether the blob file exists
+func (s *LocalStore) Exists(key string) (bool, error) {
+	if !validKey(key) {
+		return false, nil
+	}
+	_, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
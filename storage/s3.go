@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// unsignedPayload lets uploads stream without hashing the body up front
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Store keeps blobs in a bucket of an S3-compatible service (AWS S3, MinIO, ...),
+// signing requests with AWS Signature Version 4
+type S3Store struct {
+	Endpoint  *url.URL // e.g. http://localhost:9000
+	Bucket    string
+	Prefix    string // optional key prefix inside the bucket, e.g. "testcases/"
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // address the bucket as /bucket/key instead of bucket.host/key
+	Client    *http.Client
+}
+
+// NewS3StoreFromEnv configures an S3Store from S3_ENDPOINT, S3_BUCKET,
+// S3_REGION, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_PREFIX and
+// S3_PATH_STYLE (default true, as MinIO expects)
+func NewS3StoreFromEnv() (*S3Store, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 blob backend")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+	return &S3Store{
+		Endpoint:  u,
+		Bucket:    bucket,
+		Prefix:    os.Getenv("S3_PREFIX"),
+		Region:    envOr("S3_REGION", "us-east-1"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		Client:    &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// objectURL returns the URL of the object stored under key
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.Endpoint
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/")
+	if s.PathStyle {
+		escaped += "/" + url.PathEscape(s.Bucket)
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	escaped += "/" + escapePath(s.Prefix+key)
+	// Path is the unescaped form of RawPath, which the request is sent and
+	// signed with
+	u.Path, _ = url.PathUnescape(escaped)
+	u.RawPath = escaped
+	return &u
+}
+
+// Put uploads the blob with a single PUT request
+func (s *S3Store) Put(key string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("PUT", key, resp)
+	}
+	return nil
+}
+
+// Open starts downloading the blob
+func (s *S3Store) Open(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error("GET", key, resp)
+	}
+	return resp.Body, nil
+}
+
+// Exists sends a HEAD request for the blob
+func (s *S3Store) Exists(key string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, s.objectURL(key).String(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3Error("HEAD", key, resp)
+	}
+}
+
+// do signs and sends a request
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+	return s.Client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to a request
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headerValues := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	sort.Strings(signed)
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headerValues[name]) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// canonicalQuery encodes query parameters sorted by name, as SigV4 requires
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, url.QueryEscape(k)+"="+strings.ReplaceAll(url.QueryEscape(v), "+", "%20"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath escapes each segment of an object key
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3Error describes a failed request, including the start of the error body
+func s3Error(method, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(body)))
+}
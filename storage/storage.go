@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned when a blob does not exist in a store
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps immutable blobs under string keys
+type Store interface {
+	// Put stores size bytes read from r under key
+	Put(key string, r io.Reader, size int64) error
+	// Open returns a reader for the blob stored under key, or ErrNotFound
+	Open(key string) (io.ReadCloser, error)
+	// Exists reports whether a blob is stored under key
+	Exists(key string) (bool, error)
+}
+
+// Blob identifies stored content by its SHA-256 hash
+type Blob struct {
+	Hash string
+	Size int64
+}
+
+// Default is the store used for testcase data, set up by Init
+var Default Store
+
+// Init configures Default from the environment. BLOB_BACKEND selects "local"
+// (the default, files under BLOB_DIR) or "s3" (an S3-compatible bucket,
+// cached on local disk under BLOB_CACHE_DIR).
+func Init() error {
+	switch backend := os.Getenv("BLOB_BACKEND"); backend {
+	case "", "local":
+		dir := envOr("BLOB_DIR", "./data/blobs")
+		local, err := NewLocalStore(dir)
+		if err != nil {
+			return err
+		}
+		Default = local
+	case "s3":
+		remote, err := NewS3StoreFromEnv()
+		if err != nil {
+			return err
+		}
+		cacheDir := envOr("BLOB_CACHE_DIR", "./data/blob-cache")
+		maxMB, err := strconv.ParseInt(envOr("BLOB_CACHE_MAX_MB", "1024"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid BLOB_CACHE_MAX_MB: %w", err)
+		}
+		cached, err := NewCachedStore(remote, cacheDir, maxMB<<20)
+		if err != nil {
+			return err
+		}
+		Default = cached
+	default:
+		return fmt.Errorf("unknown BLOB_BACKEND %q", backend)
+	}
+	return nil
+}
+
+// Put stores content in Default under its SHA-256 hash. Content already
+// stored is not uploaded again.
+func Put(r io.Reader) (Blob, error) {
+	// Spool to a temporary file: the key is only known once everything is read
+	tmp, err := os.CreateTemp("", "blob-*")
+	if err != nil {
+		return Blob{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return Blob{}, err
+	}
+	blob := Blob{Hash: hex.EncodeToString(hash.Sum(nil)), Size: size}
+
+	exists, err := Default.Exists(blob.Hash)
+	if err != nil {
+		return Blob{}, err
+	}
+	if exists {
+		return blob, nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return Blob{}, err
+	}
+	if err := Default.Put(blob.Hash, tmp, size); err != nil {
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// PutString stores a string in Default
+func PutString(s string) (Blob, error) {
+	return Put(strings.NewReader(s))
+}
+
+// Open returns a reader for a blob in Default
+func Open(hash string) (io.ReadCloser, error) {
+	return Default.Open(hash)
+}
+
+// ReadString reads a whole blob from Default; meant for small blobs such as samples
+func ReadString(hash string) (string, error) {
+	rc, err := Open(hash)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	return string(data), err
+}
+
+// validKey guards against path traversal through keys
+func validKey(key string) bool {
+	if len(key) < 4 {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}